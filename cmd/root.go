@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
 	"github.com/endjin/CNAB.ARM-Converter/pkg/generator"
 	"github.com/endjin/CNAB.ARM-Converter/pkg/run"
 	"github.com/spf13/cobra"
@@ -14,15 +16,41 @@ var Version string
 
 var bundleloc string
 var bundleTag string
+var bundleDigest string
 var outputloc string
 var overwrite bool
 var indent bool
 var simplify bool
+var uiDefinitionloc string
+var formats []string
+var templateloc string
+var parameterSetloc string
+var credentialSetloc string
+var keyVaultID string
+var parametersloc string
+var previewParametersloc string
+var parameterProfile string
+var includeParameters []string
+var excludeParameters []string
+var useKeyVault bool
+var managedIdentity string
+var runner string
+var configFile bool
+var logFormat string
+var logSink string
+var validateBundleloc string
+var subscriptionID string
+var tenantID string
+var resourceGroupName string
+var location string
+var fromBundleloc string
+var toBundleloc string
 
 var rootCmd = &cobra.Command{
 	Use:   "cnabarmdriver",
-	Short: "Runs Porter with the Azure driver, using environment variables ",
+	Short: "Runs the bundle with the Azure driver, using environment variables ",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
 		return run.Run()
 	},
 }
@@ -42,36 +70,251 @@ var generateCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cmd.SilenceUsage = true
 
+		// If no bundle file is specified and there is no bundle.json in the current directory then pull the bundle from the registry
+		if !cmd.Flags().Changed("bundle") {
+			if _, err := os.Stat(bundleloc); os.IsNotExist(err) {
+				bundleloc = ""
+			}
+		}
+
 		options := generator.GenerateTemplateOptions{
-			BundleLoc:  bundleloc,
-			BundleTag:  bundleTag,
-			Indent:     indent,
-			OutputFile: outputloc,
-			Overwrite:  overwrite,
-			Version:    Version,
-			Simplify:   simplify,
+			BundleLoc:         bundleloc,
+			BundleTag:         bundleTag,
+			BundleDigest:      bundleDigest,
+			Indent:            indent,
+			OutputFile:        outputloc,
+			Overwrite:         overwrite,
+			Version:           Version,
+			Simplify:          simplify,
+			UIDefinitionFile:  uiDefinitionloc,
+			Formats:           formats,
+			ParameterProfile:  parameterProfile,
+			IncludeParameters: includeParameters,
+			ExcludeParameters: excludeParameters,
+			KeyVault:          useKeyVault,
+			ManagedIdentity:   managedIdentity,
+			Runner:            runner,
+			ConfigFile:        configFile,
+			LogFormat:         logFormat,
+			LogSink:           logSink,
 		}
 
 		return generator.GenerateTemplate(options)
 	},
 }
 
+var generateParamsCmd = &cobra.Command{
+	Use:   "params",
+	Short: "Generates an ARM template parameters file from a parameter set and credential set",
+	Long:  `Generates an ARM template parameters file for a generated template using the values from a Porter/CNAB parameter set and credential set, credentials can be referenced from Key Vault`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		options := generator.GenerateParametersOptions{
+			TemplateFile:      templateloc,
+			ParameterSetFile:  parameterSetloc,
+			CredentialSetFile: credentialSetloc,
+			KeyVaultID:        keyVaultID,
+			OutputFile:        parametersloc,
+			Overwrite:         overwrite,
+			Indent:            indent,
+		}
+
+		return generator.GenerateParameters(options)
+	},
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validates a generated ARM template",
+	Long:  `Validates a generated or hand edited ARM template, checking that parameter and variable references resolve, that default values are allowed, that secure parameters are not set as plain environment variable values and, if a bundle is specified, that every bundle parameter and credential is set by a container environment variable`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		options := generator.ValidateTemplateOptions{
+			TemplateFile:      templateloc,
+			BundleLoc:         validateBundleloc,
+			BundleTag:         bundleTag,
+			ParameterProfile:  parameterProfile,
+			IncludeParameters: includeParameters,
+			ExcludeParameters: excludeParameters,
+		}
+
+		problems, err := generator.ValidateTemplate(options)
+		if err != nil {
+			return err
+		}
+
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+
+		if len(problems) > 0 {
+			return fmt.Errorf("Template %s has %d problems", templateloc, len(problems))
+		}
+
+		fmt.Printf("Template %s is valid\n", templateloc)
+		return nil
+	},
+}
+
+var previewCmd = &cobra.Command{
+	Use:   "preview",
+	Short: "Previews the environment a generated ARM template sets for the driver container",
+	Long:  `Evaluates a generated ARM template with a parameters file for a fake deployment and prints the CNAB environment variables the driver container would receive, with secure values redacted, and the parameter set and credential set the driver would create for Porter`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		options := generator.PreviewTemplateOptions{
+			TemplateFile:      templateloc,
+			ParametersFile:    previewParametersloc,
+			SubscriptionID:    subscriptionID,
+			TenantID:          tenantID,
+			ResourceGroupName: resourceGroupName,
+			Location:          location,
+		}
+
+		preview, err := generator.PreviewTemplate(options)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Environment variables:")
+		for _, environmentVariable := range preview.EnvironmentVariables {
+			if environmentVariable.Secure {
+				fmt.Printf("  %s=%s (secure)\n", environmentVariable.Name, environmentVariable.Value)
+				continue
+			}
+			fmt.Printf("  %s=%s\n", environmentVariable.Name, environmentVariable.Value)
+		}
+
+		parameterSet, err := json.MarshalIndent(preview.ParameterSet, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\nParameter set:\n%s\n", parameterSet)
+
+		credentialSet, err := json.MarshalIndent(preview.CredentialSet, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\nCredential set:\n%s\n", credentialSet)
+
+		return nil
+	},
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compares the ARM templates generated for two versions of a bundle",
+	Long:  `Generates the ARM templates for two versions of a bundle and reports the parameters, allowed values, defaults and actions that were added, removed or changed, failing if any of the changes are breaking, i.e. a new required parameter, a removed parameter or allowed value, a changed type or a tightened constraint`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		options := generator.DiffTemplatesOptions{
+			FromBundleLoc: fromBundleloc,
+			ToBundleLoc:   toBundleloc,
+			Options: generator.GenerateTemplateOptions{
+				Version:           Version,
+				Simplify:          simplify,
+				ParameterProfile:  parameterProfile,
+				IncludeParameters: includeParameters,
+				ExcludeParameters: excludeParameters,
+				KeyVault:          useKeyVault,
+				ManagedIdentity:   managedIdentity,
+			},
+		}
+
+		changes, err := generator.DiffTemplates(options)
+		if err != nil {
+			return err
+		}
+
+		if len(changes) == 0 {
+			fmt.Println("The templates have the same parameters and actions")
+			return nil
+		}
+
+		for _, change := range changes {
+			if change.Breaking {
+				fmt.Printf("BREAKING: %s\n", change.Description)
+				continue
+			}
+			fmt.Println(change.Description)
+		}
+
+		if breaking := generator.BreakingChanges(changes); breaking > 0 {
+			return fmt.Errorf("Found %d breaking changes", breaking)
+		}
+
+		return nil
+	},
+}
+
 func init() {
-	generateCmd.Flags().StringVarP(&bundleloc, "bundle", "b", "bundle.json", "name of bundle file to generate template for, default is bundle.json")
-	generateCmd.Flags().StringVarP(&bundleTag, "bundleTag", "t", "", "the tag for the bundle, e.g. cnabquickstarts.azurecr.io/porter/foo/bundle:0.1.0")
-	generateCmd.MarkFlagRequired("bundleTag")
+	generateCmd.Flags().StringVarP(&bundleloc, "bundle", "b", "bundle.json", "name of bundle file, CNAB archive (.tgz), Porter manifest (porter.yaml) or http(s) URL to generate template for, default is bundle.json, if not specified and bundle.json does not exist the bundle is pulled from the registry using the bundle tag")
+	generateCmd.Flags().StringVarP(&bundleTag, "bundleTag", "t", "", "the tag for the bundle, e.g. cnabquickstarts.azurecr.io/porter/foo/bundle:0.1.0, required unless generating from a Porter manifest that specifies the tag")
+	generateCmd.Flags().StringVarP(&bundleDigest, "bundleDigest", "d", "", "the expected digest of the bundle.json, e.g. sha256:..., verified for bundle files, archives, URLs and bundles pulled from the registry but not Porter manifests, bundles downloaded from a URL with a digest are cached locally")
 	generateCmd.Flags().StringVarP(&outputloc, "file", "f", "azuredeploy.json", "file name for generated template,default is azuredeploy.json")
 	generateCmd.Flags().BoolVarP(&overwrite, "overwrite", "o", false, "specifies if to overwrite the output file if it already exists, default is false")
 	generateCmd.Flags().BoolVarP(&indent, "indent", "i", false, "specifies if the json output should be indented")
+	generateCmd.Flags().StringVarP(&uiDefinitionloc, "uiDefinition", "u", "", "file name for a generated createUiDefinition.json for deploying the template from the Azure portal, if not specified no UI definition is generated")
+	generateCmd.Flags().StringSliceVar(&formats, "format", []string{generator.FormatJSON}, "the formats to generate the template in, json and/or bicep, e.g. --format json,bicep, the bicep file is named after the output file with a .bicep extension")
+	generateCmd.Flags().StringVar(&parameterProfile, "parameterProfile", generator.ParameterProfilePorter, "the tool that built the bundle, porter, duffle or cnab, parameters added by the tool are not exposed in the template")
+	generateCmd.Flags().StringSliceVar(&includeParameters, "includeParameters", nil, "glob patterns of parameters to expose in the template even if they are excluded by the parameter profile, e.g. --includeParameters porter-debug")
+	generateCmd.Flags().StringSliceVar(&excludeParameters, "excludeParameters", nil, "glob patterns of parameters that are not exposed in the template, e.g. --excludeParameters internal-*")
+	generateCmd.Flags().BoolVar(&useKeyVault, "keyVault", false, "specifies if credentials and sensitive parameters should be read from Key Vault secrets using a managed identity, the template parameters are the names of the secrets instead of their values")
+	generateCmd.Flags().StringVar(&managedIdentity, "managedIdentity", "", "the type of managed identity the driver uses to authenticate to Azure instead of a service principal, only user is supported, the identity is assigned a role scoped to the resource group")
+	generateCmd.Flags().StringVar(&runner, "runner", common.RunnerPorter, "the backend the driver uses to run the bundle, porter runs the porter CLI, cnab runs the bundle in-process using cnab-go, installations are not shared between the backends")
+	generateCmd.Flags().BoolVar(&configFile, "configFile", false, "specifies if the template should have a cnab_config_file parameter for a YAML or JSON config file for the driver, the file is mounted in the container from a secret volume")
+	generateCmd.Flags().StringVar(&logFormat, "logFormat", "", "the format the driver writes the output of the action in, text or json, if not specified the output is written as it is")
+	generateCmd.Flags().StringVar(&logSink, "logSink", "", "where the driver forwards the output of the action, http adds a cnab_log_sink_url parameter, loganalytics adds a cnab_log_analytics_workspace parameter for the resource id of the workspace and reads its key, if not specified the output is not forwarded")
 	generateCmd.Flags().BoolVarP(&simplify, "simplify", "s", false, "specifies if the ARM template should be simplified, exposing less parameters and inferring default values")
 
+	generateParamsCmd.Flags().StringVarP(&templateloc, "template", "t", "azuredeploy.json", "file name of the generated template to create the parameters file for")
+	generateParamsCmd.Flags().StringVarP(&parameterSetloc, "parameterSet", "p", "", "file name of the parameter set (JSON or YAML) to read parameter values from")
+	generateParamsCmd.Flags().StringVarP(&credentialSetloc, "credentialSet", "c", "", "file name of the credential set (JSON or YAML) to read credential values from")
+	generateParamsCmd.Flags().StringVarP(&keyVaultID, "keyVault", "k", "", "resource id of the Key Vault to reference credentials from, secrets are named after the credential with _ replaced by - unless the credential has a secret source, if not specified credential values are resolved locally")
+	generateParamsCmd.Flags().StringVarP(&parametersloc, "file", "f", "azuredeploy.parameters.json", "file name for generated parameters file")
+	generateParamsCmd.Flags().BoolVarP(&overwrite, "overwrite", "o", false, "specifies if to overwrite the output file if it already exists, default is false")
+	generateParamsCmd.Flags().BoolVarP(&indent, "indent", "i", false, "specifies if the json output should be indented")
+
+	validateCmd.Flags().StringVarP(&templateloc, "template", "t", "azuredeploy.json", "file name of the template to validate")
+	validateCmd.Flags().StringVarP(&validateBundleloc, "bundle", "b", "", "name of bundle file, CNAB archive (.tgz), Porter manifest (porter.yaml) or http(s) URL the template was generated from, if neither this nor the bundle tag is specified the template is not checked against the bundle")
+	validateCmd.Flags().StringVar(&bundleTag, "bundleTag", "", "the tag of the bundle the template was generated from, used to pull the bundle from the registry if the bundle file is not specified")
+	validateCmd.Flags().StringVar(&parameterProfile, "parameterProfile", generator.ParameterProfilePorter, "the tool that built the bundle, porter, duffle or cnab, parameters added by the tool are not expected to be set by the template")
+	validateCmd.Flags().StringSliceVar(&includeParameters, "includeParameters", nil, "glob patterns of parameters that the template was generated to expose even if they are excluded by the parameter profile")
+	validateCmd.Flags().StringSliceVar(&excludeParameters, "excludeParameters", nil, "glob patterns of parameters that the template was generated not to expose")
+
+	previewCmd.Flags().StringVarP(&templateloc, "template", "t", "azuredeploy.json", "file name of the generated template to preview")
+	previewCmd.Flags().StringVarP(&previewParametersloc, "parameters", "p", "", "file name of the ARM template parameters file for the deployment, if not specified the template parameters must have default values")
+	previewCmd.Flags().StringVar(&subscriptionID, "subscriptionId", "00000000-0000-0000-0000-000000000000", "the subscription id of the deployment, used by subscription() and resourceId()")
+	previewCmd.Flags().StringVar(&tenantID, "tenantId", "00000000-0000-0000-0000-000000000000", "the tenant id of the deployment, used by subscription()")
+	previewCmd.Flags().StringVar(&resourceGroupName, "resourceGroup", "preview-rg", "the name of the resource group of the deployment, used by resourceGroup() and resourceId()")
+	previewCmd.Flags().StringVar(&location, "location", "westeurope", "the location of the resource group of the deployment, used by resourceGroup()")
+
+	diffCmd.Flags().StringVar(&fromBundleloc, "from", "", "name of the bundle file, CNAB archive (.tgz), Porter manifest (porter.yaml) or http(s) URL of the current version of the bundle")
+	diffCmd.Flags().StringVar(&toBundleloc, "to", "", "name of the bundle file, CNAB archive (.tgz), Porter manifest (porter.yaml) or http(s) URL of the new version of the bundle")
+	diffCmd.Flags().BoolVarP(&simplify, "simplify", "s", false, "specifies if the templates are simplified, as they are by generate --simplify")
+	diffCmd.Flags().StringVar(&parameterProfile, "parameterProfile", generator.ParameterProfilePorter, "the tool that built the bundle, porter, duffle or cnab, parameters added by the tool are not exposed in the templates")
+	diffCmd.Flags().StringSliceVar(&includeParameters, "includeParameters", nil, "glob patterns of parameters to expose in the templates even if they are excluded by the parameter profile")
+	diffCmd.Flags().StringSliceVar(&excludeParameters, "excludeParameters", nil, "glob patterns of parameters that are not exposed in the templates")
+	diffCmd.Flags().BoolVar(&useKeyVault, "keyVault", false, "specifies if the templates read credentials and sensitive parameters from Key Vault, as they do for generate --keyVault")
+	diffCmd.Flags().StringVar(&managedIdentity, "managedIdentity", "", "the type of managed identity the templates use, user, as they do for generate --managedIdentity")
+	diffCmd.MarkFlagRequired("from")
+	diffCmd.MarkFlagRequired("to")
+
+	generateCmd.AddCommand(generateParamsCmd)
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(generateCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(previewCmd)
+	rootCmd.AddCommand(diffCmd)
 }
 
-// Execute runs the template generator
+// Execute runs the template generator, errors from running a bundle action exit with a code that identifies what failed
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+		os.Exit(run.ExitCode(err))
 	}
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestGenerateParamsDefaultFile(t *testing.T) {
+	testdata, err := filepath.Abs("../pkg/generator/testdata")
+	assert.NilError(t, err)
+
+	dir, err := ioutil.TempDir("", "cnabarmdriver")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	err = os.Chdir(dir)
+	assert.NilError(t, err)
+	defer os.Chdir(wd)
+
+	os.Setenv("HELLO_WORLD_PERSON", "bob")
+	defer os.Unsetenv("HELLO_WORLD_PERSON")
+
+	assert.Equal(t, generateParamsCmd.Flags().Lookup("file").DefValue, "azuredeploy.parameters.json")
+
+	rootCmd.SetArgs([]string{"generate", "params", "-t", filepath.Join(testdata, "azuredeploy.json"), "-p", filepath.Join(testdata, "parameter-set.yaml")})
+	err = rootCmd.Execute()
+	assert.NilError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "azuredeploy.parameters.json"))
+	assert.NilError(t, err)
+}
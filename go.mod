@@ -5,5 +5,6 @@ go 1.15
 require (
 	github.com/cnabio/cnab-go v0.14.0
 	github.com/spf13/cobra v0.0.6
+	gopkg.in/yaml.v2 v2.2.4
 	gotest.tools/v3 v3.0.2
 )
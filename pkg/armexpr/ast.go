@@ -0,0 +1,127 @@
+package armexpr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Node is a node in a parsed ARM template expression
+type Node interface {
+	// String returns the node in ARM template expression syntax
+	String() string
+}
+
+// StringLiteral is a string literal such as 'foo'
+type StringLiteral struct {
+	Value string
+}
+
+// IntegerLiteral is an integer literal such as 42
+type IntegerLiteral struct {
+	Value int64
+}
+
+// BoolLiteral is the literal true or false
+type BoolLiteral struct {
+	Value bool
+}
+
+// NullLiteral is the literal null
+type NullLiteral struct{}
+
+// FunctionCall is a call to a template function such as concat('a', 'b')
+type FunctionCall struct {
+	Name      string
+	Arguments []Node
+}
+
+// PropertyAccess accesses a property of an object such as resourceGroup().id
+type PropertyAccess struct {
+	Target   Node
+	Property string
+}
+
+// IndexAccess accesses an element of an array or a property of an object such as listKeys(...).keys[0]
+type IndexAccess struct {
+	Target Node
+	Index  Node
+}
+
+func (n StringLiteral) String() string {
+	return "'" + strings.ReplaceAll(n.Value, "'", "''") + "'"
+}
+
+func (n IntegerLiteral) String() string {
+	return fmt.Sprintf("%d", n.Value)
+}
+
+func (n BoolLiteral) String() string {
+	return fmt.Sprintf("%t", n.Value)
+}
+
+func (n NullLiteral) String() string {
+	return "null"
+}
+
+func (n FunctionCall) String() string {
+	arguments := make([]string, 0, len(n.Arguments))
+	for _, argument := range n.Arguments {
+		arguments = append(arguments, argument.String())
+	}
+
+	return n.Name + "(" + strings.Join(arguments, ", ") + ")"
+}
+
+func (n PropertyAccess) String() string {
+	return n.Target.String() + "." + n.Property
+}
+
+func (n IndexAccess) String() string {
+	return n.Target.String() + "[" + n.Index.String() + "]"
+}
+
+// IsFunction checks if the node is a call to the named function, function names are case insensitive
+func IsFunction(node Node, name string) (FunctionCall, bool) {
+	call, ok := node.(FunctionCall)
+	if !ok || !strings.EqualFold(call.Name, name) {
+		return FunctionCall{}, false
+	}
+
+	return call, true
+}
+
+// Reference returns the name of the parameter or variable referenced by a parameters('x') or variables('x') call
+func Reference(node Node, function string) (string, bool) {
+	call, ok := IsFunction(node, function)
+	if !ok || len(call.Arguments) != 1 {
+		return "", false
+	}
+
+	name, ok := call.Arguments[0].(StringLiteral)
+	if !ok {
+		return "", false
+	}
+
+	return name.Value, true
+}
+
+// References returns the names of the parameters or variables referenced anywhere in an expression by parameters('x') or variables('x') calls
+func References(node Node, function string) []string {
+	if name, ok := Reference(node, function); ok {
+		return []string{name}
+	}
+
+	var names []string
+	switch n := node.(type) {
+	case FunctionCall:
+		for _, argument := range n.Arguments {
+			names = append(names, References(argument, function)...)
+		}
+	case PropertyAccess:
+		names = References(n.Target, function)
+	case IndexAccess:
+		names = append(References(n.Target, function), References(n.Index, function)...)
+	}
+
+	return names
+}
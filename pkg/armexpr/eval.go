@@ -0,0 +1,616 @@
+package armexpr
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Context is the deployment that expressions are evaluated against, values are represented as string, int64, bool, nil, map[string]interface{} and []interface{}
+type Context struct {
+	SubscriptionID    string
+	TenantID          string
+	ResourceGroupName string
+	Location          string
+	DeploymentName    string
+	// Parameters are the parameter values for the deployment, they are not evaluated
+	Parameters map[string]interface{}
+	// ParameterDefaults are the default values of the template parameters, used for parameters without a value, string defaults can be expressions
+	ParameterDefaults map[string]interface{}
+	// Variables are the template variables, string values and the strings in object and array values can be expressions
+	Variables map[string]interface{}
+	// ListKeys returns the result of listKeys for a resource, if it is not set a fake key is returned
+	ListKeys func(resourceID string, apiVersion string) (interface{}, error)
+	// Reference returns the result of reference for a resource, if it is not set reference cannot be evaluated
+	Reference func(resourceID string, apiVersion string, full bool) (interface{}, error)
+	// NewGUID returns the result of newGuid, if it is not set a fixed GUID is returned so that evaluation is repeatable
+	NewGUID func() string
+
+	variables  map[string]interface{}
+	evaluating map[string]bool
+}
+
+// EvaluateTemplateString evaluates a string value from a template, returning the string if it is not an expression
+func EvaluateTemplateString(s string, ctx *Context) (interface{}, error) {
+	node, err := ParseTemplateString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return Evaluate(node, ctx)
+}
+
+// EvaluateValue evaluates a template value, evaluating expressions in strings and in the values of objects and arrays
+func EvaluateValue(value interface{}, ctx *Context) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return EvaluateTemplateString(v, ctx)
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			evaluated, err := EvaluateValue(item, ctx)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, evaluated)
+		}
+		return result, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			evaluated, err := EvaluateValue(item, ctx)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = evaluated
+		}
+		return result, nil
+	default:
+		return normalize(v), nil
+	}
+}
+
+// Evaluate evaluates a parsed expression
+func Evaluate(node Node, ctx *Context) (interface{}, error) {
+	switch n := node.(type) {
+	case StringLiteral:
+		return n.Value, nil
+	case IntegerLiteral:
+		return n.Value, nil
+	case BoolLiteral:
+		return n.Value, nil
+	case NullLiteral:
+		return nil, nil
+	case PropertyAccess:
+		target, err := Evaluate(n.Target, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return getProperty(target, n.Property, n)
+	case IndexAccess:
+		target, err := Evaluate(n.Target, ctx)
+		if err != nil {
+			return nil, err
+		}
+		index, err := Evaluate(n.Index, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return getIndex(target, index, n)
+	case FunctionCall:
+		return evaluateFunction(n, ctx)
+	default:
+		return nil, fmt.Errorf("unsupported expression %s", node)
+	}
+}
+
+// evaluateFunction evaluates a function call, if is evaluated first as only the branch that is selected is evaluated
+func evaluateFunction(call FunctionCall, ctx *Context) (interface{}, error) {
+	name := strings.ToLower(call.Name)
+
+	if name == "if" {
+		if len(call.Arguments) != 3 {
+			return nil, fmt.Errorf("if expects 3 arguments: %s", call)
+		}
+		condition, err := Evaluate(call.Arguments[0], ctx)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := condition.(bool)
+		if !ok {
+			return nil, fmt.Errorf("the condition of if must be a bool: %s", call)
+		}
+		if b {
+			return Evaluate(call.Arguments[1], ctx)
+		}
+		return Evaluate(call.Arguments[2], ctx)
+	}
+
+	arguments := make([]interface{}, 0, len(call.Arguments))
+	for _, argument := range call.Arguments {
+		value, err := Evaluate(argument, ctx)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, value)
+	}
+
+	switch name {
+	case "parameters":
+		name, err := stringArgument(call, arguments, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		return ctx.parameter(name)
+	case "variables":
+		name, err := stringArgument(call, arguments, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		return ctx.variable(name)
+	case "concat":
+		return concat(call, arguments)
+	case "createarray":
+		return arguments, nil
+	case "contains":
+		if len(arguments) != 2 {
+			return nil, fmt.Errorf("contains expects 2 arguments: %s", call)
+		}
+		return contains(call, arguments[0], arguments[1])
+	case "equals":
+		if len(arguments) != 2 {
+			return nil, fmt.Errorf("equals expects 2 arguments: %s", call)
+		}
+		return reflect.DeepEqual(arguments[0], arguments[1]), nil
+	case "not":
+		if len(arguments) != 1 {
+			return nil, fmt.Errorf("not expects 1 argument: %s", call)
+		}
+		b, ok := arguments[0].(bool)
+		if !ok {
+			return nil, fmt.Errorf("the argument of not must be a bool: %s", call)
+		}
+		return !b, nil
+	case "string":
+		if len(arguments) != 1 {
+			return nil, fmt.Errorf("string expects 1 argument: %s", call)
+		}
+		return ToString(arguments[0])
+	case "int":
+		if len(arguments) != 1 {
+			return nil, fmt.Errorf("int expects 1 argument: %s", call)
+		}
+		return toInt(call, arguments[0])
+	case "bool":
+		if len(arguments) != 1 {
+			return nil, fmt.Errorf("bool expects 1 argument: %s", call)
+		}
+		return toBool(call, arguments[0])
+	case "json":
+		s, err := stringArgument(call, arguments, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(s), &value); err != nil {
+			return nil, fmt.Errorf("invalid JSON in %s: %s", call, err)
+		}
+		return normalize(value), nil
+	case "subscription":
+		return map[string]interface{}{
+			"id":             "/subscriptions/" + ctx.SubscriptionID,
+			"subscriptionId": ctx.SubscriptionID,
+			"tenantId":       ctx.TenantID,
+		}, nil
+	case "resourcegroup":
+		return map[string]interface{}{
+			"id":       fmt.Sprintf("/subscriptions/%s/resourceGroups/%s", ctx.SubscriptionID, ctx.ResourceGroupName),
+			"name":     ctx.ResourceGroupName,
+			"location": ctx.Location,
+		}, nil
+	case "deployment":
+		return map[string]interface{}{
+			"name": ctx.DeploymentName,
+		}, nil
+	case "resourceid":
+		return resourceID(call, arguments, ctx.SubscriptionID, ctx.ResourceGroupName, true)
+	case "subscriptionresourceid":
+		return resourceID(call, arguments, ctx.SubscriptionID, "", false)
+	case "uniquestring":
+		s, err := stringArguments(call, arguments)
+		if err != nil {
+			return nil, err
+		}
+		return uniqueString(s), nil
+	case "guid":
+		s, err := stringArguments(call, arguments)
+		if err != nil {
+			return nil, err
+		}
+		return guid(s), nil
+	case "newguid":
+		if ctx.NewGUID != nil {
+			return ctx.NewGUID(), nil
+		}
+		return "00000000-0000-0000-0000-000000000000", nil
+	case "listkeys":
+		id, err := stringArgument(call, arguments, 0, 2)
+		if err != nil {
+			return nil, err
+		}
+		apiVersion, _ := arguments[1].(string)
+		if ctx.ListKeys != nil {
+			return ctx.ListKeys(id, apiVersion)
+		}
+		return map[string]interface{}{
+			"keys": []interface{}{
+				map[string]interface{}{"keyName": "key1", "permissions": "FULL", "value": "key1-" + uniqueString([]string{id})},
+				map[string]interface{}{"keyName": "key2", "permissions": "FULL", "value": "key2-" + uniqueString([]string{id})},
+			},
+			// Log Analytics workspaces return shared keys instead
+			"primarySharedKey":   "primary-" + uniqueString([]string{id}),
+			"secondarySharedKey": "secondary-" + uniqueString([]string{id}),
+		}, nil
+	case "reference":
+		if len(arguments) < 1 || len(arguments) > 3 {
+			return nil, fmt.Errorf("reference expects 1 to 3 arguments: %s", call)
+		}
+		id, ok := arguments[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("the resource of reference must be a string: %s", call)
+		}
+		var apiVersion string
+		if len(arguments) > 1 {
+			apiVersion, _ = arguments[1].(string)
+		}
+		full := len(arguments) > 2 && reflect.DeepEqual(arguments[2], "Full")
+		if ctx.Reference == nil {
+			return nil, fmt.Errorf("reference to %s cannot be evaluated without a deployment: %s", id, call)
+		}
+		return ctx.Reference(id, apiVersion, full)
+	default:
+		return nil, fmt.Errorf("unsupported function %s: %s", call.Name, call)
+	}
+}
+
+// parameter gets the value of a parameter, or its default value if it does not have a value, parameter names are case insensitive
+func (ctx *Context) parameter(name string) (interface{}, error) {
+	if value, ok := lookup(ctx.Parameters, name); ok {
+		return normalize(value), nil
+	}
+
+	if value, ok := lookup(ctx.ParameterDefaults, name); ok {
+		return EvaluateValue(value, ctx)
+	}
+
+	return nil, fmt.Errorf("parameter %s does not have a value", name)
+}
+
+// variable gets the value of a variable, evaluating it the first time it is used, variable names are case insensitive
+func (ctx *Context) variable(name string) (interface{}, error) {
+	key := strings.ToLower(name)
+	if value, ok := ctx.variables[key]; ok {
+		return value, nil
+	}
+
+	raw, ok := lookup(ctx.Variables, name)
+	if !ok {
+		return nil, fmt.Errorf("variable %s is not defined", name)
+	}
+
+	if ctx.evaluating[key] {
+		return nil, fmt.Errorf("variable %s refers to itself", name)
+	}
+	if ctx.evaluating == nil {
+		ctx.evaluating = map[string]bool{}
+	}
+	ctx.evaluating[key] = true
+	defer delete(ctx.evaluating, key)
+
+	value, err := EvaluateValue(raw, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to evaluate variable %s: %s", name, err)
+	}
+
+	if ctx.variables == nil {
+		ctx.variables = map[string]interface{}{}
+	}
+	ctx.variables[key] = value
+
+	return value, nil
+}
+
+func lookup(values map[string]interface{}, name string) (interface{}, bool) {
+	if value, ok := values[name]; ok {
+		return value, true
+	}
+
+	for key, value := range values {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+// normalize converts numbers decoded from JSON to int64 when they are whole numbers, as ARM only has integers
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) {
+			return int64(v)
+		}
+		return v
+	case int:
+		return int64(v)
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			result = append(result, normalize(item))
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = normalize(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+func getProperty(target interface{}, property string, node Node) (interface{}, error) {
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unable to get property %s of a value that is not an object: %s", property, node)
+	}
+
+	// Property names are case insensitive, e.g. resourceGroup().Location
+	value, ok := lookup(object, property)
+	if !ok {
+		return nil, fmt.Errorf("property %s does not exist: %s", property, node)
+	}
+
+	return value, nil
+}
+
+func getIndex(target interface{}, index interface{}, node Node) (interface{}, error) {
+	switch t := target.(type) {
+	case []interface{}:
+		i, ok := index.(int64)
+		if !ok {
+			return nil, fmt.Errorf("array index must be an integer: %s", node)
+		}
+		if i < 0 || i >= int64(len(t)) {
+			return nil, fmt.Errorf("array index %d is out of range: %s", i, node)
+		}
+		return t[i], nil
+	case map[string]interface{}:
+		property, ok := index.(string)
+		if !ok {
+			return nil, fmt.Errorf("property name must be a string: %s", node)
+		}
+		return getProperty(t, property, node)
+	default:
+		return nil, fmt.Errorf("unable to index a value that is not an array or object: %s", node)
+	}
+}
+
+func stringArgument(call FunctionCall, arguments []interface{}, index int, count int) (string, error) {
+	if len(arguments) != count {
+		return "", fmt.Errorf("%s expects %d argument(s): %s", call.Name, count, call)
+	}
+
+	s, ok := arguments[index].(string)
+	if !ok {
+		return "", fmt.Errorf("argument %d of %s must be a string: %s", index+1, call.Name, call)
+	}
+
+	return s, nil
+}
+
+func stringArguments(call FunctionCall, arguments []interface{}) ([]string, error) {
+	if len(arguments) == 0 {
+		return nil, fmt.Errorf("%s expects at least 1 argument: %s", call.Name, call)
+	}
+
+	values := make([]string, 0, len(arguments))
+	for i, argument := range arguments {
+		s, ok := argument.(string)
+		if !ok {
+			return nil, fmt.Errorf("argument %d of %s must be a string: %s", i+1, call.Name, call)
+		}
+		values = append(values, s)
+	}
+
+	return values, nil
+}
+
+// concat concatenates strings, or arrays if the first argument is an array
+func concat(call FunctionCall, arguments []interface{}) (interface{}, error) {
+	if len(arguments) > 0 {
+		if _, ok := arguments[0].([]interface{}); ok {
+			var result []interface{}
+			for _, argument := range arguments {
+				array, ok := argument.([]interface{})
+				if !ok {
+					return nil, fmt.Errorf("concat arguments must all be arrays or all be strings: %s", call)
+				}
+				result = append(result, array...)
+			}
+			return result, nil
+		}
+	}
+
+	var result strings.Builder
+	for _, argument := range arguments {
+		switch a := argument.(type) {
+		case string:
+			result.WriteString(a)
+		case int64, bool:
+			s, _ := ToString(a)
+			result.WriteString(s)
+		default:
+			return nil, fmt.Errorf("concat arguments must all be arrays or all be strings: %s", call)
+		}
+	}
+
+	return result.String(), nil
+}
+
+// contains checks if a string contains a substring, an array contains a value or an object contains a property
+func contains(call FunctionCall, container interface{}, item interface{}) (interface{}, error) {
+	switch c := container.(type) {
+	case string:
+		s, err := ToString(item)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Contains(c, s), nil
+	case []interface{}:
+		for _, value := range c {
+			if reflect.DeepEqual(value, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("the property name in contains must be a string: %s", call)
+		}
+		_, found := lookup(c, s)
+		return found, nil
+	default:
+		return nil, fmt.Errorf("contains expects a string, array or object: %s", call)
+	}
+}
+
+// ToString converts a value to a string the way the ARM string function does, bools become True or False and objects and arrays become JSON
+func ToString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case bool:
+		if v {
+			return "True", nil
+		}
+		return "False", nil
+	case nil:
+		return "", nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
+
+func toInt(call FunctionCall, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert '%s' to an integer: %s", v, call)
+		}
+		return i, nil
+	default:
+		return nil, fmt.Errorf("unable to convert %v to an integer: %s", v, call)
+	}
+}
+
+func toBool(call FunctionCall, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case int64:
+		return v != 0, nil
+	case string:
+		switch strings.ToLower(v) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unable to convert %v to a bool: %s", value, call)
+}
+
+// resourceID builds the id of a resource from its type and names, the subscription and resource group can be specified before the type, which is the first argument that contains a /
+func resourceID(call FunctionCall, arguments []interface{}, subscriptionID string, resourceGroupName string, resourceGroupScope bool) (interface{}, error) {
+	values, err := stringArguments(call, arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	typeIndex := -1
+	for i, value := range values {
+		if strings.Contains(value, "/") {
+			typeIndex = i
+			break
+		}
+	}
+	if typeIndex < 0 {
+		return nil, fmt.Errorf("%s expects a resource type: %s", call.Name, call)
+	}
+
+	scope := values[:typeIndex]
+	maxScope := 1
+	if resourceGroupScope {
+		maxScope = 2
+	}
+	if len(scope) > maxScope {
+		return nil, fmt.Errorf("%s has too many arguments before the resource type: %s", call.Name, call)
+	}
+	if len(scope) == maxScope {
+		subscriptionID = scope[0]
+	}
+	if resourceGroupScope && len(scope) > 0 {
+		resourceGroupName = scope[len(scope)-1]
+	}
+
+	types := strings.Split(values[typeIndex], "/")
+	names := values[typeIndex+1:]
+	if len(names) != len(types)-1 {
+		return nil, fmt.Errorf("%s expects %d resource name(s) for type %s: %s", call.Name, len(types)-1, values[typeIndex], call)
+	}
+
+	id := "/subscriptions/" + subscriptionID
+	if resourceGroupScope {
+		id += "/resourceGroups/" + resourceGroupName
+	}
+	id += "/providers/" + types[0]
+	for i, name := range names {
+		id += "/" + types[i+1] + "/" + name
+	}
+
+	return id, nil
+}
+
+// uniqueString returns a deterministic 13 character hash of the values, it is not the same hash that Azure uses
+func uniqueString(values []string) string {
+	hash := sha256.Sum256([]byte(strings.Join(values, "-")))
+	return strings.ToLower(base32.StdEncoding.EncodeToString(hash[:]))[:13]
+}
+
+// guid returns a deterministic GUID for the values, it is not the same GUID that Azure returns
+func guid(values []string) string {
+	hash := sha1.Sum([]byte(strings.Join(values, "-")))
+	hash[6] = (hash[6] & 0x0f) | 0x50
+	hash[8] = (hash[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", hash[0:4], hash[4:6], hash[6:8], hash[8:10], hash[10:16])
+}
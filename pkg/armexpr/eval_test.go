@@ -0,0 +1,140 @@
+package armexpr
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func testContext() *Context {
+	return &Context{
+		SubscriptionID:    "11111111-1111-1111-1111-111111111111",
+		TenantID:          "22222222-2222-2222-2222-222222222222",
+		ResourceGroupName: "test-rg",
+		Location:          "westeurope",
+		Parameters: map[string]interface{}{
+			"cnab_action": "install",
+			"port":        float64(8080),
+			"debug":       true,
+		},
+		ParameterDefaults: map[string]interface{}{
+			"location":           "[resourceGroup().Location]",
+			"containerGroupName": "[concat('cg-',uniqueString(resourceGroup().id, newGuid()))]",
+		},
+		Variables: map[string]interface{}{
+			"cnab_action":                            "[parameters('cnab_action')]",
+			"cnab_stateful_action":                   "[not(contains(createArray('dry-run'), variables('cnab_action')))]",
+			"cnab_azure_state_storage_account_name":  "[concat('cnabstate',uniqueString(resourceGroup().id))]",
+			"containerGroupName":                     "[parameters('containerGroupName')]",
+			"cnab_azure_state_storage_connection_id": "[resourceId('Microsoft.Storage/storageAccounts', variables('cnab_azure_state_storage_account_name'))]",
+			"self":                                   "[variables('self')]",
+		},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   interface{}
+	}{
+		{"[parameters('cnab_action')]", "install"},
+		{"[parameters('PORT')]", int64(8080)},
+		{"[string(parameters('debug'))]", "True"},
+		{"[string(parameters('port'))]", "8080"},
+		{"[parameters('location')]", "westeurope"},
+		{"[variables('cnab_stateful_action')]", true},
+		{"[if(variables('cnab_stateful_action'), 'stateful', reference('missing').outputs)]", "stateful"},
+		{"[subscription().tenantId]", "22222222-2222-2222-2222-222222222222"},
+		{"[resourceGroup().id]", "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/test-rg"},
+		{
+			"[resourceId('Microsoft.Storage/storageAccounts/fileServices/shares', 'account', 'default', 'share')]",
+			"/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/test-rg/providers/Microsoft.Storage/storageAccounts/account/fileServices/default/shares/share",
+		},
+		{
+			"[subscriptionResourceId('Microsoft.Authorization/roleDefinitions', 'b24988ac-6180-42a0-ab88-20f7382dd24c')]",
+			"/subscriptions/11111111-1111-1111-1111-111111111111/providers/Microsoft.Authorization/roleDefinitions/b24988ac-6180-42a0-ab88-20f7382dd24c",
+		},
+		{"[json('{\"a\": [1, 2]}').a[1]]", int64(2)},
+		{"[contains(json('{\"Name\": 1}'), 'name')]", true},
+		{"[int('42')]", int64(42)},
+		{"[bool('False')]", false},
+		{"[[not an expression]", "[not an expression]"},
+	}
+
+	for _, test := range tests {
+		value, err := EvaluateTemplateString(test.expression, testContext())
+		assert.NilError(t, err, test.expression)
+		assert.DeepEqual(t, value, test.expected)
+	}
+}
+
+func TestEvaluateIsRepeatable(t *testing.T) {
+	ctx := testContext()
+
+	name, err := EvaluateTemplateString("[variables('cnab_azure_state_storage_account_name')]", ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, len(name.(string)), len("cnabstate")+13)
+
+	again, err := EvaluateTemplateString("[concat('cnabstate',uniqueString(resourceGroup().id))]", testContext())
+	assert.NilError(t, err)
+	assert.Equal(t, again, name)
+
+	id, err := EvaluateTemplateString("[guid(resourceGroup().id, 'a')]", ctx)
+	assert.NilError(t, err)
+	assert.Assert(t, id != "")
+
+	other, err := EvaluateTemplateString("[guid(resourceGroup().id, 'b')]", ctx)
+	assert.NilError(t, err)
+	assert.Assert(t, id != other)
+}
+
+func TestEvaluateListKeys(t *testing.T) {
+	ctx := testContext()
+
+	value, err := EvaluateTemplateString("[listKeys(variables('cnab_azure_state_storage_connection_id'), '2019-04-01').keys[0].value]", ctx)
+	assert.NilError(t, err)
+	assert.Assert(t, value != "")
+
+	ctx = testContext()
+	ctx.ListKeys = func(resourceID string, apiVersion string) (interface{}, error) {
+		return map[string]interface{}{"keys": []interface{}{map[string]interface{}{"value": resourceID + "@" + apiVersion}}}, nil
+	}
+
+	value, err = EvaluateTemplateString("[listKeys(resourceId('Microsoft.Storage/storageAccounts', 'account'), '2019-04-01').keys[0].value]", ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, value, "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/test-rg/providers/Microsoft.Storage/storageAccounts/account@2019-04-01")
+}
+
+func TestEvaluateValue(t *testing.T) {
+	value, err := EvaluateValue(map[string]interface{}{
+		"name":  "[variables('cnab_action')]",
+		"ports": []interface{}{"[parameters('port')]", float64(443)},
+	}, testContext())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, value, map[string]interface{}{
+		"name":  "install",
+		"ports": []interface{}{int64(8080), int64(443)},
+	})
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"[parameters('missing')]", "parameter missing does not have a value"},
+		{"[variables('missing')]", "variable missing is not defined"},
+		{"[variables('self')]", "variable self refers to itself"},
+		{"[reference('storage').outputs]", "cannot be evaluated without a deployment"},
+		{"[utcNow()]", "unsupported function utcNow"},
+		{"[resourceGroup().missing]", "property missing does not exist"},
+		{"[createArray('a')[1]]", "array index 1 is out of range"},
+		{"[resourceId('Microsoft.Storage/storageAccounts')]", "expects 1 resource name(s)"},
+		{"[not('true')]", "the argument of not must be a bool"},
+	}
+
+	for _, test := range tests {
+		_, err := EvaluateTemplateString(test.expression, testContext())
+		assert.ErrorContains(t, err, test.expected, test.expression)
+	}
+}
@@ -0,0 +1,257 @@
+package armexpr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenString
+	tokenInteger
+	tokenIdentifier
+	tokenPunctuation
+)
+
+type token struct {
+	kind     tokenKind
+	value    string
+	position int
+}
+
+type parser struct {
+	expression string
+	tokens     []token
+	position   int
+}
+
+// IsExpression checks if a template string is an expression, i.e. it is enclosed in square brackets and is not escaped with [[
+func IsExpression(s string) bool {
+	return strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") && !strings.HasPrefix(s, "[[")
+}
+
+// ParseTemplateString parses a string value from a template, returning a StringLiteral if the value is not an expression
+func ParseTemplateString(s string) (Node, error) {
+	if !IsExpression(s) {
+		// A leading [[ escapes the [ in a literal value
+		if strings.HasPrefix(s, "[[") {
+			s = s[1:]
+		}
+		return StringLiteral{Value: s}, nil
+	}
+
+	return Parse(s[1 : len(s)-1])
+}
+
+// Parse parses an ARM template expression, without the enclosing square brackets
+func Parse(expression string) (Node, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{
+		expression: expression,
+		tokens:     tokens,
+	}
+
+	node, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, p.errorf(next, "unexpected '%s'", next.value)
+	}
+
+	return node, nil
+}
+
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'':
+			start := i
+			var value strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated string starting at position %d in expression: %s", start, expression)
+				}
+				if runes[i] == '\'' {
+					// Single quotes are escaped by doubling them
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						value.WriteRune('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				value.WriteRune(runes[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenString, value: value.String(), position: start})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenInteger, value: string(runes[start:i]), position: start})
+		case unicode.IsLetter(r) || r == '_' || r == '$':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '$') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdentifier, value: string(runes[start:i]), position: start})
+		case strings.ContainsRune("(),.[]", r):
+			tokens = append(tokens, token{kind: tokenPunctuation, value: string(r), position: i})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character '%c' at position %d in expression: %s", r, i, expression)
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, position: len(runes)})
+
+	return tokens, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.position]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.position]
+	if t.kind != tokenEOF {
+		p.position++
+	}
+	return t
+}
+
+func (p *parser) expect(punctuation string) error {
+	t := p.next()
+	if t.kind != tokenPunctuation || t.value != punctuation {
+		if t.kind == tokenEOF {
+			return p.errorf(t, "expected '%s' but reached the end of the expression", punctuation)
+		}
+		return p.errorf(t, "expected '%s' but found '%s'", punctuation, t.value)
+	}
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return fmt.Errorf("%s at position %d in expression: %s", fmt.Sprintf(format, args...), t.position, p.expression)
+}
+
+func (p *parser) parseExpression() (Node, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if t.kind != tokenPunctuation {
+			return node, nil
+		}
+
+		switch t.value {
+		case ".":
+			p.next()
+			property := p.next()
+			if property.kind != tokenIdentifier {
+				return nil, p.errorf(property, "expected a property name")
+			}
+			node = PropertyAccess{Target: node, Property: property.value}
+		case "[":
+			p.next()
+			index, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			node = IndexAccess{Target: node, Index: index}
+		default:
+			return node, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenString:
+		return StringLiteral{Value: t.value}, nil
+	case tokenInteger:
+		value, err := strconv.ParseInt(t.value, 10, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid integer '%s'", t.value)
+		}
+		return IntegerLiteral{Value: value}, nil
+	case tokenIdentifier:
+		if next := p.peek(); next.kind != tokenPunctuation || next.value != "(" {
+			switch strings.ToLower(t.value) {
+			case "true":
+				return BoolLiteral{Value: true}, nil
+			case "false":
+				return BoolLiteral{Value: false}, nil
+			case "null":
+				return NullLiteral{}, nil
+			}
+			return nil, p.errorf(t, "expected '(' after function name '%s'", t.value)
+		}
+		return p.parseArguments(t.value)
+	case tokenEOF:
+		return nil, p.errorf(t, "unexpected end of expression")
+	default:
+		return nil, p.errorf(t, "unexpected '%s'", t.value)
+	}
+}
+
+func (p *parser) parseArguments(name string) (Node, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	call := FunctionCall{Name: name, Arguments: []Node{}}
+
+	if t := p.peek(); t.kind == tokenPunctuation && t.value == ")" {
+		p.next()
+		return call, nil
+	}
+
+	for {
+		argument, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		call.Arguments = append(call.Arguments, argument)
+
+		t := p.next()
+		if t.kind == tokenPunctuation && t.value == ")" {
+			return call, nil
+		}
+		if t.kind != tokenPunctuation || t.value != "," {
+			if t.kind == tokenEOF {
+				return nil, p.errorf(t, "expected ')' but reached the end of the expression")
+			}
+			return nil, p.errorf(t, "expected ',' or ')' but found '%s'", t.value)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package armexpr
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   Node
+	}{
+		{
+			"parameters('cnab_action')",
+			FunctionCall{Name: "parameters", Arguments: []Node{StringLiteral{Value: "cnab_action"}}},
+		},
+		{
+			"resourceGroup().Location",
+			PropertyAccess{Target: FunctionCall{Name: "resourceGroup", Arguments: []Node{}}, Property: "Location"},
+		},
+		{
+			"listKeys(resourceId('Microsoft.Storage/storageAccounts', 'foo'), '2019-04-01').keys[0].value",
+			PropertyAccess{
+				Target: IndexAccess{
+					Target: PropertyAccess{
+						Target: FunctionCall{Name: "listKeys", Arguments: []Node{
+							FunctionCall{Name: "resourceId", Arguments: []Node{StringLiteral{Value: "Microsoft.Storage/storageAccounts"}, StringLiteral{Value: "foo"}}},
+							StringLiteral{Value: "2019-04-01"},
+						}},
+						Property: "keys",
+					},
+					Index: IntegerLiteral{Value: 0},
+				},
+				Property: "value",
+			},
+		},
+		{
+			"concat('it''s', -1, true)",
+			FunctionCall{Name: "concat", Arguments: []Node{StringLiteral{Value: "it's"}, IntegerLiteral{Value: -1}, BoolLiteral{Value: true}}},
+		},
+	}
+
+	for _, test := range tests {
+		node, err := Parse(test.expression)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, node, test.expected)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"concat('a'", "expected ')' but reached the end of the expression"},
+		{"concat('a)", "unterminated string"},
+		{"parameters", "expected '('"},
+		{"concat('a') 'b'", "unexpected 'b'"},
+		{"concat('a' 'b')", "expected ',' or ')'"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.expression)
+		assert.ErrorContains(t, err, test.expected)
+	}
+}
+
+func TestParseTemplateString(t *testing.T) {
+	node, err := ParseTemplateString("[[not an expression]")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, node, StringLiteral{Value: "[not an expression]"})
+
+	node, err = ParseTemplateString("plain")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, node, StringLiteral{Value: "plain"})
+
+	node, err = ParseTemplateString("[variables('containerName')]")
+	assert.NilError(t, err)
+	assert.Equal(t, node.String(), "variables('containerName')")
+}
+
+func TestReferences(t *testing.T) {
+	node, err := Parse("if(contains(createArray('install'), variables('cnab_action')), string(parameters('port')), parameters('default')[0].value)")
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, References(node, "parameters"), []string{"port", "default"})
+	assert.DeepEqual(t, References(node, "variables"), []string{"cnab_action"})
+}
@@ -0,0 +1,523 @@
+package bicep
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/armexpr"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/template"
+)
+
+const indentation = "  "
+
+var identifierRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+var invalidIdentifierCharsRegex = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// renderer converts a template into Bicep, tracking the identifiers used for parameters, variables and resources
+type renderer struct {
+	parameters map[string]string
+	variables  map[string]string
+	resources  []string
+}
+
+// Render converts the generated template into a Bicep file
+func Render(generatedTemplate template.Template) ([]byte, error) {
+	r := renderer{
+		parameters: map[string]string{},
+		variables:  map[string]string{},
+	}
+
+	parameterNames := sortedKeys(generatedTemplate.Parameters)
+	for _, name := range parameterNames {
+		if !identifierRegex.MatchString(name) {
+			return nil, fmt.Errorf("Parameter name %s is not a valid Bicep identifier", name)
+		}
+		r.parameters[name] = name
+	}
+
+	// Parameters and variables share a namespace in Bicep, so variables that clash are renamed in the same way as bicep decompile
+	variableNames := sortedKeys(generatedTemplate.Variables)
+	for _, name := range variableNames {
+		if !identifierRegex.MatchString(name) {
+			return nil, fmt.Errorf("Variable name %s is not a valid Bicep identifier", name)
+		}
+		identifier := name
+		if _, ok := r.parameters[name]; ok {
+			identifier = name + "_var"
+		}
+		r.variables[name] = identifier
+	}
+
+	r.resources = resourceIdentifiers(generatedTemplate.Resources)
+
+	var buffer bytes.Buffer
+
+	for _, name := range parameterNames {
+		if err := r.writeParameter(&buffer, name, generatedTemplate.Parameters[name]); err != nil {
+			return nil, fmt.Errorf("Unable to convert parameter %s to Bicep: %s", name, err)
+		}
+	}
+
+	for _, name := range variableNames {
+		value, err := r.convertValue(generatedTemplate.Variables[name], "")
+		if err != nil {
+			return nil, fmt.Errorf("Unable to convert variable %s to Bicep: %s", name, err)
+		}
+		fmt.Fprintf(&buffer, "var %s = %s\n", r.variables[name], value)
+	}
+
+	for i, resource := range generatedTemplate.Resources {
+		buffer.WriteString("\n")
+		if err := r.writeResource(&buffer, r.resources[i], resource, generatedTemplate.Resources); err != nil {
+			return nil, fmt.Errorf("Unable to convert resource %s to Bicep: %s", resource.Name, err)
+		}
+	}
+
+	outputs, err := toOrderedValue(generatedTemplate.Outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	if outputMembers, ok := outputs.(orderedObject); ok && len(outputMembers) > 0 {
+		buffer.WriteString("\n")
+		for _, output := range outputMembers {
+			definition, ok := output.value.(orderedObject)
+			if !ok {
+				return nil, fmt.Errorf("Unable to convert output %s to Bicep: output is not an object", output.key)
+			}
+
+			outputType, _ := definition.get("type").(string)
+			value, err := r.convertValue(definition.get("value"), "")
+			if err != nil {
+				return nil, fmt.Errorf("Unable to convert output %s to Bicep: %s", output.key, err)
+			}
+
+			fmt.Fprintf(&buffer, "output %s %s = %s\n", toIdentifier(output.key), toBicepType(outputType), value)
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func (r *renderer) writeParameter(buffer *bytes.Buffer, name string, parameter template.Parameter) error {
+	if parameter.Metadata != nil && parameter.Metadata.Description != "" {
+		fmt.Fprintf(buffer, "@description(%s)\n", quote(parameter.Metadata.Description))
+	}
+
+	if parameter.AllowedValues != nil {
+		allowedValues, err := r.convertValue(parameter.AllowedValues, "")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buffer, "@allowed(%s)\n", allowedValues)
+	}
+
+	if parameter.MinValue != nil {
+		fmt.Fprintf(buffer, "@minValue(%d)\n", *parameter.MinValue)
+	}
+
+	if parameter.MaxValue != nil {
+		fmt.Fprintf(buffer, "@maxValue(%d)\n", *parameter.MaxValue)
+	}
+
+	if parameter.MinLength != nil {
+		fmt.Fprintf(buffer, "@minLength(%d)\n", *parameter.MinLength)
+	}
+
+	if parameter.MaxLength != nil {
+		fmt.Fprintf(buffer, "@maxLength(%d)\n", *parameter.MaxLength)
+	}
+
+	if strings.HasPrefix(strings.ToLower(parameter.Type), "secure") {
+		buffer.WriteString("@secure()\n")
+	}
+
+	fmt.Fprintf(buffer, "param %s %s", r.parameters[name], toBicepType(parameter.Type))
+
+	if parameter.DefaultValue != nil {
+		defaultValue, err := r.convertValue(parameter.DefaultValue, "")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buffer, " = %s", defaultValue)
+	}
+
+	buffer.WriteString("\n\n")
+
+	return nil
+}
+
+func (r *renderer) writeResource(buffer *bytes.Buffer, identifier string, resource template.Resource, resources []template.Resource) error {
+	body := orderedObject{}
+
+	name, err := r.convertValue(resource.Name, indentation)
+	if err != nil {
+		return err
+	}
+	body = append(body, member{key: "name", value: rawValue(name)})
+
+	if resource.Location != "" {
+		body = append(body, member{key: "location", value: resource.Location})
+	}
+
+	if resource.Sku != nil {
+		body = append(body, member{key: "sku", value: resource.Sku})
+	}
+
+	if resource.Kind != "" {
+		body = append(body, member{key: "kind", value: resource.Kind})
+	}
+
+	if resource.Identity != nil {
+		body = append(body, member{key: "identity", value: resource.Identity})
+	}
+
+	if resource.Properties != nil {
+		body = append(body, member{key: "properties", value: resource.Properties})
+	}
+
+	// Bicep dependencies are expressed using the symbolic names of the resources
+	var dependsOn []string
+	for _, dependency := range resource.DependsOn {
+		if dependencyIdentifier, ok := r.findDependency(dependency, resources); ok {
+			dependsOn = append(dependsOn, dependencyIdentifier)
+		}
+	}
+
+	condition := ""
+	if resource.Condition != "" {
+		value, err := r.convertValue(resource.Condition, "")
+		if err != nil {
+			return err
+		}
+		condition = fmt.Sprintf("if (%s) ", value)
+	}
+
+	fmt.Fprintf(buffer, "resource %s '%s@%s' = %s{\n", identifier, resource.Type, resource.APIVersion, condition)
+
+	for _, m := range body {
+		value, err := r.convertValue(m.value, indentation)
+		if err != nil {
+			return fmt.Errorf("%s: %s", m.key, err)
+		}
+		fmt.Fprintf(buffer, "%s%s: %s\n", indentation, toPropertyName(m.key), value)
+	}
+
+	if len(dependsOn) > 0 {
+		fmt.Fprintf(buffer, "%sdependsOn: [\n", indentation)
+		for _, dependency := range dependsOn {
+			fmt.Fprintf(buffer, "%s%s%s\n", indentation, indentation, dependency)
+		}
+		fmt.Fprintf(buffer, "%s]\n", indentation)
+	}
+
+	buffer.WriteString("}\n")
+
+	return nil
+}
+
+// findDependency finds the symbolic name of a resource referenced by name or by a resourceId() expression in dependsOn
+func (r *renderer) findDependency(dependency string, resources []template.Resource) (string, bool) {
+	for i, resource := range resources {
+		if resource.Name == dependency {
+			return r.resources[i], true
+		}
+	}
+
+	node, err := armexpr.ParseTemplateString(dependency)
+	if err != nil {
+		return "", false
+	}
+
+	if call, ok := armexpr.IsFunction(node, "resourceId"); ok && len(call.Arguments) > 0 {
+		if resourceType, ok := call.Arguments[0].(armexpr.StringLiteral); ok {
+			for i, resource := range resources {
+				if strings.EqualFold(resource.Type, resourceType.Value) {
+					return r.resources[i], true
+				}
+			}
+		}
+	}
+
+	return "", false
+}
+
+// resourceIdentifiers creates symbolic names for resources based on the resource type
+func resourceIdentifiers(resources []template.Resource) []string {
+	identifiers := make([]string, 0, len(resources))
+	used := map[string]int{}
+
+	for _, resource := range resources {
+		segments := strings.Split(resource.Type, "/")
+		identifier := toIdentifier(segments[len(segments)-1])
+		if used[identifier] > 0 {
+			identifier = fmt.Sprintf("%s%d", identifier, used[identifier]+1)
+		}
+		used[identifier]++
+		identifiers = append(identifiers, identifier)
+	}
+
+	return identifiers
+}
+
+// convertValue converts a template value to Bicep, strings are converted from ARM expressions to Bicep expressions
+func (r *renderer) convertValue(value interface{}, indent string) (string, error) {
+	if raw, ok := value.(rawValue); ok {
+		return string(raw), nil
+	}
+
+	ordered, err := toOrderedValue(value)
+	if err != nil {
+		return "", err
+	}
+
+	switch v := ordered.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		return fmt.Sprintf("%t", v), nil
+	case json.Number:
+		return v.String(), nil
+	case string:
+		node, err := armexpr.ParseTemplateString(v)
+		if err != nil {
+			return "", err
+		}
+		return r.convertExpression(node)
+	case []interface{}:
+		if len(v) == 0 {
+			return "[]", nil
+		}
+		var s strings.Builder
+		s.WriteString("[\n")
+		for _, item := range v {
+			converted, err := r.convertValue(item, indent+indentation)
+			if err != nil {
+				return "", err
+			}
+			s.WriteString(indent + indentation + converted + "\n")
+		}
+		s.WriteString(indent + "]")
+		return s.String(), nil
+	case orderedObject:
+		if len(v) == 0 {
+			return "{}", nil
+		}
+		var s strings.Builder
+		s.WriteString("{\n")
+		for _, m := range v {
+			converted, err := r.convertValue(m.value, indent+indentation)
+			if err != nil {
+				return "", err
+			}
+			key, err := r.convertPropertyName(m.key)
+			if err != nil {
+				return "", err
+			}
+			s.WriteString(indent + indentation + key + ": " + converted + "\n")
+		}
+		s.WriteString(indent + "}")
+		return s.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// convertExpression converts an ARM template expression to the equivalent Bicep expression
+func (r *renderer) convertExpression(node armexpr.Node) (string, error) {
+	switch n := node.(type) {
+	case armexpr.StringLiteral:
+		return quote(n.Value), nil
+	case armexpr.IntegerLiteral, armexpr.BoolLiteral, armexpr.NullLiteral:
+		return n.String(), nil
+	case armexpr.PropertyAccess:
+		target, err := r.convertExpression(n.Target)
+		if err != nil {
+			return "", err
+		}
+		property := n.Property
+		// Bicep property names are case sensitive for the deployment functions
+		if _, ok := armexpr.IsFunction(n.Target, "resourceGroup"); ok && strings.EqualFold(property, "location") {
+			property = "location"
+		}
+		return target + "." + property, nil
+	case armexpr.IndexAccess:
+		target, err := r.convertExpression(n.Target)
+		if err != nil {
+			return "", err
+		}
+		index, err := r.convertExpression(n.Index)
+		if err != nil {
+			return "", err
+		}
+		return target + "[" + index + "]", nil
+	case armexpr.FunctionCall:
+		return r.convertFunction(n)
+	default:
+		return "", fmt.Errorf("unsupported expression %s", node)
+	}
+}
+
+func (r *renderer) convertFunction(call armexpr.FunctionCall) (string, error) {
+	if name, ok := armexpr.Reference(call, "parameters"); ok {
+		identifier, ok := r.parameters[name]
+		if !ok {
+			return "", fmt.Errorf("reference to undefined parameter %s", name)
+		}
+		return identifier, nil
+	}
+
+	if name, ok := armexpr.Reference(call, "variables"); ok {
+		identifier, ok := r.variables[name]
+		if !ok {
+			return "", fmt.Errorf("reference to undefined variable %s", name)
+		}
+		return identifier, nil
+	}
+
+	arguments := make([]string, 0, len(call.Arguments))
+	for _, argument := range call.Arguments {
+		converted, err := r.convertExpression(argument)
+		if err != nil {
+			return "", err
+		}
+		arguments = append(arguments, converted)
+	}
+
+	switch strings.ToLower(call.Name) {
+	case "concat":
+		return r.convertConcat(call)
+	case "if":
+		if len(arguments) != 3 {
+			return "", fmt.Errorf("if requires 3 arguments")
+		}
+		return fmt.Sprintf("(%s ? %s : %s)", arguments[0], arguments[1], arguments[2]), nil
+	case "not":
+		if len(arguments) != 1 {
+			return "", fmt.Errorf("not requires 1 argument")
+		}
+		return "!" + arguments[0], nil
+	case "equals":
+		if len(arguments) != 2 {
+			return "", fmt.Errorf("equals requires 2 arguments")
+		}
+		return fmt.Sprintf("(%s == %s)", arguments[0], arguments[1]), nil
+	case "and":
+		return "(" + strings.Join(arguments, " && ") + ")", nil
+	case "or":
+		return "(" + strings.Join(arguments, " || ") + ")", nil
+	case "createarray":
+		return "[" + strings.Join(arguments, ", ") + "]", nil
+	case "true", "false":
+		return strings.ToLower(call.Name), nil
+	}
+
+	return call.Name + "(" + strings.Join(arguments, ", ") + ")", nil
+}
+
+// convertConcat converts concat of strings into Bicep string interpolation
+func (r *renderer) convertConcat(call armexpr.FunctionCall) (string, error) {
+	var s strings.Builder
+	s.WriteString("'")
+
+	for _, argument := range call.Arguments {
+		if literal, ok := argument.(armexpr.StringLiteral); ok {
+			s.WriteString(escape(literal.Value))
+			continue
+		}
+
+		converted, err := r.convertExpression(argument)
+		if err != nil {
+			return "", err
+		}
+		s.WriteString("${" + converted + "}")
+	}
+
+	s.WriteString("'")
+
+	return s.String(), nil
+}
+
+func toBicepType(armType string) string {
+	switch strings.ToLower(armType) {
+	case "securestring":
+		return "string"
+	case "secureobject":
+		return "object"
+	default:
+		return strings.ToLower(armType)
+	}
+}
+
+// toIdentifier converts a name into a valid Bicep identifier, replacing invalid characters with _
+func toIdentifier(name string) string {
+	identifier := invalidIdentifierCharsRegex.ReplaceAllString(name, "_")
+	if identifier == "" || (identifier[0] >= '0' && identifier[0] <= '9') {
+		identifier = "_" + identifier
+	}
+	return identifier
+}
+
+// convertPropertyName converts a property name to Bicep, property names that are ARM expressions become interpolated strings
+func (r *renderer) convertPropertyName(name string) (string, error) {
+	if !armexpr.IsExpression(name) {
+		return toPropertyName(name), nil
+	}
+
+	node, err := armexpr.ParseTemplateString(name)
+	if err != nil {
+		return "", err
+	}
+
+	if literal, ok := node.(armexpr.StringLiteral); ok {
+		return toPropertyName(literal.Value), nil
+	}
+
+	value, err := r.convertExpression(node)
+	if err != nil {
+		return "", err
+	}
+
+	return "'${" + value + "}'", nil
+}
+
+func toPropertyName(name string) string {
+	if identifierRegex.MatchString(name) {
+		return name
+	}
+	return quote(name)
+}
+
+func quote(s string) string {
+	return "'" + escape(s) + "'"
+}
+
+func escape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	s = strings.ReplaceAll(s, "\r", `\r`)
+	s = strings.ReplaceAll(s, "\t", `\t`)
+	s = strings.ReplaceAll(s, "${", `\${`)
+	return s
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch v := m.(type) {
+	case map[string]template.Parameter:
+		for key := range v {
+			keys = append(keys, key)
+		}
+	case map[string]string:
+		for key := range v {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,115 @@
+package bicep
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// member is a property of a JSON object
+type member struct {
+	key   string
+	value interface{}
+}
+
+// orderedObject is a JSON object that keeps the order of its properties, so the Bicep output follows the template model
+type orderedObject []member
+
+// rawValue is a value that has already been converted to Bicep
+type rawValue string
+
+func (o orderedObject) get(key string) interface{} {
+	for _, m := range o {
+		if m.key == key {
+			return m.value
+		}
+	}
+	return nil
+}
+
+// toOrderedValue converts a value to its JSON representation, decoding objects as orderedObject and dropping null properties
+func toOrderedValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, bool, string, json.Number, rawValue:
+		return v, nil
+	case orderedObject:
+		result := orderedObject{}
+		for _, m := range v {
+			converted, err := toOrderedValue(m.value)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, member{key: m.key, value: converted})
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			converted, err := toOrderedValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, converted)
+		}
+		return result, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to convert value to JSON: %s", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	return decodeOrdered(decoder)
+}
+
+func decodeOrdered(decoder *json.Decoder) (interface{}, error) {
+	t, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delimiter, ok := t.(json.Delim)
+	if !ok {
+		return t, nil
+	}
+
+	switch delimiter {
+	case '{':
+		object := orderedObject{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				object = append(object, member{key: key.(string), value: value})
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return object, nil
+	case '[':
+		array := []interface{}{}
+		for decoder.More() {
+			value, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return array, nil
+	}
+
+	return nil, fmt.Errorf("Unexpected JSON delimiter %s", delimiter)
+}
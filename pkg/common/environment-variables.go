@@ -6,6 +6,7 @@ type EnvironmentVariableNames struct {
 	CnabCredentialPrefix                      string
 	CnabCredentialFilePrefix                  string
 	CnabAction                                string
+	CnabActionStateless                       string
 	CnabInstallationName                      string
 	CnabBundleName                            string
 	CnabBundleTag                             string
@@ -14,10 +15,27 @@ type EnvironmentVariableNames struct {
 	CnabAzureClientSecret                     string
 	CnabAzureSubscriptionID                   string
 	CnabAzureTenantID                         string
+	CnabAzureMsiType                          string
+	CnabAzureUserMsiResourceID                string
+	CnabAzureResourceGroup                    string
 	CnabAzureStateStorageAccountName          string
 	CnabAzureStateStorageAccountKey           string
 	CnabAzureStateStorageAccountResourceGroup string
 	CnabAzureStateFileshare                   string
+	CnabOutputsBlob                           string
+	CnabRunner                                string
+	CnabConfigFile                            string
+	CnabLogFormat                             string
+	CnabLogSinkURL                            string
+	CnabLogAnalyticsWorkspaceID               string
+	CnabLogAnalyticsKey                       string
+	AzureStorageConnectionString              string
+	CnabNameMap                               string
+	CnabKeyVaultName                          string
+	CnabKeyVaultClientID                      string
+	CnabKeyVaultParameterPrefix               string
+	CnabKeyVaultCredentialPrefix              string
+	CnabKeyVaultCredentialFilePrefix          string
 	Verbose                                   string
 }
 
@@ -28,6 +46,7 @@ func GetEnvironmentVariableNames() EnvironmentVariableNames {
 		CnabCredentialPrefix:                      "CNAB_CRED_",
 		CnabCredentialFilePrefix:                  "CNAB_CRED_FILE_",
 		CnabAction:                                "CNAB_ACTION",
+		CnabActionStateless:                       "CNAB_ACTION_STATELESS",
 		CnabInstallationName:                      "CNAB_INSTALLATION_NAME",
 		CnabBundleName:                            "CNAB_BUNDLE_NAME",
 		CnabBundleTag:                             "CNAB_BUNDLE_TAG",
@@ -36,10 +55,27 @@ func GetEnvironmentVariableNames() EnvironmentVariableNames {
 		CnabAzureClientSecret:                     "CNAB_AZURE_CLIENT_SECRET",
 		CnabAzureSubscriptionID:                   "CNAB_AZURE_SUBSCRIPTION_ID",
 		CnabAzureTenantID:                         "CNAB_AZURE_TENANT_ID",
+		CnabAzureMsiType:                          "CNAB_AZURE_MSI_TYPE",
+		CnabAzureUserMsiResourceID:                "CNAB_AZURE_USER_MSI_RESOURCE_ID",
+		CnabAzureResourceGroup:                    "CNAB_AZURE_RESOURCE_GROUP",
 		CnabAzureStateStorageAccountName:          "CNAB_AZURE_STATE_STORAGE_ACCOUNT_NAME",
 		CnabAzureStateStorageAccountKey:           "CNAB_AZURE_STATE_STORAGE_ACCOUNT_KEY",
 		CnabAzureStateStorageAccountResourceGroup: "CNAB_AZURE_STATE_STORAGE_ACCOUNT_RESOURCE_GROUP",
 		CnabAzureStateFileshare:                   "CNAB_AZURE_STATE_FILESHARE",
+		CnabOutputsBlob:                           "CNAB_OUTPUTS_BLOB",
+		CnabRunner:                                "CNAB_RUNNER",
+		CnabConfigFile:                            "CNAB_CONFIG_FILE",
+		CnabLogFormat:                             "CNAB_LOG_FORMAT",
+		CnabLogSinkURL:                            "CNAB_LOG_SINK_URL",
+		CnabLogAnalyticsWorkspaceID:               "CNAB_LOG_ANALYTICS_WORKSPACE_ID",
+		CnabLogAnalyticsKey:                       "CNAB_LOG_ANALYTICS_KEY",
+		AzureStorageConnectionString:              "AZURE_STORAGE_CONNECTION_STRING",
+		CnabNameMap:                               "CNAB_NAME_MAP",
+		CnabKeyVaultName:                          "CNAB_KEYVAULT_NAME",
+		CnabKeyVaultClientID:                      "CNAB_KEYVAULT_CLIENT_ID",
+		CnabKeyVaultParameterPrefix:               "CNAB_KEYVAULT_PARAM_",
+		CnabKeyVaultCredentialPrefix:              "CNAB_KEYVAULT_CRED_",
+		CnabKeyVaultCredentialFilePrefix:          "CNAB_KEYVAULT_CRED_FILE_",
 		Verbose:                                   "VERBOSE",
 	}
 }
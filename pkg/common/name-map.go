@@ -0,0 +1,103 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+)
+
+var invalidNameCharsRegex = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// NameMap maps the names of parameters and credentials used in the generated template and environment variables back to the names in the bundle
+type NameMap struct {
+	Parameters  map[string]string `json:"parameters,omitempty"`
+	Credentials map[string]string `json:"credentials,omitempty"`
+}
+
+// ToSafeName converts a bundle parameter or credential name to a name that can be used as a template parameter and environment variable name
+func ToSafeName(name string) string {
+	return invalidNameCharsRegex.ReplaceAllString(name, "_")
+}
+
+// NewNameMap creates a NameMap for the names of bundle parameters and credentials, it is an error for different names to map to the same name
+func NewNameMap(parameters []string, credentials []string) (NameMap, error) {
+	nameMap := NameMap{
+		Parameters:  map[string]string{},
+		Credentials: map[string]string{},
+	}
+
+	// Parameters and credentials are both template parameters so they share the same names
+	used := map[string]string{}
+
+	add := func(names []string, mapped map[string]string) error {
+		sorted := append([]string{}, names...)
+		sort.Strings(sorted)
+
+		for _, name := range sorted {
+			safeName := ToSafeName(name)
+			if existing, ok := used[safeName]; ok && existing != name {
+				return fmt.Errorf("%s and %s both map to the name %s, one of them must be renamed", existing, name, safeName)
+			}
+			used[safeName] = name
+
+			if safeName != name {
+				mapped[safeName] = name
+			}
+		}
+
+		return nil
+	}
+
+	if err := add(parameters, nameMap.Parameters); err != nil {
+		return nameMap, err
+	}
+
+	if err := add(credentials, nameMap.Credentials); err != nil {
+		return nameMap, err
+	}
+
+	return nameMap, nil
+}
+
+// GetNameMap gets the NameMap set by the generated template, names are not mapped if it is not set
+func GetNameMap() (NameMap, error) {
+	return ParseNameMap(os.Getenv(GetEnvironmentVariableNames().CnabNameMap))
+}
+
+// ParseNameMap parses the value of the CNAB_NAME_MAP environment variable, names are not mapped if it is empty
+func ParseNameMap(value string) (NameMap, error) {
+	var nameMap NameMap
+
+	if value == "" {
+		return nameMap, nil
+	}
+
+	if err := json.Unmarshal([]byte(value), &nameMap); err != nil {
+		return nameMap, fmt.Errorf("Unable to parse %s: %s", GetEnvironmentVariableNames().CnabNameMap, err)
+	}
+
+	return nameMap, nil
+}
+
+// IsEmpty checks if any names are mapped
+func (nameMap NameMap) IsEmpty() bool {
+	return len(nameMap.Parameters) == 0 && len(nameMap.Credentials) == 0
+}
+
+// ParameterName gets the bundle name for a parameter
+func (nameMap NameMap) ParameterName(name string) string {
+	if bundleName, ok := nameMap.Parameters[name]; ok {
+		return bundleName
+	}
+	return name
+}
+
+// CredentialName gets the bundle name for a credential
+func (nameMap NameMap) CredentialName(name string) string {
+	if bundleName, ok := nameMap.Credentials[name]; ok {
+		return bundleName
+	}
+	return name
+}
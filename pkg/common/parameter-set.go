@@ -0,0 +1,17 @@
+package common
+
+import (
+	"time"
+
+	"github.com/cnabio/cnab-go/schema"
+	"github.com/cnabio/cnab-go/valuesource"
+)
+
+// ParameterSet defines a Porter parameter set
+type ParameterSet struct {
+	SchemaVersion schema.Version         `json:"schemaVersion" yaml:"schemaVersion"`
+	Name          string                 `json:"name" yaml:"name"`
+	Created       time.Time              `json:"created" yaml:"created"`
+	Modified      time.Time              `json:"modified" yaml:"modified"`
+	Parameters    []valuesource.Strategy `json:"parameters" yaml:"parameters"`
+}
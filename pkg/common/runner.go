@@ -0,0 +1,19 @@
+package common
+
+const (
+	// RunnerPorter runs the bundle by executing the porter CLI, this is the default
+	RunnerPorter = "porter"
+
+	// RunnerCnab runs the bundle in-process using the cnab-go action and driver packages
+	RunnerCnab = "cnab"
+)
+
+// IsValidRunner checks if a runner name is supported, an empty name selects the default runner
+func IsValidRunner(name string) bool {
+	switch name {
+	case "", RunnerPorter, RunnerCnab:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,76 @@
+package generator
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	bundleArchiveMetadataFile = "bundle.json"
+)
+
+// isBundleArchive checks if the file is a CNAB archive (a gzipped tar file as produced by porter archive or the cnab-go packager)
+func isBundleArchive(reader *bufio.Reader) bool {
+	magic, err := reader.Peek(2)
+	return err == nil && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+// readBundleArchive extracts the bundle.json from a thick or thin CNAB archive, the artifacts in the archive are skipped
+func readBundleArchive(reader io.Reader, source string) ([]byte, error) {
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read bundle archive %s: %s", source, err)
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read bundle archive %s: %s", source, err)
+		}
+
+		if header.Typeflag != tar.TypeReg || archiveEntryName(header.Name) != bundleArchiveMetadataFile {
+			continue
+		}
+
+		if header.Size > maxBundleSize {
+			return nil, fmt.Errorf("Unable to read bundle archive %s: %s exceeds maximum size of %d bytes", source, bundleArchiveMetadataFile, maxBundleSize)
+		}
+
+		return ioutil.ReadAll(tarReader)
+	}
+
+	return nil, fmt.Errorf("Bundle archive %s does not contain %s", source, bundleArchiveMetadataFile)
+}
+
+// archiveEntryName normalises the name of an entry in an archive, archives created from a directory have entries prefixed with ./
+func archiveEntryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// readBundleSource reads the bundle.json from a file, which may be a bundle.json or a CNAB archive
+func readBundleSource(source string) ([]byte, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	if isBundleArchive(reader) {
+		return readBundleArchive(reader, source)
+	}
+
+	return ioutil.ReadAll(reader)
+}
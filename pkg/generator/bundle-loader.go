@@ -0,0 +1,214 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cnabio/cnab-go/bundle"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/registry"
+)
+
+const (
+	// maxBundleSize limits the size of a bundle.json downloaded from a URL
+	maxBundleSize = 4 * 1024 * 1024
+
+	// downloadTimeout limits how long downloading a bundle.json from a URL can take
+	downloadTimeout = 60 * time.Second
+)
+
+// loadBundle loads the bundle metadata and the patterns of its definitions from the source in the options, returning the bundle tag if it can be inferred from the source
+func loadBundle(options GenerateTemplateOptions) (*bundle.Bundle, definitionPatterns, string, error) {
+	// The digest is validated before it is used, as it is part of the path of the cached bundle
+	digest := strings.ToLower(options.BundleDigest)
+	if digest != "" {
+		if err := registry.ValidateDigest(digest); err != nil {
+			return nil, nil, "", err
+		}
+	}
+
+	if options.BundleLoc == "" {
+		b, patterns, err := pullBundle(options.BundleTag, digest, options.Registry)
+		return b, patterns, "", err
+	}
+
+	source := options.BundleLoc
+	if isPorterManifest(source) {
+		if digest != "" {
+			return nil, nil, "", fmt.Errorf("Unable to verify the digest of Porter manifest %s, the digest is of the bundle.json built from the manifest", source)
+		}
+		return loadPorterManifest(source)
+	}
+
+	var data []byte
+	var err error
+	if isURL(source) {
+		data, err = downloadBundle(source, digest, options.CacheDir)
+	} else {
+		data, err = readBundleFile(source, digest)
+	}
+
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	b, patterns, err := unmarshalBundle(data)
+	return b, patterns, "", err
+}
+
+// unmarshalBundle parses a bundle.json and the patterns of its definitions
+func unmarshalBundle(data []byte) (*bundle.Bundle, definitionPatterns, error) {
+	b, err := bundle.Unmarshal(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	patterns, err := getDefinitionPatterns(data)
+	return b, patterns, err
+}
+
+func readBundleFile(source string, digest string) ([]byte, error) {
+	if _, err := os.Stat(source); err != nil {
+		return nil, err
+	}
+
+	data, err := readBundleSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	// For a CNAB archive the digest is verified against the bundle.json in the archive
+	if digest != "" {
+		if err := registry.VerifyDigest(data, digest); err != nil {
+			return nil, fmt.Errorf("Bundle %s failed verification: %s", source, err)
+		}
+	}
+
+	return data, nil
+}
+
+// downloadBundle fetches a bundle.json from a URL, if a digest is provided then the bundle is cached and a previously cached copy is used if available
+// Bundles without a digest are always downloaded as the content of the URL can change
+func downloadBundle(source string, digest string, cacheDir string) ([]byte, error) {
+	if digest != "" {
+		var err error
+		cacheDir, err = getCacheDir(cacheDir)
+		if err != nil {
+			return nil, err
+		}
+
+		if data, ok := readCachedBundle(cacheDir, digest); ok {
+			return data, nil
+		}
+	}
+
+	client := &http.Client{Timeout: downloadTimeout}
+	response, err := client.Get(source)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download bundle from %s: %s", source, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to download bundle from %s: server returned %s", source, response.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(response.Body, maxBundleSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download bundle from %s: %s", source, err)
+	}
+
+	if len(data) > maxBundleSize {
+		return nil, fmt.Errorf("Failed to download bundle from %s: bundle exceeds maximum size of %d bytes", source, maxBundleSize)
+	}
+
+	if digest == "" {
+		return data, nil
+	}
+
+	if err := registry.VerifyDigest(data, digest); err != nil {
+		return nil, fmt.Errorf("Bundle downloaded from %s failed verification: %s", source, err)
+	}
+
+	// Failing to cache the bundle should not stop the template being generated
+	if err := writeCachedBundle(cacheDir, digest, data); err != nil {
+		log.Printf("Unable to cache bundle downloaded from %s: %s\n", source, err)
+	}
+
+	return data, nil
+}
+
+func getCacheDir(cacheDir string) (string, error) {
+	if cacheDir != "" {
+		return cacheDir, nil
+	}
+
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("Unable to determine cache directory: %s", err)
+	}
+
+	return filepath.Join(userCacheDir, "cnabarmdriver", "bundles"), nil
+}
+
+// cachedBundlePath returns the path a bundle is cached at, bundles are stored by the hex encoded sha256 digest of their content, which must have been validated
+func cachedBundlePath(cacheDir string, digest string) string {
+	return filepath.Join(cacheDir, strings.TrimPrefix(digest, "sha256:")+".json")
+}
+
+func readCachedBundle(cacheDir string, digest string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(cachedBundlePath(cacheDir, digest))
+	if err != nil {
+		return nil, false
+	}
+
+	// Ignore a cached copy that has been modified, it will be downloaded again
+	if registry.VerifyDigest(data, digest) != nil {
+		return nil, false
+	}
+
+	return data, true
+}
+
+func writeCachedBundle(cacheDir string, digest string, data []byte) error {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(cachedBundlePath(cacheDir, digest), data, 0644)
+}
+
+// pullBundle pulls the bundle from the registry, if a digest is provided the bundle.json is verified against it
+func pullBundle(bundleTag string, digest string, client registry.Client) (*bundle.Bundle, definitionPatterns, error) {
+	if client == nil {
+		client = registry.NewClient(registry.ClientOptions{})
+	}
+
+	data, err := client.PullBundleData(bundleTag)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to pull bundle %s: %s", bundleTag, err)
+	}
+
+	if digest != "" {
+		if err := registry.VerifyDigest(data, digest); err != nil {
+			return nil, nil, fmt.Errorf("Bundle %s failed verification: %s", bundleTag, err)
+		}
+	}
+
+	b, patterns, err := unmarshalBundle(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to parse bundle %s: %s", bundleTag, err)
+	}
+
+	return b, patterns, nil
+}
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
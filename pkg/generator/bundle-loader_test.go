@@ -0,0 +1,299 @@
+package generator
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cnabio/cnab-go/bundle"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/registry"
+	"gotest.tools/v3/assert"
+)
+
+func TestGenerateTemplateFromURL(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	bundleData, _ := ioutil.ReadFile("testdata/bundle.json")
+	cacheDir, _ := ioutil.TempDir("", "cnabarmdriver")
+	defer os.RemoveAll(cacheDir)
+
+	generatedOutputPath := "testdata/generated/azuredeploy-url-generated.json"
+	expectedOutputPath := "testdata/azuredeploy.json"
+
+	options := GenerateTemplateOptions{
+		BundleLoc:    server.URL + "/bundle.json",
+		BundleTag:    "cnabquickstarts.azurecr.io/porter/hello-world/bundle:1.0.0",
+		BundleDigest: registry.ComputeDigest(bundleData),
+		CacheDir:     cacheDir,
+		Indent:       true,
+		OutputFile:   generatedOutputPath,
+		Overwrite:    true,
+		Version:      "latest",
+	}
+
+	err := GenerateTemplate(options)
+	assert.NilError(t, err)
+
+	expectedBytes, err := ioutil.ReadFile(expectedOutputPath)
+	if err != nil {
+		t.Fatalf("failed reading expected output: %s", err)
+	}
+
+	generatedBytes, err := ioutil.ReadFile(generatedOutputPath)
+	if err != nil {
+		t.Fatalf("failed reading generated output: %s", err)
+	}
+
+	assert.Equal(t, string(expectedBytes), string(generatedBytes))
+
+	// The bundle should now be served from the cache
+	server.Close()
+
+	err = GenerateTemplate(options)
+	assert.NilError(t, err)
+}
+
+func TestGenerateTemplateFromURLWithInvalidDigest(t *testing.T) {
+
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	cacheDir, _ := ioutil.TempDir("", "cnabarmdriver")
+	defer os.RemoveAll(cacheDir)
+
+	options := GenerateTemplateOptions{
+		BundleLoc:    server.URL + "/bundle.json",
+		BundleTag:    "cnabquickstarts.azurecr.io/porter/hello-world/bundle:1.0.0",
+		BundleDigest: "sha256:0000000000000000000000000000000000000000000000000000000000000000",
+		CacheDir:     cacheDir,
+		OutputFile:   "testdata/generated/azuredeploy-url-invalid-generated.json",
+		Overwrite:    true,
+	}
+
+	err := GenerateTemplate(options)
+	assert.ErrorContains(t, err, "failed verification")
+}
+
+func TestGenerateTemplateFromURLWithMalformedDigest(t *testing.T) {
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.ServeFile(w, r, "testdata/bundle.json")
+	}))
+	defer server.Close()
+
+	cacheDir, _ := ioutil.TempDir("", "cnabarmdriver")
+	defer os.RemoveAll(cacheDir)
+
+	options := GenerateTemplateOptions{
+		BundleLoc:    server.URL + "/bundle.json",
+		BundleTag:    "cnabquickstarts.azurecr.io/porter/hello-world/bundle:1.0.0",
+		BundleDigest: "sha256:../../bundle",
+		CacheDir:     cacheDir,
+		OutputFile:   "testdata/generated/azuredeploy-url-malformed-generated.json",
+		Overwrite:    true,
+	}
+
+	err := GenerateTemplate(options)
+	assert.ErrorContains(t, err, "Invalid digest sha256:../../bundle")
+	assert.Equal(t, requests, 0)
+}
+
+func TestGenerateTemplateFromURLWithoutDigest(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	cacheDir, _ := ioutil.TempDir("", "cnabarmdriver")
+	defer os.RemoveAll(cacheDir)
+
+	options := GenerateTemplateOptions{
+		BundleLoc:  server.URL + "/bundle.json",
+		BundleTag:  "cnabquickstarts.azurecr.io/porter/hello-world/bundle:1.0.0",
+		CacheDir:   cacheDir,
+		OutputFile: "testdata/generated/azuredeploy-url-nodigest-generated.json",
+		Overwrite:  true,
+		Version:    "latest",
+	}
+
+	err := GenerateTemplate(options)
+	assert.NilError(t, err)
+
+	// Only bundles with a digest are cached
+	files, err := ioutil.ReadDir(cacheDir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(files), 0)
+}
+
+// testRegistry serves a bundle.json as if it was pulled from a registry
+type testRegistry struct {
+	data []byte
+}
+
+func (r *testRegistry) PullBundle(tag string) (*bundle.Bundle, error) {
+	return bundle.Unmarshal(r.data)
+}
+
+func (r *testRegistry) PullBundleData(tag string) ([]byte, error) {
+	if r.data == nil {
+		return nil, fmt.Errorf("%s not found", tag)
+	}
+	return r.data, nil
+}
+
+func TestLoadBundleWithDigest(t *testing.T) {
+
+	bundleData, err := ioutil.ReadFile("testdata/bundle.json")
+	assert.NilError(t, err)
+
+	options := GenerateTemplateOptions{
+		BundleTag:    "cnabquickstarts.azurecr.io/porter/hello-world/bundle:1.0.0",
+		BundleDigest: registry.ComputeDigest(bundleData),
+		Registry:     &testRegistry{data: bundleData},
+	}
+
+	b, _, _, err := loadBundle(options)
+	assert.NilError(t, err)
+	assert.Equal(t, b.Name, "hello-world")
+
+	options.BundleDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	_, _, _, err = loadBundle(options)
+	assert.ErrorContains(t, err, "Bundle cnabquickstarts.azurecr.io/porter/hello-world/bundle:1.0.0 failed verification")
+
+	// The bundle.json is only built from a Porter manifest by porter build, so its digest cannot be verified
+	_, _, _, err = loadBundle(GenerateTemplateOptions{BundleLoc: "testdata/porter.yaml", BundleDigest: registry.ComputeDigest(bundleData)})
+	assert.ErrorContains(t, err, "Unable to verify the digest of Porter manifest testdata/porter.yaml")
+}
+
+func TestGenerateTemplateFromArchive(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+
+	tempDir, _ := ioutil.TempDir("", "cnabarmdriver")
+	defer os.RemoveAll(tempDir)
+
+	bundleData, _ := ioutil.ReadFile("testdata/bundle.json")
+	archivePath := filepath.Join(tempDir, "hello-world-1.0.0.tgz")
+	writeTestArchive(t, archivePath, map[string][]byte{
+		"./artifacts/layout/oci-layout": []byte(`{"imageLayoutVersion":"1.0.0"}`),
+		"./bundle.json":                 bundleData,
+	})
+
+	generatedOutputPath := "testdata/generated/azuredeploy-archive-generated.json"
+	expectedOutputPath := "testdata/azuredeploy.json"
+
+	options := GenerateTemplateOptions{
+		BundleLoc:    archivePath,
+		BundleTag:    "cnabquickstarts.azurecr.io/porter/hello-world/bundle:1.0.0",
+		BundleDigest: registry.ComputeDigest(bundleData),
+		Indent:       true,
+		OutputFile:   generatedOutputPath,
+		Overwrite:    true,
+		Version:      "latest",
+	}
+
+	err := GenerateTemplate(options)
+	assert.NilError(t, err)
+
+	expectedBytes, err := ioutil.ReadFile(expectedOutputPath)
+	if err != nil {
+		t.Fatalf("failed reading expected output: %s", err)
+	}
+
+	generatedBytes, err := ioutil.ReadFile(generatedOutputPath)
+	if err != nil {
+		t.Fatalf("failed reading generated output: %s", err)
+	}
+
+	assert.Equal(t, string(expectedBytes), string(generatedBytes))
+}
+
+func TestGenerateTemplateFromArchiveWithoutBundle(t *testing.T) {
+
+	tempDir, _ := ioutil.TempDir("", "cnabarmdriver")
+	defer os.RemoveAll(tempDir)
+
+	archivePath := filepath.Join(tempDir, "empty.tgz")
+	writeTestArchive(t, archivePath, map[string][]byte{
+		"./artifacts/layout/oci-layout": []byte(`{"imageLayoutVersion":"1.0.0"}`),
+	})
+
+	options := GenerateTemplateOptions{
+		BundleLoc:  archivePath,
+		BundleTag:  "cnabquickstarts.azurecr.io/porter/hello-world/bundle:1.0.0",
+		OutputFile: filepath.Join(tempDir, "azuredeploy.json"),
+	}
+
+	err := GenerateTemplate(options)
+	assert.ErrorContains(t, err, "does not contain bundle.json")
+}
+
+func writeTestArchive(t *testing.T, path string, files map[string][]byte) {
+	file, err := os.Create(path)
+	assert.NilError(t, err)
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	defer gzipWriter.Close()
+
+	tarWriter := tar.NewWriter(gzipWriter)
+	defer tarWriter.Close()
+
+	for name, data := range files {
+		err := tarWriter.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(data)),
+			Typeflag: tar.TypeReg,
+		})
+		assert.NilError(t, err)
+
+		_, err = tarWriter.Write(data)
+		assert.NilError(t, err)
+	}
+}
+
+func TestGenerateTemplateFromPorterManifest(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+
+	generatedOutputPath := "testdata/generated/azuredeploy-porter-generated.json"
+	expectedOutputPath := "testdata/azuredeploy.json"
+
+	// The bundle tag is taken from the manifest
+	options := GenerateTemplateOptions{
+		BundleLoc:  "testdata/porter.yaml",
+		Indent:     true,
+		OutputFile: generatedOutputPath,
+		Overwrite:  true,
+		Version:    "latest",
+	}
+
+	err := GenerateTemplate(options)
+	assert.NilError(t, err)
+
+	expectedBytes, err := ioutil.ReadFile(expectedOutputPath)
+	if err != nil {
+		t.Fatalf("failed reading expected output: %s", err)
+	}
+
+	generatedBytes, err := ioutil.ReadFile(generatedOutputPath)
+	if err != nil {
+		t.Fatalf("failed reading generated output: %s", err)
+	}
+
+	assert.Equal(t, string(expectedBytes), string(generatedBytes))
+}
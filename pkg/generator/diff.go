@@ -0,0 +1,265 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/template"
+)
+
+const actionParameterName = "cnab_action"
+
+// DiffTemplatesOptions is the set of options for configuring DiffTemplates
+type DiffTemplatesOptions struct {
+	// FromBundleLoc and ToBundleLoc are the bundle files, CNAB archives, Porter manifests or URLs of the bundle versions to compare
+	FromBundleLoc string
+	ToBundleLoc   string
+	// Options are the options both templates are generated with, BundleLoc is ignored
+	Options GenerateTemplateOptions
+}
+
+// TemplateChange is a difference between the templates generated for two versions of a bundle
+type TemplateChange struct {
+	Description string
+	// Breaking is set when deployments that work with the old template may fail with the new template, i.e. a new required parameter, a removed parameter or allowed value, a changed type or a tightened constraint
+	Breaking bool
+}
+
+// diffTemplate is the template generated for a version of a bundle
+type diffTemplate struct {
+	template.Template
+	// required are the template parameters set from required bundle parameters without a default value, they have an empty default value in the template when they only apply to some actions
+	required map[string]bool
+}
+
+// DiffTemplates generates the templates for two versions of a bundle and returns the changes to the parameters, allowed values, defaults and actions
+func DiffTemplates(options DiffTemplatesOptions) ([]TemplateChange, error) {
+	from, err := generateDiffTemplate(options.FromBundleLoc, options.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := generateDiffTemplate(options.ToBundleLoc, options.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffTemplates(from, to), nil
+}
+
+// generateDiffTemplate generates the template for a bundle in memory, converting it to the types it has when it is read from a file so that values can be compared
+func generateDiffTemplate(bundleLoc string, options GenerateTemplateOptions) (diffTemplate, error) {
+	var generatedTemplate diffTemplate
+
+	options.BundleLoc = bundleLoc
+	bundle, patterns, inferredBundleTag, err := loadBundle(options)
+	if err != nil {
+		return generatedTemplate, fmt.Errorf("Unable to load bundle %s: %s", bundleLoc, err)
+	}
+	options.definitionPatterns = patterns
+
+	// The bundle tag is only used for values that are not compared
+	bundleTag := options.BundleTag
+	if bundleTag == "" {
+		bundleTag = inferredBundleTag
+	}
+	if bundleTag == "" {
+		bundleTag = fmt.Sprintf("%s:%s", bundle.Name, bundle.Version)
+	}
+
+	if options.Version == "" {
+		options.Version = "latest"
+	}
+
+	generated, err := generateTemplate(bundle, bundleTag, options)
+	if err != nil {
+		return generatedTemplate, fmt.Errorf("Unable to generate template for bundle %s: %s", bundleLoc, err)
+	}
+
+	data, err := json.Marshal(generated)
+	if err != nil {
+		return generatedTemplate, err
+	}
+
+	if err := json.Unmarshal(data, &generatedTemplate.Template); err != nil {
+		return generatedTemplate, err
+	}
+
+	generatedTemplate.required = map[string]bool{}
+	for parameterKey, parameter := range bundle.Parameters {
+		if !parameter.Required {
+			continue
+		}
+
+		if definition, ok := bundle.Definitions[parameter.Definition]; ok && definition.Default != nil {
+			continue
+		}
+
+		name := common.ToSafeName(parameterKey)
+		if _, ok := generatedTemplate.Parameters[name]; ok {
+			generatedTemplate.required[name] = true
+		}
+	}
+
+	return generatedTemplate, nil
+}
+
+func diffTemplates(from diffTemplate, to diffTemplate) []TemplateChange {
+	var changes []TemplateChange
+
+	fromActions := toValues(from.Parameters[actionParameterName].AllowedValues)
+	toActions := toValues(to.Parameters[actionParameterName].AllowedValues)
+	for _, action := range difference(fromActions, toActions) {
+		changes = append(changes, TemplateChange{Description: fmt.Sprintf("action %s removed", formatValue(action)), Breaking: true})
+	}
+	for _, action := range difference(toActions, fromActions) {
+		changes = append(changes, TemplateChange{Description: fmt.Sprintf("action %s added", formatValue(action))})
+	}
+
+	for _, name := range sortedParameterNames(from.Template) {
+		if _, ok := to.Parameters[name]; !ok {
+			// Deployments that still pass the parameter are rejected by ARM
+			changes = append(changes, TemplateChange{Description: fmt.Sprintf("parameter %s removed", name), Breaking: true})
+		}
+	}
+
+	for _, name := range sortedParameterNames(to.Template) {
+		parameter := to.Parameters[name]
+
+		previous, ok := from.Parameters[name]
+		if !ok {
+			if parameter.DefaultValue == nil || to.required[name] {
+				changes = append(changes, TemplateChange{Description: fmt.Sprintf("required parameter %s added", name), Breaking: true})
+				continue
+			}
+			changes = append(changes, TemplateChange{Description: fmt.Sprintf("parameter %s added with default value %s", name, formatValue(parameter.DefaultValue))})
+			continue
+		}
+
+		// A required parameter that only applies to some actions has an empty default value, so the default does not show that it is now required
+		if to.required[name] && !from.required[name] && parameter.DefaultValue != nil {
+			changes = append(changes, TemplateChange{Description: fmt.Sprintf("parameter %s is now required", name), Breaking: true})
+		}
+
+		changes = append(changes, diffParameter(name, previous, parameter)...)
+	}
+
+	return changes
+}
+
+func diffParameter(name string, from template.Parameter, to template.Parameter) []TemplateChange {
+	var changes []TemplateChange
+
+	if from.Type != to.Type {
+		changes = append(changes, TemplateChange{Description: fmt.Sprintf("parameter %s type changed from %s to %s", name, from.Type, to.Type), Breaking: true})
+	}
+
+	switch {
+	case from.DefaultValue != nil && to.DefaultValue == nil:
+		changes = append(changes, TemplateChange{Description: fmt.Sprintf("parameter %s is now required, the default value %s was removed", name, formatValue(from.DefaultValue)), Breaking: true})
+	case from.DefaultValue == nil && to.DefaultValue != nil:
+		changes = append(changes, TemplateChange{Description: fmt.Sprintf("parameter %s is now optional with default value %s", name, formatValue(to.DefaultValue))})
+	case !reflect.DeepEqual(from.DefaultValue, to.DefaultValue):
+		changes = append(changes, TemplateChange{Description: fmt.Sprintf("parameter %s default value changed from %s to %s", name, formatValue(from.DefaultValue), formatValue(to.DefaultValue))})
+	}
+
+	// Actions are reported separately
+	if name != actionParameterName {
+		fromAllowed := toValues(from.AllowedValues)
+		toAllowed := toValues(to.AllowedValues)
+
+		switch {
+		case fromAllowed != nil && toAllowed == nil:
+			changes = append(changes, TemplateChange{Description: fmt.Sprintf("parameter %s no longer restricts its allowed values", name)})
+		case fromAllowed == nil && toAllowed != nil:
+			changes = append(changes, TemplateChange{Description: fmt.Sprintf("parameter %s now only allows %s", name, formatValue(toAllowed)), Breaking: true})
+		default:
+			for _, value := range difference(fromAllowed, toAllowed) {
+				changes = append(changes, TemplateChange{Description: fmt.Sprintf("parameter %s allowed value %s removed", name, formatValue(value)), Breaking: true})
+			}
+			for _, value := range difference(toAllowed, fromAllowed) {
+				changes = append(changes, TemplateChange{Description: fmt.Sprintf("parameter %s allowed value %s added", name, formatValue(value))})
+			}
+		}
+	}
+
+	changes = append(changes, diffConstraint(name, "minimum value", from.MinValue, to.MinValue, true)...)
+	changes = append(changes, diffConstraint(name, "maximum value", from.MaxValue, to.MaxValue, false)...)
+	changes = append(changes, diffConstraint(name, "minimum length", from.MinLength, to.MinLength, true)...)
+	changes = append(changes, diffConstraint(name, "maximum length", from.MaxLength, to.MaxLength, false)...)
+
+	return changes
+}
+
+// diffConstraint compares a minimum or maximum, adding or tightening it is breaking as values that were allowed may now be rejected
+func diffConstraint(name string, constraint string, from *int, to *int, minimum bool) []TemplateChange {
+	switch {
+	case from == nil && to == nil:
+		return nil
+	case from == nil:
+		return []TemplateChange{{Description: fmt.Sprintf("parameter %s %s %d added", name, constraint, *to), Breaking: true}}
+	case to == nil:
+		return []TemplateChange{{Description: fmt.Sprintf("parameter %s %s %d removed", name, constraint, *from)}}
+	case *from != *to:
+		tightened := *to < *from
+		if minimum {
+			tightened = *to > *from
+		}
+		return []TemplateChange{{Description: fmt.Sprintf("parameter %s %s changed from %d to %d", name, constraint, *from, *to), Breaking: tightened}}
+	default:
+		return nil
+	}
+}
+
+// toValues converts allowed values read from a template to a slice, returning nil if there are none
+func toValues(values interface{}) []interface{} {
+	array, ok := values.([]interface{})
+	if !ok || len(array) == 0 {
+		return nil
+	}
+
+	return array
+}
+
+// difference returns the values that are in a but not in b, in the order of a
+func difference(a []interface{}, b []interface{}) []interface{} {
+	var result []interface{}
+	for _, value := range a {
+		found := false
+		for _, other := range b {
+			if reflect.DeepEqual(value, other) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
+
+func formatValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(data)
+}
+
+// BreakingChanges returns the number of changes that are breaking
+func BreakingChanges(changes []TemplateChange) int {
+	count := 0
+	for _, change := range changes {
+		if change.Breaking {
+			count++
+		}
+	}
+
+	return count
+}
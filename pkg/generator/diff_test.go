@@ -0,0 +1,111 @@
+package generator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/template"
+	"gotest.tools/v3/assert"
+)
+
+func TestDiffTemplates(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+
+	data, err := ioutil.ReadFile("testdata/bundle.json")
+	assert.NilError(t, err)
+
+	var bundle map[string]interface{}
+	err = json.Unmarshal(data, &bundle)
+	assert.NilError(t, err)
+
+	definitions := bundle["definitions"].(map[string]interface{})
+	parameters := bundle["parameters"].(map[string]interface{})
+
+	definitions["age"].(map[string]interface{})["default"] = 30
+	definitions["place_of_birth"].(map[string]interface{})["enum"] = []string{"USA", "France"}
+	definitions["region"] = map[string]interface{}{"type": "string"}
+	definitions["size"] = map[string]interface{}{"type": "string", "default": "small"}
+	parameters["region"] = map[string]interface{}{"definition": "region", "required": true}
+	parameters["size"] = map[string]interface{}{"definition": "size"}
+	parameters["backup_target"] = map[string]interface{}{"definition": "region", "required": true, "applyTo": []string{"backup"}}
+	delete(parameters, "azure_location")
+	bundle["actions"] = map[string]interface{}{"backup": map[string]interface{}{"description": "Backs up the database"}}
+
+	data, err = json.Marshal(bundle)
+	assert.NilError(t, err)
+
+	toBundlePath := "testdata/generated/bundle-diff.json"
+	err = ioutil.WriteFile(toBundlePath, data, 0644)
+	assert.NilError(t, err)
+
+	changes, err := DiffTemplates(DiffTemplatesOptions{
+		FromBundleLoc: "testdata/bundle.json",
+		ToBundleLoc:   toBundlePath,
+	})
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, changes, []TemplateChange{
+		{Description: `action "endjin.customAction" removed`, Breaking: true},
+		{Description: `action "backup" added`},
+		{Description: "parameter azure_location removed", Breaking: true},
+		{Description: "parameter age default value changed from 29 to 30"},
+		{Description: "required parameter backup_target added", Breaking: true},
+		{Description: `parameter place_of_birth allowed value "UK" removed`, Breaking: true},
+		{Description: `parameter place_of_birth allowed value "France" added`},
+		{Description: "required parameter region added", Breaking: true},
+		{Description: `parameter size added with default value "small"`},
+	})
+	assert.Equal(t, BreakingChanges(changes), 5)
+
+	changes, err = DiffTemplates(DiffTemplatesOptions{
+		FromBundleLoc: "testdata/bundle.json",
+		ToBundleLoc:   "testdata/bundle.json",
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(changes), 0)
+}
+
+func TestDiffParameter(t *testing.T) {
+	one, two := 1, 2
+
+	from := template.Parameter{Type: "string", DefaultValue: "a", MinLength: &one}
+	to := template.Parameter{Type: "string", AllowedValues: []interface{}{"b"}, MinLength: &two}
+
+	assert.DeepEqual(t, diffParameter("name", from, to), []TemplateChange{
+		{Description: `parameter name is now required, the default value "a" was removed`, Breaking: true},
+		{Description: `parameter name now only allows ["b"]`, Breaking: true},
+		{Description: "parameter name minimum length changed from 1 to 2", Breaking: true},
+	})
+
+	assert.DeepEqual(t, diffParameter("name", to, from), []TemplateChange{
+		{Description: `parameter name is now optional with default value "a"`},
+		{Description: "parameter name no longer restricts its allowed values"},
+		{Description: "parameter name minimum length changed from 2 to 1"},
+	})
+}
+
+func TestDiffParameterConstraints(t *testing.T) {
+	one, two, ten, twenty := 1, 2, 10, 20
+
+	from := template.Parameter{Type: "int", MinValue: &one, MaxValue: &twenty, MaxLength: &ten}
+	to := template.Parameter{Type: "string", MinValue: &two, MaxValue: &ten, MinLength: &one}
+
+	assert.DeepEqual(t, diffParameter("name", from, to), []TemplateChange{
+		{Description: "parameter name type changed from int to string", Breaking: true},
+		{Description: "parameter name minimum value changed from 1 to 2", Breaking: true},
+		{Description: "parameter name maximum value changed from 20 to 10", Breaking: true},
+		{Description: "parameter name minimum length 1 added", Breaking: true},
+		{Description: "parameter name maximum length 10 removed"},
+	})
+
+	assert.DeepEqual(t, diffParameter("name", to, from), []TemplateChange{
+		{Description: "parameter name type changed from string to int", Breaking: true},
+		{Description: "parameter name minimum value changed from 2 to 1"},
+		{Description: "parameter name maximum value changed from 10 to 20"},
+		{Description: "parameter name minimum length 1 removed"},
+		{Description: "parameter name maximum length 10 added", Breaking: true},
+	})
+}
@@ -5,17 +5,26 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"regexp"
+	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/cnabio/cnab-go/bundle"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/bicep"
 	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/registry"
 	"github.com/endjin/CNAB.ARM-Converter/pkg/template"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/uidefinition"
 )
 
 const (
 	bundlecontainerregistry = "cnabquickstartstest.azurecr.io/"
+
+	// FormatJSON generates an ARM template in JSON
+	FormatJSON = "json"
+
+	// FormatBicep generates a Bicep file
+	FormatBicep = "bicep"
 )
 
 // GenerateTemplateOptions is the set of options for configuring GenerateTemplate
@@ -27,29 +36,150 @@ type GenerateTemplateOptions struct {
 	Indent     bool
 	Version    string
 	Simplify   bool
+	// UIDefinitionFile is the file name for the generated createUiDefinition.json, if not set no UI definition is generated
+	UIDefinitionFile string
+	// BundleDigest is the expected digest of the bundle.json (e.g. sha256:...) when the bundle is loaded from a file or URL
+	BundleDigest string
+	// CacheDir is the directory that bundles downloaded from a URL are cached in, the user cache directory is used if not set
+	CacheDir string
+	// Formats are the formats to generate the template in (json and/or bicep), if not set only json is generated
+	Formats []string
+	// Registry is used to pull the bundle when BundleLoc is not set, if nil a default registry client is used
+	Registry registry.Client
+	// ParameterProfile is the tool that built the bundle (porter, duffle or cnab), its internal parameters are not exposed in the template, if not set porter is used
+	ParameterProfile string
+	// IncludeParameters are glob patterns of parameters that are always exposed in the template, even if excluded by the profile
+	IncludeParameters []string
+	// ExcludeParameters are glob patterns of parameters that are not exposed in the template
+	ExcludeParameters []string
+	// ManagedIdentity is the type of managed identity (only user is supported) the driver uses to authenticate to Azure, if not set a service principal is used
+	ManagedIdentity string
+	// KeyVault reads credentials and sensitive parameters from Key Vault secrets, the template parameters are the names of the secrets instead of their values
+	KeyVault bool
+	// Runner is the backend the driver uses to run the bundle (porter or cnab), if not set porter is used
+	Runner string
+	// ConfigFile adds a template parameter for a YAML or JSON config file for the driver, which is mounted in the container from a secret volume
+	ConfigFile bool
+	// LogFormat is the format of the action output (text or json), if not set the output is written as it is
+	LogFormat string
+	// LogSink is where the action output is forwarded to (http or loganalytics), if not set the output is not forwarded
+	LogSink string
+
+	// definitionPatterns are the patterns of the bundle definitions, which are set when the bundle is loaded
+	definitionPatterns definitionPatterns
 }
 
 // GenerateTemplate generates ARM template from bundle metadata
 func GenerateTemplate(options GenerateTemplateOptions) error {
 
-	// TODO support http uri and registry based bundle
-	bundle, err := loadBundle(options.BundleLoc)
+	bundle, patterns, inferredBundleTag, err := loadBundle(options)
 
 	if err != nil {
 		return err
 	}
+	options.definitionPatterns = patterns
+
+	bundleTag := options.BundleTag
+	if bundleTag == "" {
+		bundleTag = inferredBundleTag
+	}
+
+	if bundleTag == "" {
+		return fmt.Errorf("Bundle tag must be specified")
+	}
 
-	if err = checkOutputFile(options.OutputFile, options.Overwrite); err != nil {
+	generateJSON, generateBicep, err := getFormats(options.Formats)
+	if err != nil {
 		return err
 	}
 
+	if generateJSON {
+		if err = checkOutputFile(options.OutputFile, options.Overwrite); err != nil {
+			return err
+		}
+	}
+
+	bicepFile := getBicepFile(options.OutputFile)
+	if generateBicep {
+		if err = checkOutputFile(bicepFile, options.Overwrite); err != nil {
+			return err
+		}
+	}
+
+	if options.UIDefinitionFile != "" {
+		if err = checkOutputFile(options.UIDefinitionFile, options.Overwrite); err != nil {
+			return err
+		}
+	}
+
+	generatedTemplate, err := generateTemplate(bundle, bundleTag, options)
+	if err != nil {
+		return err
+	}
+
+	if generateJSON {
+		if err := writeJSONFile(options.OutputFile, generatedTemplate, options.Indent); err != nil {
+			return err
+		}
+	}
+
+	if generateBicep {
+		data, err := bicep.Render(generatedTemplate)
+		if err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(bicepFile, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	if options.UIDefinitionFile != "" {
+		parameterFilter, err := NewParameterFilter(options.ParameterProfile, options.IncludeParameters, options.ExcludeParameters)
+		if err != nil {
+			return err
+		}
+
+		nameMap, err := getNameMap(bundle, parameterFilter)
+		if err != nil {
+			return err
+		}
+
+		uiDefinition := uidefinition.NewCreateUIDefinition(bundle, generatedTemplate, nameMap)
+		if err := writeJSONFile(options.UIDefinitionFile, uiDefinition, options.Indent); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// generateTemplate generates the ARM template for the bundle
+func generateTemplate(bundle *bundle.Bundle, bundleTag string, options GenerateTemplateOptions) (template.Template, error) {
+
 	bundleName := bundle.Name
-	bundleTag := options.BundleTag
-	bundleActions := make([]string, 0, len(bundle.Actions)+3)
-	defaultActions := []string{"install", "upgrade", "uninstall"}
-	bundleActions = append(bundleActions, defaultActions...)
-	for action := range bundle.Actions {
-		bundleActions = append(bundleActions, action)
+	bundleActions := []template.Action{
+		{Name: "install", Modifies: true},
+		{Name: "upgrade", Modifies: true},
+		{Name: "uninstall", Modifies: true},
+	}
+
+	// Sort custom actions, because Go randomizes order when iterating a map
+	var actionKeys []string
+	for actionKey := range bundle.Actions {
+		actionKeys = append(actionKeys, actionKey)
+	}
+	sort.Strings(actionKeys)
+
+	for _, actionKey := range actionKeys {
+		action := bundle.Actions[actionKey]
+		bundleActions = append(bundleActions, template.Action{
+			Name:        actionKey,
+			Description: action.Description,
+			Stateless:   action.Stateless,
+			Modifies:    action.Modifies,
+			Custom:      true,
+		})
 	}
 
 	generatedTemplate := template.NewCnabArmDriverTemplate(
@@ -60,6 +190,51 @@ func GenerateTemplate(options GenerateTemplateOptions) error {
 		options.Version,
 		options.Simplify)
 
+	if options.ManagedIdentity != "" {
+		if err := generatedTemplate.UseManagedIdentity(strings.ToLower(options.ManagedIdentity), options.Simplify); err != nil {
+			return generatedTemplate, err
+		}
+	}
+
+	if !common.IsValidRunner(options.Runner) {
+		return generatedTemplate, fmt.Errorf("Unsupported runner %s, must be %s or %s", options.Runner, common.RunnerPorter, common.RunnerCnab)
+	}
+
+	if options.Runner != "" && options.Runner != common.RunnerPorter {
+		if err := generatedTemplate.SetContainerEnvironmentVariable(template.EnvironmentVariable{
+			Name:  common.GetEnvironmentVariableNames().CnabRunner,
+			Value: options.Runner,
+		}); err != nil {
+			return generatedTemplate, err
+		}
+	}
+
+	if options.ConfigFile {
+		if err := generatedTemplate.AddConfigFile(); err != nil {
+			return generatedTemplate, err
+		}
+	}
+
+	if options.LogFormat != "" || options.LogSink != "" {
+		if err := generatedTemplate.ConfigureLogs(strings.ToLower(options.LogFormat), strings.ToLower(options.LogSink)); err != nil {
+			return generatedTemplate, err
+		}
+	}
+
+	parameterFilter, err := NewParameterFilter(options.ParameterProfile, options.IncludeParameters, options.ExcludeParameters)
+	if err != nil {
+		return generatedTemplate, err
+	}
+
+	if err := parameterFilter.CheckBundle(bundle); err != nil {
+		return generatedTemplate, err
+	}
+
+	nameMap, err := getNameMap(bundle, parameterFilter)
+	if err != nil {
+		return generatedTemplate, err
+	}
+
 	// Sort parameters, because Go randomizes order when iterating a map
 	var parameterKeys []string
 	for parameterKey := range bundle.Parameters {
@@ -70,33 +245,47 @@ func GenerateTemplate(options GenerateTemplateOptions) error {
 	for _, parameterKey := range parameterKeys {
 
 		parameter := bundle.Parameters[parameterKey]
-		definition := bundle.Definitions[parameter.Definition]
 
-		// Parameter names cannot contain - as they are converted into environment variables set on ACI container
-
-		// porter-debug is added automatically so can only be modified by updating porter
-		if parameterKey == "porter-debug" {
-			continue
-		}
-
-		// porter-*-output parameters are added automatically and should not be manually edited
-		match, _ := regexp.MatchString("porter-(.*)-output", parameterKey)
-		if match {
+		if parameterFilter.IsExcluded(parameterKey) {
 			continue
 		}
 
-		if strings.Contains(parameterKey, "-") {
-			return fmt.Errorf("Invalid Parameter name: %s.ARM template generation requires parameter names that can be used as environment variables", parameterKey)
-		}
+		// Parameter names are converted into environment variables set on ACI container, so names that are not valid environment variable names are mapped to safe names
+		parameterName := common.ToSafeName(parameterKey)
 
 		var paramEnvVar template.EnvironmentVariable
 
-		if cnabParam, ok := isCnabParam(parameterKey, generatedTemplate); options.Simplify && ok {
+		if cnabParam, ok := isCnabParam(parameterName, generatedTemplate); options.Simplify && ok {
 			paramEnvVar = template.EnvironmentVariable{
-				Name:  common.GetEnvironmentVariableNames().CnabParameterPrefix + parameterKey,
+				Name:  common.GetEnvironmentVariableNames().CnabParameterPrefix + parameterName,
 				Value: fmt.Sprintf("[variables('%s')]", cnabParam),
 			}
 		} else {
+			definition, ok := bundle.Definitions[parameter.Definition]
+			if !ok || definition == nil {
+				return generatedTemplate, fmt.Errorf("Definition %s for parameter %s not found", parameter.Definition, parameterKey)
+			}
+
+			isSensitive := false
+			if definition.WriteOnly != nil && *definition.WriteOnly {
+				isSensitive = true
+			}
+
+			// A parameter without a default that is not required, or is only required by some actions, can be left empty in the template
+			optional := definition.Default == nil && definition.Const == nil && (!parameter.Required || len(parameter.ApplyTo) > 0)
+
+			convert := toARMParameterType
+			if optional {
+				convert = toOptionalARMParameterType
+			}
+
+			parameterType, err := convert(definition, isSensitive)
+			if err != nil {
+				return generatedTemplate, fmt.Errorf("Invalid definition %s for parameter %s: %s", parameter.Definition, parameterKey, err)
+			}
+			parameterType = parameterType.withPattern(options.definitionPatterns[parameter.Definition])
+			armType := parameterType.Type
+
 			var metadata template.Metadata
 			if definition.Description != "" {
 				metadata = template.Metadata{
@@ -104,14 +293,69 @@ func GenerateTemplate(options GenerateTemplateOptions) error {
 				}
 			}
 
-			var allowedValues interface{}
+			notes := parameterType.Notes
+			if len(parameter.ApplyTo) > 0 {
+				notes = append(notes, fmt.Sprintf("applies to actions: %s", strings.Join(parameter.ApplyTo, ", ")))
+			}
+
+			// Sensitive parameters read from Key Vault are passed to the container as the name of the secret
+			if options.KeyVault && isSensitive {
+				generatedTemplate.Parameters[parameterName] = template.NewKeyVaultSecretParameter(parameterKey, definition.Description, parameter.Required && definition.Default == nil)
+
+				paramEnvVar = template.EnvironmentVariable{
+					Name:  common.GetEnvironmentVariableNames().CnabKeyVaultParameterPrefix + parameterName,
+					Value: fmt.Sprintf("[parameters('%s')]", parameterName),
+				}
+
+				if len(parameter.ApplyTo) > 0 {
+					paramEnvVar.Value = getApplyToValue(parameterName, "string", parameter.ApplyTo)
+				}
+
+				if err := generatedTemplate.SetContainerEnvironmentVariable(paramEnvVar); err != nil {
+					return generatedTemplate, err
+				}
+				continue
+			}
+
+			if len(notes) > 0 {
+				if metadata.Description != "" {
+					metadata.Description += " "
+				}
+				metadata.Description += fmt.Sprintf("(%s)", strings.Join(notes, ", "))
+			}
+
+			var enum []interface{}
 			if definition.Enum != nil {
-				allowedValues = definition.Enum
+				enum = definition.Enum
+			} else if definition.Const != nil {
+				enum = []interface{}{definition.Const}
+			}
+
+			var allowedValues interface{}
+			if enum != nil {
+				values := make([]interface{}, 0, len(enum))
+				for _, value := range enum {
+					converted, err := parameterType.convertValue(value)
+					if err != nil {
+						return generatedTemplate, fmt.Errorf("Invalid enum value for parameter %s: %s", parameterKey, err)
+					}
+					values = append(values, converted)
+				}
+				enum = values
+				allowedValues = values
 			}
 
 			var defaultValue interface{}
-			if definition.Default != nil {
-				defaultValue = definition.Default
+			if definition.Default != nil || definition.Const != nil {
+				value := definition.Default
+				if value == nil {
+					value = definition.Const
+				}
+
+				defaultValue, err = parameterType.convertValue(value)
+				if err != nil {
+					return generatedTemplate, fmt.Errorf("Invalid default value for parameter %s: %s", parameterKey, err)
+				}
 
 				// If value is a string starting with square bracket, then we need to escape it
 				// otherwise ARM thinks it is an expression
@@ -119,28 +363,27 @@ func GenerateTemplate(options GenerateTemplateOptions) error {
 					v = "[" + v
 					defaultValue = v
 				}
-			} else {
-				if !parameter.Required {
-					defaultValue = ""
-				}
 			}
 
+			// ARM only allows minValue and maxValue on int parameters, the range of other types is in the description
 			var minValue *int
-			if definition.Minimum != nil {
-				minValue = definition.Minimum
-			}
-			if definition.ExclusiveMinimum != nil {
-				min := *definition.ExclusiveMinimum + 1
-				minValue = &min
-			}
-
 			var maxValue *int
-			if definition.Maximum != nil {
-				maxValue = definition.Maximum
-			}
-			if definition.ExclusiveMaximum != nil {
-				max := *definition.ExclusiveMaximum - 1
-				maxValue = &max
+			if armType == "int" {
+				if definition.Minimum != nil {
+					minValue = definition.Minimum
+				}
+				if definition.ExclusiveMinimum != nil {
+					min := *definition.ExclusiveMinimum + 1
+					minValue = &min
+				}
+
+				if definition.Maximum != nil {
+					maxValue = definition.Maximum
+				}
+				if definition.ExclusiveMaximum != nil {
+					max := *definition.ExclusiveMaximum - 1
+					maxValue = &max
+				}
 			}
 
 			var minLength *int
@@ -153,17 +396,16 @@ func GenerateTemplate(options GenerateTemplateOptions) error {
 				maxLength = definition.MaxLength
 			}
 
-			isSensitive := false
-			if definition.WriteOnly != nil && *definition.WriteOnly {
-				isSensitive = true
-			}
-
-			armType, err := toARMType(definition.Type.(string), isSensitive)
-			if err != nil {
-				return err
+			// Optional parameters default to empty, the driver does not pass empty values of other types or of parameters that do not apply to the action, and Porter checks required values are set for the actions they apply to
+			if optional {
+				defaultValue = ""
+				minLength = nil
+				if enum != nil {
+					allowedValues = append([]interface{}{""}, enum...)
+				}
 			}
 
-			generatedTemplate.Parameters[parameterKey] = template.Parameter{
+			generatedTemplate.Parameters[parameterName] = template.Parameter{
 				Type:          armType,
 				AllowedValues: allowedValues,
 				DefaultValue:  defaultValue,
@@ -175,13 +417,23 @@ func GenerateTemplate(options GenerateTemplateOptions) error {
 			}
 
 			paramEnvVar = template.EnvironmentVariable{
-				Name:  common.GetEnvironmentVariableNames().CnabParameterPrefix + parameterKey,
-				Value: fmt.Sprintf("[parameters('%s')]", parameterKey),
+				Name:  common.GetEnvironmentVariableNames().CnabParameterPrefix + parameterName,
+				Value: fmt.Sprintf("[parameters('%s')]", parameterName),
+			}
+
+			if len(parameter.ApplyTo) > 0 {
+				paramEnvVar.Value = getApplyToValue(parameterName, armType, parameter.ApplyTo)
+			}
+
+			// Sensitive values are not shown in the container properties
+			if isSecureType(armType) {
+				paramEnvVar.SecureValue = paramEnvVar.Value
+				paramEnvVar.Value = ""
 			}
 		}
 
-		if err = generatedTemplate.SetContainerEnvironmentVariable(paramEnvVar); err != nil {
-			return err
+		if err := generatedTemplate.SetContainerEnvironmentVariable(paramEnvVar); err != nil {
+			return generatedTemplate, err
 		}
 	}
 
@@ -195,10 +447,7 @@ func GenerateTemplate(options GenerateTemplateOptions) error {
 	for _, credentialKey := range credentialKeys {
 
 		credential := bundle.Credentials[credentialKey]
-
-		if strings.Contains(credentialKey, "-") {
-			return fmt.Errorf("Invalid Credential name: %s.ARM template generation requires credential names that can be used as environment variables", credentialKey)
-		}
+		credentialName := common.ToSafeName(credentialKey)
 
 		var metadata template.Metadata
 		var description string
@@ -214,9 +463,9 @@ func GenerateTemplate(options GenerateTemplateOptions) error {
 				description += " "
 			}
 			description += "(Enter base64 encoded representation of file)"
-			envVarName = common.GetEnvironmentVariableNames().CnabCredentialFilePrefix + credentialKey
+			envVarName = common.GetEnvironmentVariableNames().CnabCredentialFilePrefix + credentialName
 		} else {
-			envVarName = common.GetEnvironmentVariableNames().CnabCredentialPrefix + credentialKey
+			envVarName = common.GetEnvironmentVariableNames().CnabCredentialPrefix + credentialName
 		}
 
 		if description != "" {
@@ -231,13 +480,26 @@ func GenerateTemplate(options GenerateTemplateOptions) error {
 
 		var credEnvVar template.EnvironmentVariable
 
-		if cnabParam, ok := isCnabParam(credentialKey, generatedTemplate); options.Simplify && ok {
+		if cnabParam, ok := isCnabParam(credentialName, generatedTemplate); options.Simplify && ok {
 			credEnvVar = template.EnvironmentVariable{
 				Name:        envVarName,
 				SecureValue: fmt.Sprintf("[variables('%s')]", cnabParam),
 			}
+		} else if options.KeyVault {
+			// File credentials are stored in Key Vault base64 encoded
+			prefix := common.GetEnvironmentVariableNames().CnabKeyVaultCredentialPrefix
+			if credential.Path != "" {
+				prefix = common.GetEnvironmentVariableNames().CnabKeyVaultCredentialFilePrefix
+			}
+
+			generatedTemplate.Parameters[credentialName] = template.NewKeyVaultSecretParameter(credentialKey, credential.Description, credential.Required)
+
+			credEnvVar = template.EnvironmentVariable{
+				Name:  prefix + credentialName,
+				Value: fmt.Sprintf("[parameters('%s')]", credentialName),
+			}
 		} else {
-			generatedTemplate.Parameters[credentialKey] = template.Parameter{
+			generatedTemplate.Parameters[credentialName] = template.Parameter{
 				Type:         "securestring",
 				Metadata:     &metadata,
 				DefaultValue: defaultValue,
@@ -245,27 +507,110 @@ func GenerateTemplate(options GenerateTemplateOptions) error {
 
 			credEnvVar = template.EnvironmentVariable{
 				Name:        envVarName,
-				SecureValue: fmt.Sprintf("[parameters('%s')]", credentialKey),
+				SecureValue: fmt.Sprintf("[parameters('%s')]", credentialName),
 			}
 		}
 
-		if err = generatedTemplate.SetContainerEnvironmentVariable(credEnvVar); err != nil {
-			return err
+		if err := generatedTemplate.SetContainerEnvironmentVariable(credEnvVar); err != nil {
+			return generatedTemplate, err
 		}
 	}
 
-	var data []byte
-	if options.Indent {
-		data, _ = json.MarshalIndent(generatedTemplate, "", "\t")
-	} else {
-		data, _ = json.Marshal(generatedTemplate)
+	if options.KeyVault {
+		if err := generatedTemplate.AddKeyVault(); err != nil {
+			return generatedTemplate, err
+		}
 	}
 
-	if err := ioutil.WriteFile(options.OutputFile, data, 0644); err != nil {
-		return err
+	// The driver uses the name map to set parameters and credentials using their names in the bundle
+	if !nameMap.IsEmpty() {
+		data, err := json.Marshal(nameMap)
+		if err != nil {
+			return generatedTemplate, fmt.Errorf("Unable to create name map: %s", err)
+		}
+
+		nameMapEnvVar := template.EnvironmentVariable{
+			Name:  common.GetEnvironmentVariableNames().CnabNameMap,
+			Value: string(data),
+		}
+
+		if err := generatedTemplate.SetContainerEnvironmentVariable(nameMapEnvVar); err != nil {
+			return generatedTemplate, err
+		}
 	}
 
-	return nil
+	// Sort outputs, because Go randomizes order when iterating a map
+	var outputKeys []string
+	for outputKey := range bundle.Outputs {
+		outputKeys = append(outputKeys, outputKey)
+	}
+	sort.Strings(outputKeys)
+
+	for _, outputKey := range outputKeys {
+
+		if parameterFilter.IsOutputExcluded(outputKey) {
+			continue
+		}
+
+		output := bundle.Outputs[outputKey]
+		definition, ok := bundle.Definitions[output.Definition]
+		if !ok {
+			return generatedTemplate, fmt.Errorf("Definition %s for output %s not found", output.Definition, outputKey)
+		}
+
+		// Template outputs are visible in the deployment history, so sensitive outputs are not exposed
+		if definition.WriteOnly != nil && *definition.WriteOnly {
+			continue
+		}
+
+		outputType, err := toARMParameterType(definition, false)
+		if err != nil {
+			return generatedTemplate, fmt.Errorf("Invalid definition %s for output %s: %s", output.Definition, outputKey, err)
+		}
+
+		if err := generatedTemplate.AddBundleOutput(outputKey, outputType.Type); err != nil {
+			return generatedTemplate, err
+		}
+	}
+
+	return generatedTemplate, nil
+}
+
+// getNameMap maps the names of bundle parameters and credentials that cannot be used as environment variable names to safe names
+func getNameMap(bundle *bundle.Bundle, parameterFilter ParameterFilter) (common.NameMap, error) {
+	var parameterNames []string
+	for parameterKey := range bundle.Parameters {
+		if !parameterFilter.IsExcluded(parameterKey) {
+			parameterNames = append(parameterNames, parameterKey)
+		}
+	}
+
+	var credentialNames []string
+	for credentialKey := range bundle.Credentials {
+		credentialNames = append(credentialNames, credentialKey)
+	}
+
+	nameMap, err := common.NewNameMap(parameterNames, credentialNames)
+	if err != nil {
+		return nameMap, fmt.Errorf("Invalid parameter or credential name: %s", err)
+	}
+
+	return nameMap, nil
+}
+
+// getApplyToValue gets an expression that sets the parameter value only when the selected action is one of the actions the parameter applies to
+func getApplyToValue(parameterKey string, armType string, applyTo []string) string {
+	actions := make([]string, 0, len(applyTo))
+	for _, action := range applyTo {
+		actions = append(actions, "'"+strings.ReplaceAll(action, "'", "''")+"'")
+	}
+
+	value := fmt.Sprintf("parameters('%s')", parameterKey)
+	if armType != "string" && armType != "securestring" {
+		value = fmt.Sprintf("string(%s)", value)
+	}
+
+	return fmt.Sprintf("[if(contains(createArray(%s), variables('cnab_action')), %s, '')]", strings.Join(actions, ", "), value)
 }
 
 func isCnabParam(parameterKey string, template template.Template) (string, bool) {
@@ -277,42 +622,45 @@ func isCnabParam(parameterKey string, template template.Template) (string, bool)
 	return "", false
 }
 
-func toARMType(jsonType string, isSensitive bool) (string, error) {
-	var armType string
-	var err error
-
-	switch jsonType {
-	case "boolean":
-		armType = "bool"
-		break
-	case "integer":
-		armType = "int"
-		break
-	case "string":
-		if isSensitive {
-			armType = "securestring"
-		} else {
-			armType = "string"
+// getFormats checks the requested output formats, json is used if no format is specified
+func getFormats(formats []string) (generateJSON bool, generateBicep bool, err error) {
+	if len(formats) == 0 {
+		return true, false, nil
+	}
+
+	for _, format := range formats {
+		switch strings.ToLower(strings.TrimSpace(format)) {
+		case FormatJSON:
+			generateJSON = true
+		case FormatBicep:
+			generateBicep = true
+		default:
+			return false, false, fmt.Errorf("Unsupported output format: %s. Supported formats are %s and %s", format, FormatJSON, FormatBicep)
 		}
-		break
-	case "object", "array":
-		armType = jsonType
-		break
-	default:
-		err = fmt.Errorf("Unable to convert type '%s' to ARM template parameter type", jsonType)
 	}
 
-	return armType, err
+	return generateJSON, generateBicep, nil
+}
+
+// getBicepFile gets the file name for the Bicep file by replacing the extension of the output file with .bicep
+func getBicepFile(outputFile string) string {
+	extension := filepath.Ext(outputFile)
+	if extension == ".bicep" {
+		return outputFile
+	}
+
+	return strings.TrimSuffix(outputFile, extension) + ".bicep"
 }
 
-func loadBundle(source string) (*bundle.Bundle, error) {
-	_, err := os.Stat(source)
-	if err == nil {
-		jsonFile, _ := os.Open(source)
-		bundle, err := bundle.ParseReader(jsonFile)
-		return &bundle, err
+func writeJSONFile(dest string, value interface{}, indent bool) error {
+	var data []byte
+	if indent {
+		data, _ = json.MarshalIndent(value, "", "\t")
+	} else {
+		data, _ = json.Marshal(value)
 	}
-	return nil, err
+
+	return ioutil.WriteFile(dest, data, 0644)
 }
 
 func checkOutputFile(dest string, overwrite bool) error {
@@ -1,10 +1,15 @@
 package generator
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/cnabio/cnab-go/bundle"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/armexpr"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/bicep"
 	"gotest.tools/v3/assert"
 )
 
@@ -82,3 +87,580 @@ func TestGenerateSimpleTemplate(t *testing.T) {
 
 	assert.Equal(t, expected, generated)
 }
+
+func TestGenerateUIDefinition(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+
+	bundlePath := "testdata/bundle.json"
+	generatedOutputPath := "testdata/generated/createUiDefinition-generated.json"
+	expectedOutputPath := "testdata/createUiDefinition.json"
+
+	options := GenerateTemplateOptions{
+		BundleLoc:        bundlePath,
+		BundleTag:        "cnabquickstarts.azurecr.io/porter/hello-world/bundle:1.0.0",
+		Indent:           true,
+		OutputFile:       "testdata/generated/azuredeploy-uidefinition-generated.json",
+		UIDefinitionFile: generatedOutputPath,
+		Overwrite:        true,
+		Version:          "latest",
+	}
+
+	err := GenerateTemplate(options)
+	if err != nil {
+		t.Errorf("GenerateTemplate failed: %s", err.Error())
+	}
+
+	expectedBytes, err := ioutil.ReadFile(expectedOutputPath)
+	if err != nil {
+		t.Fatalf("failed reading expected output: %s", err)
+	}
+	expected := string(expectedBytes)
+
+	generatedBytes, err := ioutil.ReadFile(generatedOutputPath)
+	if err != nil {
+		t.Fatalf("failed reading generated output: %s", err)
+	}
+	generated := string(generatedBytes)
+
+	assert.Equal(t, expected, generated)
+}
+
+func TestGenerateBicep(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+
+	bundlePath := "testdata/bundle.json"
+	generatedOutputPath := "testdata/generated/azuredeploy-generated.bicep"
+	expectedOutputPath := "testdata/azuredeploy.bicep"
+
+	options := GenerateTemplateOptions{
+		BundleLoc:  bundlePath,
+		BundleTag:  "cnabquickstarts.azurecr.io/porter/hello-world/bundle:1.0.0",
+		OutputFile: "testdata/generated/azuredeploy-generated.json",
+		Overwrite:  true,
+		Version:    "latest",
+		Formats:    []string{FormatBicep},
+	}
+
+	err := GenerateTemplate(options)
+	if err != nil {
+		t.Errorf("GenerateTemplate failed: %s", err.Error())
+	}
+
+	expectedBytes, err := ioutil.ReadFile(expectedOutputPath)
+	if err != nil {
+		t.Fatalf("failed reading expected output: %s", err)
+	}
+	expected := string(expectedBytes)
+
+	generatedBytes, err := ioutil.ReadFile(generatedOutputPath)
+	if err != nil {
+		t.Fatalf("failed reading generated output: %s", err)
+	}
+	generated := string(generatedBytes)
+
+	assert.Equal(t, expected, generated)
+}
+
+func TestGenerateInvalidFormat(t *testing.T) {
+
+	options := GenerateTemplateOptions{
+		BundleLoc:  "testdata/bundle.json",
+		BundleTag:  "cnabquickstarts.azurecr.io/porter/hello-world/bundle:1.0.0",
+		OutputFile: "testdata/generated/azuredeploy-invalid-format.json",
+		Overwrite:  true,
+		Formats:    []string{"yaml"},
+	}
+
+	err := GenerateTemplate(options)
+	assert.ErrorContains(t, err, "Unsupported output format: yaml")
+}
+
+func TestGenerateTemplateWithApplyTo(t *testing.T) {
+
+	applyToBundle, err := bundle.Unmarshal([]byte(`{
+		"name": "applyto",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/applyto:0.1.0"}],
+		"definitions": {
+			"string": {"type": "string"},
+			"port": {"type": "integer", "minimum": 1},
+			"debug": {"type": "boolean"},
+			"tags": {"type": "object"}
+		},
+		"parameters": {
+			"name": {"definition": "string", "required": true, "applyTo": ["install", "upgrade"]},
+			"port": {"definition": "port", "applyTo": ["upgrade"], "description": "The port"},
+			"debug": {"definition": "debug", "required": true, "applyTo": ["install"]},
+			"tags": {"definition": "tags"},
+			"replicas": {"definition": "port", "required": true}
+		}
+	}`))
+	assert.NilError(t, err)
+
+	generatedTemplate, err := generateTemplate(applyToBundle, "example/applyto:0.1.0", GenerateTemplateOptions{Version: "latest"})
+	assert.NilError(t, err)
+
+	name := generatedTemplate.Parameters["name"]
+	assert.Equal(t, name.Type, "string")
+	assert.Equal(t, name.DefaultValue, "")
+	assert.Equal(t, name.Metadata.Description, "(applies to actions: install, upgrade)")
+
+	// Optional parameters that are not strings are passed as strings so they can be empty
+	port := generatedTemplate.Parameters["port"]
+	assert.Equal(t, port.Type, "string")
+	assert.Equal(t, port.DefaultValue, "")
+	assert.Assert(t, port.MinValue == nil)
+	assert.Equal(t, port.Metadata.Description, "(integer, minimum 1, applies to actions: upgrade)")
+
+	debug := generatedTemplate.Parameters["debug"]
+	assert.Equal(t, debug.Type, "string")
+	assert.Equal(t, debug.DefaultValue, "")
+	assert.Equal(t, debug.Metadata.Description, "(boolean, applies to actions: install)")
+
+	tags := generatedTemplate.Parameters["tags"]
+	assert.Equal(t, tags.Type, "string")
+	assert.Equal(t, tags.DefaultValue, "")
+	assert.Equal(t, tags.Metadata.Description, "(JSON object)")
+
+	replicas := generatedTemplate.Parameters["replicas"]
+	assert.Equal(t, replicas.Type, "int")
+	assert.Equal(t, replicas.DefaultValue, nil)
+	assert.Equal(t, *replicas.MinValue, 1)
+
+	data, err := json.Marshal(generatedTemplate)
+	assert.NilError(t, err)
+	text := string(data)
+
+	assert.Assert(t, strings.Contains(text, `"value":"[if(contains(createArray('install', 'upgrade'), variables('cnab_action')), parameters('name'), '')]"`))
+	assert.Assert(t, strings.Contains(text, `"value":"[if(contains(createArray('upgrade'), variables('cnab_action')), parameters('port'), '')]"`))
+	assert.Assert(t, strings.Contains(text, `"value":"[parameters('replicas')]"`))
+}
+
+func TestGenerateTemplateWithOutputs(t *testing.T) {
+
+	outputsBundle, err := bundle.Unmarshal([]byte(`{
+		"name": "outputs",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/outputs:0.1.0"}],
+		"definitions": {
+			"string": {"type": "string"},
+			"port": {"type": "integer"},
+			"password": {"type": "string", "writeOnly": true}
+		},
+		"outputs": {
+			"host": {"definition": "string"},
+			"port": {"definition": "port"},
+			"password": {"definition": "password"},
+			"porter-state": {"definition": "string"}
+		}
+	}`))
+	assert.NilError(t, err)
+
+	generatedTemplate, err := generateTemplate(outputsBundle, "example/outputs:0.1.0", GenerateTemplateOptions{Version: "latest"})
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(generatedTemplate.Outputs), 3)
+	assert.Equal(t, generatedTemplate.Outputs["host"].Type, "string")
+	assert.Equal(t, generatedTemplate.Outputs["host"].Value, "[if(contains(reference(variables('cnab_outputs_script_name')).outputs, 'host'), reference(variables('cnab_outputs_script_name')).outputs['host'], '')]")
+	assert.Equal(t, generatedTemplate.Outputs["port"].Type, "int")
+	assert.Equal(t, generatedTemplate.Outputs["port"].Value, "[if(contains(reference(variables('cnab_outputs_script_name')).outputs, 'port'), int(reference(variables('cnab_outputs_script_name')).outputs['port']), 0)]")
+
+	scripts := 0
+	for _, resource := range generatedTemplate.Resources {
+		if resource.Type == "Microsoft.Resources/deploymentScripts" {
+			scripts++
+		}
+	}
+	assert.Equal(t, scripts, 1)
+
+	_, ok := generatedTemplate.Parameters["cnab_outputs_id"]
+	assert.Assert(t, ok)
+
+	data, err := json.Marshal(generatedTemplate)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(data), `{"name":"CNAB_OUTPUTS_BLOB","value":"[variables('cnab_outputs_blob')]"}`))
+}
+
+func TestGenerateTemplateWithStatelessAction(t *testing.T) {
+
+	actionsBundle, err := bundle.Unmarshal([]byte(`{
+		"name": "actions",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/actions:0.1.0"}],
+		"actions": {
+			"status": {"description": "Reports the status", "stateless": true},
+			"backup": {"description": "Backs up the database", "modifies": true}
+		}
+	}`))
+	assert.NilError(t, err)
+
+	generatedTemplate, err := generateTemplate(actionsBundle, "example/actions:0.1.0", GenerateTemplateOptions{Version: "latest"})
+	assert.NilError(t, err)
+
+	action := generatedTemplate.Parameters["cnab_action"]
+	assert.DeepEqual(t, action.AllowedValues, []string{"install", "upgrade", "uninstall", "backup", "status"})
+	assert.Equal(t, action.Metadata.Description, "The name of the action to be performed on the application instance. Custom actions: backup - Backs up the database; status - Reports the status (stateless, does not modify resources).")
+
+	assert.Equal(t, generatedTemplate.Variables["cnab_stateful_action"], "[not(contains(createArray('status'), variables('cnab_action')))]")
+	for _, resource := range generatedTemplate.Resources {
+		if strings.HasPrefix(resource.Type, "Microsoft.Storage/") {
+			assert.Equal(t, resource.Condition, "[variables('cnab_stateful_action')]")
+		}
+	}
+
+	data, err := json.Marshal(generatedTemplate)
+	assert.NilError(t, err)
+	text := string(data)
+
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_AZURE_STATE_FILESHARE","value":"[if(variables('cnab_stateful_action'), variables('cnab_azure_state_fileshare'), '')]"}`))
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_ACTION_STATELESS","value":"[string(not(variables('cnab_stateful_action')))]"}`))
+}
+
+func TestGenerateTemplateWithMissingDefinition(t *testing.T) {
+
+	missingBundle, err := bundle.Unmarshal([]byte(`{
+		"name": "missing",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/missing:0.1.0"}],
+		"parameters": {
+			"name": {"definition": "name"}
+		}
+	}`))
+	assert.NilError(t, err)
+
+	_, err = generateTemplate(missingBundle, "example/missing:0.1.0", GenerateTemplateOptions{Version: "latest"})
+	assert.ErrorContains(t, err, "Definition name for parameter name not found")
+}
+
+func TestGenerateTemplateWithHyphenatedNames(t *testing.T) {
+
+	namesBundle, err := bundle.Unmarshal([]byte(`{
+		"name": "names",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/names:0.1.0"}],
+		"definitions": {
+			"string": {"type": "string"}
+		},
+		"parameters": {
+			"db-name": {"definition": "string", "default": "db"}
+		},
+		"credentials": {
+			"db-password": {"env": "DB_PASSWORD"}
+		}
+	}`))
+	assert.NilError(t, err)
+
+	generatedTemplate, err := generateTemplate(namesBundle, "example/names:0.1.0", GenerateTemplateOptions{Version: "latest"})
+	assert.NilError(t, err)
+
+	_, ok := generatedTemplate.Parameters["db_name"]
+	assert.Assert(t, ok)
+	_, ok = generatedTemplate.Parameters["db_password"]
+	assert.Assert(t, ok)
+
+	data, err := json.Marshal(generatedTemplate)
+	assert.NilError(t, err)
+	text := string(data)
+
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_PARAM_db_name","value":"[parameters('db_name')]"}`))
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_CRED_db_password","secureValue":"[parameters('db_password')]"}`))
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_NAME_MAP","value":"{\"parameters\":{\"db_name\":\"db-name\"},\"credentials\":{\"db_password\":\"db-password\"}}"}`))
+}
+
+func TestGenerateTemplateWithNameCollision(t *testing.T) {
+
+	namesBundle, err := bundle.Unmarshal([]byte(`{
+		"name": "names",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/names:0.1.0"}],
+		"definitions": {
+			"string": {"type": "string"}
+		},
+		"parameters": {
+			"db-name": {"definition": "string"},
+			"db_name": {"definition": "string"}
+		}
+	}`))
+	assert.NilError(t, err)
+
+	_, err = generateTemplate(namesBundle, "example/names:0.1.0", GenerateTemplateOptions{Version: "latest"})
+	assert.ErrorContains(t, err, "db-name and db_name both map to the name db_name")
+}
+
+func TestGenerateTemplateWithKeyVault(t *testing.T) {
+
+	secretsBundle, err := bundle.Unmarshal([]byte(`{
+		"name": "secrets",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/secrets:0.1.0"}],
+		"definitions": {
+			"string": {"type": "string"},
+			"password": {"type": "string", "writeOnly": true, "description": "The database password"}
+		},
+		"parameters": {
+			"db-name": {"definition": "string", "default": "db"},
+			"db-password": {"definition": "password", "required": true}
+		},
+		"credentials": {
+			"token": {"env": "TOKEN", "required": true},
+			"kubeconfig": {"path": "/root/.kube/config"}
+		}
+	}`))
+	assert.NilError(t, err)
+
+	generatedTemplate, err := generateTemplate(secretsBundle, "example/secrets:0.1.0", GenerateTemplateOptions{Version: "latest", KeyVault: true})
+	assert.NilError(t, err)
+
+	password := generatedTemplate.Parameters["db_password"]
+	assert.Equal(t, password.Type, "string")
+	assert.Equal(t, password.DefaultValue, "db-password")
+	assert.Equal(t, password.Metadata.Description, "The database password (name of the Key Vault secret containing the value)")
+
+	assert.Equal(t, generatedTemplate.Parameters["token"].Type, "string")
+	assert.Equal(t, generatedTemplate.Parameters["token"].DefaultValue, "token")
+	assert.Equal(t, generatedTemplate.Parameters["kubeconfig"].DefaultValue, "")
+	assert.Equal(t, generatedTemplate.Parameters["db_name"].Type, "string")
+
+	_, ok := generatedTemplate.Parameters["cnab_key_vault_name"]
+	assert.Assert(t, ok)
+
+	data, err := json.Marshal(generatedTemplate)
+	assert.NilError(t, err)
+	text := string(data)
+
+	assert.Assert(t, strings.Contains(text, `"identity":{"type":"UserAssigned","userAssignedIdentities":{"[parameters('cnab_key_vault_identity')]":{}}}`))
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_KEYVAULT_PARAM_db_password","value":"[parameters('db_password')]"}`))
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_KEYVAULT_CRED_token","value":"[parameters('token')]"}`))
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_KEYVAULT_CRED_FILE_kubeconfig","value":"[parameters('kubeconfig')]"}`))
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_KEYVAULT_CLIENT_ID","value":"[reference(parameters('cnab_key_vault_identity'), '2018-11-30').clientId]"}`))
+	assert.Assert(t, !strings.Contains(text, `CNAB_CRED_`))
+
+	bicep, err := bicep.Render(generatedTemplate)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(bicep), `'${cnab_key_vault_identity}': {}`))
+}
+
+func TestGenerateTemplateWithManagedIdentity(t *testing.T) {
+
+	identityBundle, err := bundle.Unmarshal([]byte(`{
+		"name": "identity",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/identity:0.1.0"}]
+	}`))
+	assert.NilError(t, err)
+
+	generatedTemplate, err := generateTemplate(identityBundle, "example/identity:0.1.0", GenerateTemplateOptions{Version: "latest", ManagedIdentity: "user", KeyVault: true})
+	assert.NilError(t, err)
+
+	_, ok := generatedTemplate.Parameters["cnab_azure_client_secret"]
+	assert.Assert(t, !ok)
+	assert.Equal(t, generatedTemplate.Parameters["cnab_azure_role_definition_id"].DefaultValue, "b24988ac-6180-42a0-ab88-20f7382dd24c")
+
+	data, err := json.Marshal(generatedTemplate)
+	assert.NilError(t, err)
+	text := string(data)
+
+	assert.Assert(t, !strings.Contains(text, "CNAB_AZURE_CLIENT_SECRET"))
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_AZURE_MSI_TYPE","value":"user"}`))
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_AZURE_RESOURCE_GROUP","value":"[resourceGroup().name]"}`))
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_AZURE_USER_MSI_RESOURCE_ID","value":"[resourceId('Microsoft.ManagedIdentity/userAssignedIdentities', variables('cnab_azure_identity_name'))]"}`))
+	assert.Assert(t, strings.Contains(text, `"identity":{"type":"UserAssigned","userAssignedIdentities":{"[parameters('cnab_key_vault_identity')]":{},"[resourceId('Microsoft.ManagedIdentity/userAssignedIdentities', variables('cnab_azure_identity_name'))]":{}}}`))
+	assert.Assert(t, strings.Contains(text, `"principalId":"[reference(resourceId('Microsoft.ManagedIdentity/userAssignedIdentities', variables('cnab_azure_identity_name')), '2018-11-30').principalId]"`))
+
+	_, err = generateTemplate(identityBundle, "example/identity:0.1.0", GenerateTemplateOptions{Version: "latest", ManagedIdentity: "system"})
+	assert.ErrorContains(t, err, "Unsupported managed identity type system, must be user")
+
+	_, err = generateTemplate(identityBundle, "example/identity:0.1.0", GenerateTemplateOptions{Version: "latest", ManagedIdentity: "both"})
+	assert.ErrorContains(t, err, "Unsupported managed identity type both, must be user")
+}
+
+func TestGenerateTemplateWithRunner(t *testing.T) {
+
+	runnerBundle, err := bundle.Unmarshal([]byte(`{
+		"name": "runner",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/runner:0.1.0"}]
+	}`))
+	assert.NilError(t, err)
+
+	generatedTemplate, err := generateTemplate(runnerBundle, "example/runner:0.1.0", GenerateTemplateOptions{Version: "latest", Runner: "cnab"})
+	assert.NilError(t, err)
+
+	data, err := json.Marshal(generatedTemplate)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(data), `{"name":"CNAB_RUNNER","value":"cnab"}`))
+
+	_, err = generateTemplate(runnerBundle, "example/runner:0.1.0", GenerateTemplateOptions{Version: "latest", Runner: "docker"})
+	assert.ErrorContains(t, err, "Unsupported runner docker, must be porter or cnab")
+}
+
+func TestGenerateTemplateWithConfigFile(t *testing.T) {
+
+	configBundle, err := bundle.Unmarshal([]byte(`{
+		"name": "config",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/config:0.1.0"}]
+	}`))
+	assert.NilError(t, err)
+
+	generatedTemplate, err := generateTemplate(configBundle, "example/config:0.1.0", GenerateTemplateOptions{Version: "latest", ConfigFile: true})
+	assert.NilError(t, err)
+
+	assert.Equal(t, generatedTemplate.Parameters["cnab_config_file"].Type, "securestring")
+
+	data, err := json.Marshal(generatedTemplate)
+	assert.NilError(t, err)
+	text := string(data)
+
+	assert.Assert(t, strings.Contains(text, `"volumes":[{"name":"cnab-config","secret":{"config":"[base64(parameters('cnab_config_file'))]"}}]`))
+	assert.Assert(t, strings.Contains(text, `"volumeMounts":[{"name":"cnab-config","mountPath":"/cnab/config","readOnly":true}]`))
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_CONFIG_FILE","value":"/cnab/config/config"}`))
+
+	bicepData, err := bicep.Render(generatedTemplate)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(bicepData), "base64(cnab_config_file)"))
+}
+
+func TestGenerateTemplateWithPattern(t *testing.T) {
+
+	patternBundle, patterns, err := unmarshalBundle([]byte(`{
+		"name": "pattern",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/pattern:0.1.0"}],
+		"definitions": {
+			"name": {"type": "string", "description": "The name", "pattern": "^[a-z]+$"}
+		},
+		"parameters": {
+			"name": {"definition": "name", "required": true}
+		}
+	}`))
+	assert.NilError(t, err)
+
+	generatedTemplate, err := generateTemplate(patternBundle, "example/pattern:0.1.0", GenerateTemplateOptions{Version: "latest", definitionPatterns: patterns})
+	assert.NilError(t, err)
+
+	assert.Equal(t, generatedTemplate.Parameters["name"].Metadata.Description, "The name (pattern: ^[a-z]+$)")
+}
+
+func TestGenerateTemplateWithLogs(t *testing.T) {
+
+	logsBundle, err := bundle.Unmarshal([]byte(`{
+		"name": "logs",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/logs:0.1.0"}]
+	}`))
+	assert.NilError(t, err)
+
+	generatedTemplate, err := generateTemplate(logsBundle, "example/logs:0.1.0", GenerateTemplateOptions{Version: "latest", LogFormat: "json", LogSink: "loganalytics"})
+	assert.NilError(t, err)
+
+	assert.Equal(t, generatedTemplate.Parameters["cnab_log_analytics_workspace"].Type, "string")
+
+	data, err := json.Marshal(generatedTemplate)
+	assert.NilError(t, err)
+	text := string(data)
+
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_LOG_FORMAT","value":"json"}`))
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_LOG_ANALYTICS_WORKSPACE_ID","value":"[reference(parameters('cnab_log_analytics_workspace'), '2020-08-01').customerId]"}`))
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_LOG_ANALYTICS_KEY","secureValue":"[listKeys(parameters('cnab_log_analytics_workspace'), '2020-08-01').primarySharedKey]"}`))
+
+	generatedTemplate, err = generateTemplate(logsBundle, "example/logs:0.1.0", GenerateTemplateOptions{Version: "latest", LogSink: "http"})
+	assert.NilError(t, err)
+
+	assert.Equal(t, generatedTemplate.Parameters["cnab_log_sink_url"].Type, "securestring")
+
+	data, err = json.Marshal(generatedTemplate)
+	assert.NilError(t, err)
+	text = string(data)
+
+	assert.Assert(t, strings.Contains(text, `{"name":"CNAB_LOG_SINK_URL","secureValue":"[parameters('cnab_log_sink_url')]"}`))
+	assert.Assert(t, !strings.Contains(text, "CNAB_LOG_FORMAT"))
+
+	_, err = generateTemplate(logsBundle, "example/logs:0.1.0", GenerateTemplateOptions{Version: "latest", LogFormat: "xml"})
+	assert.Error(t, err, "Unsupported log format xml, must be text or json")
+
+	_, err = generateTemplate(logsBundle, "example/logs:0.1.0", GenerateTemplateOptions{Version: "latest", LogSink: "syslog"})
+	assert.Error(t, err, "Unsupported log sink syslog, must be http or loganalytics")
+}
+
+func TestGeneratedEnvironmentVariables(t *testing.T) {
+
+	applyToBundle, err := bundle.Unmarshal([]byte(`{
+		"name": "applyto",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/applyto:0.1.0"}],
+		"definitions": {
+			"port": {"type": "integer"},
+			"debug": {"type": "boolean"}
+		},
+		"parameters": {
+			"port": {"definition": "port", "applyTo": ["upgrade"]},
+			"debug": {"definition": "debug", "default": false}
+		}
+	}`))
+	assert.NilError(t, err)
+
+	generatedTemplate, err := generateTemplate(applyToBundle, "example/applyto:0.1.0", GenerateTemplateOptions{Version: "latest"})
+	assert.NilError(t, err)
+
+	evaluate := func(action string) map[string]interface{} {
+		ctx := &armexpr.Context{
+			SubscriptionID:    "11111111-1111-1111-1111-111111111111",
+			TenantID:          "22222222-2222-2222-2222-222222222222",
+			ResourceGroupName: "test-rg",
+			Location:          "westeurope",
+			Parameters: map[string]interface{}{
+				"cnab_action":              action,
+				"cnab_installation_name":   "test",
+				"cnab_azure_client_id":     "client",
+				"cnab_azure_client_secret": "secret",
+				"port":                     "8080",
+				"debug":                    true,
+			},
+			ParameterDefaults: map[string]interface{}{},
+			Variables:         map[string]interface{}{},
+		}
+		for name, parameter := range generatedTemplate.Parameters {
+			if parameter.DefaultValue != nil {
+				ctx.ParameterDefaults[name] = parameter.DefaultValue
+			}
+		}
+		for name, value := range generatedTemplate.Variables {
+			ctx.Variables[name] = value
+		}
+
+		values := map[string]interface{}{}
+		for _, environmentVariable := range getContainerEnvironmentVariables(generatedTemplate) {
+			value, err := armexpr.EvaluateTemplateString(environmentVariable.Value+environmentVariable.SecureValue, ctx)
+			assert.NilError(t, err, environmentVariable.Name)
+			values[environmentVariable.Name] = value
+		}
+		return values
+	}
+
+	values := evaluate("upgrade")
+	assert.Equal(t, values["CNAB_ACTION"], "upgrade")
+	assert.Equal(t, values["CNAB_INSTALLATION_NAME"], "test")
+	assert.Equal(t, values["CNAB_PARAM_port"], "8080")
+	assert.Equal(t, values["CNAB_PARAM_debug"], true)
+	assert.Equal(t, values["CNAB_AZURE_LOCATION"], "westeurope")
+	assert.Equal(t, values["CNAB_AZURE_CLIENT_SECRET"], "secret")
+
+	values = evaluate("install")
+	assert.Equal(t, values["CNAB_PARAM_port"], "")
+}
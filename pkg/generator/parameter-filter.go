@@ -0,0 +1,129 @@
+package generator
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cnabio/cnab-go/bundle"
+)
+
+const (
+	// ParameterProfilePorter excludes the parameters Porter adds to bundles
+	ParameterProfilePorter = "porter"
+
+	// ParameterProfileDuffle excludes the parameters Duffle adds to bundles
+	ParameterProfileDuffle = "duffle"
+
+	// ParameterProfileCNAB does not exclude any parameters
+	ParameterProfileCNAB = "cnab"
+)
+
+// parameterProfile is the glob patterns of the internal parameters and outputs added to bundles by a tool
+type parameterProfile struct {
+	parameters []string
+	outputs    []string
+}
+
+// parameterProfiles are the internal parameters and outputs added to bundles by each tool
+var parameterProfiles = map[string]parameterProfile{
+	// porter-debug is added automatically so can only be modified by updating porter, porter-*-output parameters are added automatically and should not be manually edited
+	// porter-* outputs are used internally by porter
+	ParameterProfilePorter: {
+		parameters: []string{"porter-debug", "porter-*-output"},
+		outputs:    []string{"porter-*"},
+	},
+	// Duffle does not add any parameters or outputs to the bundles it builds
+	ParameterProfileDuffle: {},
+	ParameterProfileCNAB:   {},
+}
+
+// ParameterFilter decides which bundle parameters and outputs are exposed in the template
+type ParameterFilter struct {
+	exclude        []string
+	include        []string
+	excludeOutputs []string
+}
+
+// NewParameterFilter creates a ParameterFilter that excludes the internal parameters of the profile and parameters matching the exclude globs, parameters matching the include globs are always exposed
+func NewParameterFilter(profile string, include []string, exclude []string) (ParameterFilter, error) {
+	var filter ParameterFilter
+
+	if profile == "" {
+		profile = ParameterProfilePorter
+	}
+
+	profileFilter, ok := parameterProfiles[strings.ToLower(profile)]
+	if !ok {
+		return filter, fmt.Errorf("Unknown parameter profile %s, must be one of %s", profile, strings.Join(GetParameterProfiles(), ", "))
+	}
+
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return filter, fmt.Errorf("Invalid parameter pattern %s: %s", pattern, err)
+		}
+	}
+
+	filter.exclude = append(append([]string{}, profileFilter.parameters...), exclude...)
+	filter.include = append([]string{}, include...)
+	filter.excludeOutputs = append([]string{}, profileFilter.outputs...)
+
+	return filter, nil
+}
+
+// GetParameterProfiles gets the names of the built-in parameter profiles
+func GetParameterProfiles() []string {
+	profiles := make([]string, 0, len(parameterProfiles))
+	for profile := range parameterProfiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// IsExcluded checks if a bundle parameter should not be exposed in the template
+func (filter ParameterFilter) IsExcluded(parameterKey string) bool {
+	if matchesAny(parameterKey, filter.include) {
+		return false
+	}
+	return matchesAny(parameterKey, filter.exclude)
+}
+
+// IsOutputExcluded checks if a bundle output should not be exposed as a template output, only the internal outputs of the profile are excluded
+func (filter ParameterFilter) IsOutputExcluded(outputKey string) bool {
+	return matchesAny(outputKey, filter.excludeOutputs)
+}
+
+// CheckBundle checks that the filter does not exclude any parameters of the bundle that must be set, i.e. required parameters without a default value
+func (filter ParameterFilter) CheckBundle(bundle *bundle.Bundle) error {
+	var parameterKeys []string
+	for parameterKey := range bundle.Parameters {
+		parameterKeys = append(parameterKeys, parameterKey)
+	}
+	sort.Strings(parameterKeys)
+
+	for _, parameterKey := range parameterKeys {
+		parameter := bundle.Parameters[parameterKey]
+		if !parameter.Required || !filter.IsExcluded(parameterKey) {
+			continue
+		}
+
+		if definition, ok := bundle.Definitions[parameter.Definition]; ok && definition.Default != nil {
+			continue
+		}
+
+		return fmt.Errorf("Parameter %s is required and has no default value so it cannot be excluded from the template", parameterKey)
+	}
+
+	return nil
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if match, _ := path.Match(pattern, name); match {
+			return true
+		}
+	}
+	return false
+}
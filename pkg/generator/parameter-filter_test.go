@@ -0,0 +1,109 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/cnabio/cnab-go/bundle"
+	"gotest.tools/v3/assert"
+)
+
+func TestParameterFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  string
+		include  []string
+		exclude  []string
+		excluded []string
+		exposed  []string
+		// outputs are the outputs that are excluded
+		outputs []string
+	}{
+		{
+			name:     "default",
+			excluded: []string{"porter-debug", "porter-mysql-password-output"},
+			exposed:  []string{"mysql-password", "porter-state"},
+			outputs:  []string{"porter-state"},
+		},
+		{
+			name:    "cnab",
+			profile: "cnab",
+			exposed: []string{"porter-debug", "porter-mysql-password-output"},
+		},
+		{
+			name:     "duffle",
+			profile:  "Duffle",
+			exclude:  []string{"internal-*"},
+			excluded: []string{"internal-debug"},
+			exposed:  []string{"porter-debug", "debug"},
+		},
+		{
+			name:     "include",
+			profile:  "porter",
+			include:  []string{"porter-debug"},
+			excluded: []string{"porter-mysql-password-output"},
+			exposed:  []string{"porter-debug"},
+			outputs:  []string{"porter-state"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := NewParameterFilter(test.profile, test.include, test.exclude)
+			assert.NilError(t, err)
+
+			for _, name := range test.excluded {
+				assert.Assert(t, filter.IsExcluded(name), name)
+			}
+			for _, name := range test.exposed {
+				assert.Assert(t, !filter.IsExcluded(name), name)
+			}
+			for _, name := range []string{"porter-state", "message"} {
+				assert.Equal(t, filter.IsOutputExcluded(name), contains(test.outputs, name), name)
+			}
+		})
+	}
+}
+
+func TestParameterFilterErrors(t *testing.T) {
+	_, err := NewParameterFilter("helm", nil, nil)
+	assert.ErrorContains(t, err, "Unknown parameter profile helm, must be one of cnab, duffle, porter")
+
+	_, err = NewParameterFilter("", nil, []string{"[a-"})
+	assert.ErrorContains(t, err, "Invalid parameter pattern [a-")
+}
+
+func TestParameterFilterCheckBundle(t *testing.T) {
+	requiredBundle, err := bundle.Unmarshal([]byte(`{
+		"name": "required",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/required:0.1.0"}],
+		"definitions": {
+			"string": {"type": "string"},
+			"defaulted": {"type": "string", "default": "foo"}
+		},
+		"parameters": {
+			"internal-name": {"definition": "string", "required": true},
+			"internal-region": {"definition": "defaulted", "required": true},
+			"internal-debug": {"definition": "string"}
+		}
+	}`))
+	assert.NilError(t, err)
+
+	filter, err := NewParameterFilter("cnab", nil, []string{"internal-*"})
+	assert.NilError(t, err)
+	assert.Error(t, filter.CheckBundle(requiredBundle), "Parameter internal-name is required and has no default value so it cannot be excluded from the template")
+
+	filter, err = NewParameterFilter("cnab", []string{"internal-name"}, []string{"internal-*"})
+	assert.NilError(t, err)
+	assert.NilError(t, filter.CheckBundle(requiredBundle))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,312 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cnabio/cnab-go/credentials"
+	"github.com/cnabio/cnab-go/valuesource"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/armexpr"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/template"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	deploymentParametersSchema = "https://schema.management.azure.com/schemas/2019-04-01/deploymentParameters.json#"
+	secretSourceKey            = "secret"
+)
+
+// GenerateParametersOptions is the set of options for configuring GenerateParameters
+type GenerateParametersOptions struct {
+	// TemplateFile is the ARM template generated for the bundle
+	TemplateFile string
+	// ParameterSetFile is a Porter/CNAB parameter set in JSON or YAML
+	ParameterSetFile string
+	// CredentialSetFile is a Porter/CNAB credential set in JSON or YAML
+	CredentialSetFile string
+	// KeyVaultID is the resource id of the Key Vault that credentials are referenced from, if not set credential values are resolved locally
+	KeyVaultID string
+	OutputFile string
+	Overwrite  bool
+	Indent     bool
+}
+
+// DeploymentParameters defines an ARM template parameters file
+type DeploymentParameters struct {
+	Schema         string                         `json:"$schema"`
+	ContentVersion string                         `json:"contentVersion"`
+	Parameters     map[string]DeploymentParameter `json:"parameters"`
+}
+
+// DeploymentParameter defines the value of a parameter in an ARM template parameters file, either a value or a Key Vault reference
+type DeploymentParameter struct {
+	Value     interface{}        `json:"value,omitempty"`
+	Reference *KeyVaultReference `json:"reference,omitempty"`
+}
+
+// KeyVaultReference defines a reference to a Key Vault secret in an ARM template parameters file
+type KeyVaultReference struct {
+	KeyVault      KeyVault `json:"keyVault"`
+	SecretName    string   `json:"secretName"`
+	SecretVersion string   `json:"secretVersion,omitempty"`
+}
+
+// KeyVault identifies the Key Vault in a KeyVaultReference
+type KeyVault struct {
+	ID string `json:"id"`
+}
+
+// GenerateParameters generates an ARM template parameters file from a parameter set and credential set
+func GenerateParameters(options GenerateParametersOptions) error {
+	if options.ParameterSetFile == "" && options.CredentialSetFile == "" {
+		return fmt.Errorf("A parameter set or credential set must be specified")
+	}
+
+	if err := checkOutputFile(options.OutputFile, options.Overwrite); err != nil {
+		return err
+	}
+
+	generatedTemplate, err := readTemplateFile(options.TemplateFile)
+	if err != nil {
+		return err
+	}
+
+	deploymentParameters := DeploymentParameters{
+		Schema:         deploymentParametersSchema,
+		ContentVersion: "1.0.0.0",
+		Parameters:     map[string]DeploymentParameter{},
+	}
+
+	if options.ParameterSetFile != "" {
+		var parameterSet common.ParameterSet
+		if err := readSetFile(options.ParameterSetFile, &parameterSet); err != nil {
+			return err
+		}
+
+		for _, strategy := range parameterSet.Parameters {
+			parameter, err := toDeploymentParameter(strategy, generatedTemplate, false, options.KeyVaultID)
+			if err != nil {
+				return fmt.Errorf("Unable to set parameter %s: %s", strategy.Name, err)
+			}
+			deploymentParameters.Parameters[common.ToSafeName(strategy.Name)] = parameter
+		}
+	}
+
+	// Templates that read secrets from Key Vault take the name of the vault
+	if _, ok := generatedTemplate.Parameters[template.KeyVaultNameParameterName]; ok && options.KeyVaultID != "" {
+		segments := strings.Split(strings.TrimSuffix(options.KeyVaultID, "/"), "/")
+		deploymentParameters.Parameters[template.KeyVaultNameParameterName] = DeploymentParameter{Value: segments[len(segments)-1]}
+	}
+
+	if options.CredentialSetFile != "" {
+		var credentialSet credentials.CredentialSet
+		if err := readSetFile(options.CredentialSetFile, &credentialSet); err != nil {
+			return err
+		}
+
+		for _, strategy := range credentialSet.Credentials {
+			parameter, err := toDeploymentParameter(strategy, generatedTemplate, true, options.KeyVaultID)
+			if err != nil {
+				return fmt.Errorf("Unable to set credential %s: %s", strategy.Name, err)
+			}
+			deploymentParameters.Parameters[common.ToSafeName(strategy.Name)] = parameter
+		}
+	}
+
+	return writeJSONFile(options.OutputFile, deploymentParameters, options.Indent)
+}
+
+// toDeploymentParameter converts a parameter or credential value source to a value, or a Key Vault reference for credentials and secrets when a Key Vault is specified
+// Bundle names that are not valid environment variable names are mapped to the safe names used by the template
+func toDeploymentParameter(strategy valuesource.Strategy, generatedTemplate template.Template, isCredential bool, keyVaultID string) (DeploymentParameter, error) {
+	parameter, ok := generatedTemplate.Parameters[common.ToSafeName(strategy.Name)]
+	if !ok {
+		return DeploymentParameter{}, fmt.Errorf("The template does not have a parameter named %s", strategy.Name)
+	}
+
+	// Key Vault secret names can only contain alphanumeric characters and dashes
+	secretName := template.KeyVaultSecretName(strategy.Name)
+	if strategy.Source.Key == secretSourceKey {
+		secretName = strategy.Source.Value
+	}
+
+	environmentVariable, _ := getEnvironmentVariableName(common.ToSafeName(strategy.Name), generatedTemplate)
+
+	// Templates generated in Key Vault mode read the secret in the container, so the parameter is the name of the secret
+	if isKeyVaultEnvironmentVariable(environmentVariable) {
+		if keyVaultID == "" {
+			return DeploymentParameter{}, fmt.Errorf("The template reads the value from Key Vault, a Key Vault must be specified")
+		}
+
+		return DeploymentParameter{Value: secretName}, nil
+	}
+
+	if keyVaultID != "" && (isCredential || strategy.Source.Key == secretSourceKey) {
+		if !strings.EqualFold(parameter.Type, "securestring") {
+			return DeploymentParameter{}, fmt.Errorf("Key Vault references can only be used for securestring parameters, the parameter type is %s", parameter.Type)
+		}
+
+		return DeploymentParameter{
+			Reference: &KeyVaultReference{
+				KeyVault:   KeyVault{ID: keyVaultID},
+				SecretName: secretName,
+			},
+		}, nil
+	}
+
+	var value string
+	switch strategy.Source.Key {
+	case "value":
+		value = strategy.Source.Value
+	case "env":
+		v, ok := os.LookupEnv(strategy.Source.Value)
+		if !ok {
+			return DeploymentParameter{}, fmt.Errorf("Environment variable %s is not set", strategy.Source.Value)
+		}
+		value = v
+	case "path":
+		data, err := ioutil.ReadFile(strategy.Source.Value)
+		if err != nil {
+			return DeploymentParameter{}, fmt.Errorf("Unable to read file %s: %s", strategy.Source.Value, err)
+		}
+		value = string(data)
+		if isCredential && strings.HasPrefix(environmentVariable, common.GetEnvironmentVariableNames().CnabCredentialFilePrefix) {
+			value = base64.StdEncoding.EncodeToString(data)
+		}
+	case secretSourceKey:
+		return DeploymentParameter{}, fmt.Errorf("A Key Vault must be specified to reference secret %s", strategy.Source.Value)
+	default:
+		return DeploymentParameter{}, fmt.Errorf("Unsupported source: %s", strategy.Source.Key)
+	}
+
+	typedValue, err := toParameterValue(value, parameter.Type)
+	if err != nil {
+		return DeploymentParameter{}, err
+	}
+
+	return DeploymentParameter{Value: typedValue}, nil
+}
+
+// toParameterValue converts a value from a parameter set to the type of the template parameter
+func toParameterValue(value string, armType string) (interface{}, error) {
+	switch strings.ToLower(armType) {
+	case "int":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("Value %s is not an integer", value)
+		}
+		return v, nil
+	case "bool":
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("Value %s is not a boolean", value)
+		}
+		return v, nil
+	case "object", "secureobject", "array":
+		var v interface{}
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			return nil, fmt.Errorf("Value is not valid JSON: %s", err)
+		}
+		return v, nil
+	default:
+		return value, nil
+	}
+}
+
+// getEnvironmentVariableName gets the name of the container environment variable that the template sets from the parameter
+func getEnvironmentVariableName(name string, generatedTemplate template.Template) (string, bool) {
+	for _, environmentVariable := range getContainerEnvironmentVariables(generatedTemplate) {
+		value := environmentVariable.Value
+		if environmentVariable.SecureValue != "" {
+			value = environmentVariable.SecureValue
+		}
+
+		node, err := armexpr.ParseTemplateString(value)
+		if err != nil {
+			continue
+		}
+
+		for _, parameter := range armexpr.References(node, "parameters") {
+			if parameter == name {
+				return environmentVariable.Name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// getContainerEnvironmentVariables gets the environment variables of the containers in the container group of a template read from a file
+func getContainerEnvironmentVariables(generatedTemplate template.Template) []template.EnvironmentVariable {
+	var environmentVariables []template.EnvironmentVariable
+
+	for _, resource := range generatedTemplate.Resources {
+		if resource.Name != template.ContainerGroupName {
+			continue
+		}
+
+		data, err := json.Marshal(resource.Properties)
+		if err != nil {
+			continue
+		}
+
+		var properties template.ContainerGroupProperties
+		if err := json.Unmarshal(data, &properties); err != nil {
+			continue
+		}
+
+		for _, container := range properties.Containers {
+			environmentVariables = append(environmentVariables, container.Properties.EnvironmentVariables...)
+		}
+	}
+
+	return environmentVariables
+}
+
+// isKeyVaultEnvironmentVariable checks if the container reads the value of an environment variable from Key Vault
+func isKeyVaultEnvironmentVariable(name string) bool {
+	names := common.GetEnvironmentVariableNames()
+	return strings.HasPrefix(name, names.CnabKeyVaultParameterPrefix) || strings.HasPrefix(name, names.CnabKeyVaultCredentialPrefix)
+}
+
+func readTemplateFile(source string) (template.Template, error) {
+	var generatedTemplate template.Template
+
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return generatedTemplate, fmt.Errorf("Unable to read template file %s: %s", source, err)
+	}
+
+	if err := json.Unmarshal(data, &generatedTemplate); err != nil {
+		return generatedTemplate, fmt.Errorf("Unable to parse template file %s: %s", source, err)
+	}
+
+	return generatedTemplate, nil
+}
+
+// readSetFile reads a parameter or credential set, sets written by Porter are JSON but hand written sets are often YAML
+func readSetFile(source string, set interface{}) error {
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return fmt.Errorf("Unable to read file %s: %s", source, err)
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = json.Unmarshal(data, set)
+	} else {
+		err = yaml.Unmarshal(data, set)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Unable to parse file %s: %s", source, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package generator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const testKeyVaultID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv"
+
+func TestGenerateParameters(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+	os.Setenv("HELLO_WORLD_PERSON", "bob")
+	os.Setenv("HELLO_WORLD_CLIENT_SECRET", "client-secret")
+
+	generatedOutputPath := "testdata/generated/azuredeploy.parameters-generated.json"
+
+	options := GenerateParametersOptions{
+		TemplateFile:      "testdata/azuredeploy.json",
+		ParameterSetFile:  "testdata/parameter-set.yaml",
+		CredentialSetFile: "testdata/credential-set.json",
+		KeyVaultID:        testKeyVaultID,
+		OutputFile:        generatedOutputPath,
+		Overwrite:         true,
+	}
+
+	err := GenerateParameters(options)
+	assert.NilError(t, err)
+
+	parameters := readDeploymentParameters(t, generatedOutputPath)
+
+	assert.Equal(t, parameters.Schema, deploymentParametersSchema)
+	assert.DeepEqual(t, parameters.Parameters["age"].Value, float64(42))
+	assert.DeepEqual(t, parameters.Parameters["person"].Value, "bob")
+	assert.DeepEqual(t, parameters.Parameters["place_of_birth"].Value, "UK")
+	assert.DeepEqual(t, parameters.Parameters["retirement_age"].Value, float64(67))
+
+	assert.Equal(t, parameters.Parameters["azure_client_secret"].Reference.KeyVault.ID, testKeyVaultID)
+	assert.Equal(t, parameters.Parameters["azure_client_secret"].Reference.SecretName, "azure-client-secret")
+	assert.Equal(t, parameters.Parameters["password"].Reference.SecretName, "hello-world-password")
+	assert.Equal(t, parameters.Parameters["secret_file"].Reference.SecretName, "secret-file")
+}
+
+func TestGenerateParametersWithoutKeyVault(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+	os.Setenv("HELLO_WORLD_CLIENT_SECRET", "client-secret")
+
+	generatedOutputPath := "testdata/generated/azuredeploy.parameters-nokv-generated.json"
+
+	ioutil.WriteFile("testdata/generated/credential-set.yaml", []byte(`
+name: hello-world
+credentials:
+  - name: azure_client_secret
+    source:
+      env: HELLO_WORLD_CLIENT_SECRET
+  - name: secret_file
+    source:
+      path: testdata/secret-file.txt
+`), 0644)
+
+	options := GenerateParametersOptions{
+		TemplateFile:      "testdata/azuredeploy.json",
+		CredentialSetFile: "testdata/generated/credential-set.yaml",
+		OutputFile:        generatedOutputPath,
+		Overwrite:         true,
+	}
+
+	err := GenerateParameters(options)
+	assert.NilError(t, err)
+
+	parameters := readDeploymentParameters(t, generatedOutputPath)
+
+	assert.DeepEqual(t, parameters.Parameters["azure_client_secret"].Value, "client-secret")
+	assert.DeepEqual(t, parameters.Parameters["secret_file"].Value, "c2VjcmV0")
+}
+
+func TestGenerateParametersForKeyVaultTemplate(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+
+	templatePath := "testdata/generated/azuredeploy-keyvault-generated.json"
+	generatedOutputPath := "testdata/generated/azuredeploy.parameters-keyvault-generated.json"
+
+	err := GenerateTemplate(GenerateTemplateOptions{
+		BundleLoc:  "testdata/bundle.json",
+		BundleTag:  "cnabquickstarts.azurecr.io/porter/hello-world/bundle:1.0.0",
+		OutputFile: templatePath,
+		Overwrite:  true,
+		Version:    "latest",
+		KeyVault:   true,
+	})
+	assert.NilError(t, err)
+
+	options := GenerateParametersOptions{
+		TemplateFile:      templatePath,
+		CredentialSetFile: "testdata/credential-set.json",
+		KeyVaultID:        testKeyVaultID,
+		OutputFile:        generatedOutputPath,
+		Overwrite:         true,
+	}
+
+	err = GenerateParameters(options)
+	assert.NilError(t, err)
+
+	parameters := readDeploymentParameters(t, generatedOutputPath)
+
+	assert.DeepEqual(t, parameters.Parameters["cnab_key_vault_name"].Value, "kv")
+	assert.DeepEqual(t, parameters.Parameters["azure_client_secret"].Value, "azure-client-secret")
+	assert.DeepEqual(t, parameters.Parameters["password"].Value, "hello-world-password")
+	assert.DeepEqual(t, parameters.Parameters["secret_file"].Value, "secret-file")
+
+	options.KeyVaultID = ""
+	err = GenerateParameters(options)
+	assert.ErrorContains(t, err, "The template reads the value from Key Vault, a Key Vault must be specified")
+}
+
+func TestGenerateParametersErrors(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+
+	tests := []struct {
+		credentialSet string
+		keyVaultID    string
+		expected      string
+	}{
+		{"name: foo\ncredentials:\n  - name: password\n    source:\n      secret: foo\n", "", "A Key Vault must be specified to reference secret foo"},
+		{"name: foo\ncredentials:\n  - name: unknown\n    source:\n      value: foo\n", "", "The template does not have a parameter named unknown"},
+		{"name: foo\ncredentials:\n  - name: password\n    source:\n      command: echo\n", "", "Unsupported source: command"},
+	}
+
+	for _, test := range tests {
+		ioutil.WriteFile("testdata/generated/credential-set-error.yaml", []byte(test.credentialSet), 0644)
+
+		options := GenerateParametersOptions{
+			TemplateFile:      "testdata/azuredeploy.json",
+			CredentialSetFile: "testdata/generated/credential-set-error.yaml",
+			KeyVaultID:        test.keyVaultID,
+			OutputFile:        "testdata/generated/azuredeploy.parameters-error.json",
+			Overwrite:         true,
+		}
+
+		err := GenerateParameters(options)
+		assert.ErrorContains(t, err, test.expected)
+	}
+}
+
+func readDeploymentParameters(t *testing.T, path string) DeploymentParameters {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed reading generated output: %s", err)
+	}
+
+	var parameters DeploymentParameters
+	if err := json.Unmarshal(data, &parameters); err != nil {
+		t.Fatalf("failed parsing generated output: %s", err)
+	}
+
+	return parameters
+}
@@ -0,0 +1,295 @@
+package generator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/cnabio/cnab-go/bundle"
+	"github.com/cnabio/cnab-go/bundle/definition"
+	"gopkg.in/yaml.v2"
+)
+
+// porterManifest defines the subset of a Porter manifest (porter.yaml) that is used to generate a template
+type porterManifest struct {
+	Name          string                        `yaml:"name"`
+	Version       string                        `yaml:"version"`
+	Description   string                        `yaml:"description"`
+	Tag           string                        `yaml:"tag"`
+	Registry      string                        `yaml:"registry"`
+	Reference     string                        `yaml:"reference"`
+	Parameters    []porterParameter             `yaml:"parameters"`
+	Credentials   []porterCredential            `yaml:"credentials"`
+	Outputs       []porterOutput                `yaml:"outputs"`
+	CustomActions map[string]porterCustomAction `yaml:"customActions"`
+}
+
+type porterParameter struct {
+	Name         string   `yaml:"name"`
+	Description  string   `yaml:"description"`
+	Sensitive    bool     `yaml:"sensitive"`
+	ApplyTo      []string `yaml:"applyTo"`
+	Env          string   `yaml:"env"`
+	Path         string   `yaml:"path"`
+	Required     *bool    `yaml:"required"`
+	porterSchema `yaml:",inline"`
+}
+
+// porterSchema defines the JSON schema keywords that can be used to define a parameter or output in a Porter manifest
+type porterSchema struct {
+	Type             interface{}   `yaml:"type"`
+	Default          interface{}   `yaml:"default"`
+	Enum             []interface{} `yaml:"enum"`
+	Minimum          *int          `yaml:"minimum"`
+	Maximum          *int          `yaml:"maximum"`
+	ExclusiveMinimum *int          `yaml:"exclusiveMinimum"`
+	ExclusiveMaximum *int          `yaml:"exclusiveMaximum"`
+	MinLength        *int          `yaml:"minLength"`
+	MaxLength        *int          `yaml:"maxLength"`
+	Format           string        `yaml:"format"`
+	ContentEncoding  string        `yaml:"contentEncoding"`
+	Pattern          string        `yaml:"pattern"`
+}
+
+type porterCredential struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Env         string `yaml:"env"`
+	Path        string `yaml:"path"`
+	Required    *bool  `yaml:"required"`
+}
+
+type porterOutput struct {
+	Name         string   `yaml:"name"`
+	Description  string   `yaml:"description"`
+	Sensitive    bool     `yaml:"sensitive"`
+	ApplyTo      []string `yaml:"applyTo"`
+	Path         string   `yaml:"path"`
+	porterSchema `yaml:",inline"`
+}
+
+type porterCustomAction struct {
+	Description string `yaml:"description"`
+	Stateless   bool   `yaml:"stateless"`
+	Modifies    bool   `yaml:"modifies"`
+}
+
+// porterManifestKeys are the top level keys in a Porter manifest that are not custom actions
+var porterManifestKeys = map[string]bool{
+	"schemaVersion": true, "name": true, "version": true, "description": true, "tag": true, "registry": true, "reference": true,
+	"invocationImage": true, "dockerfile": true, "maintainers": true, "mixins": true, "parameters": true, "credentials": true,
+	"outputs": true, "images": true, "dependencies": true, "required": true, "customActions": true, "state": true, "custom": true,
+	"install": true, "upgrade": true, "uninstall": true,
+}
+
+// isPorterManifest checks if the source is a Porter manifest rather than a bundle.json or archive
+func isPorterManifest(source string) bool {
+	ext := strings.ToLower(filepath.Ext(source))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// loadPorterManifest derives the bundle metadata and bundle tag from a Porter manifest, without requiring porter build to have been run
+func loadPorterManifest(source string) (*bundle.Bundle, definitionPatterns, string, error) {
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	var manifest porterManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, "", fmt.Errorf("Unable to parse Porter manifest %s: %s", source, err)
+	}
+
+	if manifest.Name == "" {
+		return nil, nil, "", fmt.Errorf("Porter manifest %s does not specify a bundle name", source)
+	}
+
+	// Custom actions are top level keys in the manifest, customActions only holds their optional metadata
+	var keys yaml.MapSlice
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+		return nil, nil, "", fmt.Errorf("Unable to parse Porter manifest %s: %s", source, err)
+	}
+
+	b := bundle.Bundle{
+		Name:        manifest.Name,
+		Version:     manifest.Version,
+		Description: manifest.Description,
+		Actions:     map[string]bundle.Action{},
+		Parameters:  map[string]bundle.Parameter{},
+		Credentials: map[string]bundle.Credential{},
+		Outputs:     map[string]bundle.Output{},
+		Definitions: definition.Definitions{},
+	}
+
+	// cnab-go does not support pattern so it is kept separately
+	patterns := definitionPatterns{}
+
+	for _, item := range keys {
+		name, ok := item.Key.(string)
+		if !ok || porterManifestKeys[name] {
+			continue
+		}
+
+		if _, ok := item.Value.([]interface{}); !ok {
+			continue
+		}
+
+		customAction := manifest.CustomActions[name]
+		b.Actions[name] = bundle.Action{
+			Description: customAction.Description,
+			Stateless:   customAction.Stateless,
+			Modifies:    customAction.Modifies,
+		}
+	}
+
+	for _, parameter := range manifest.Parameters {
+		if parameter.Name == "" {
+			return nil, nil, "", fmt.Errorf("Porter manifest %s contains a parameter without a name", source)
+		}
+
+		schema := parameter.toDefinition(parameter.Description, parameter.Sensitive)
+
+		// Porter treats parameters without a default value as required unless specified otherwise
+		required := schema.Default == nil
+		if parameter.Required != nil {
+			required = *parameter.Required
+		}
+
+		b.Definitions[parameter.Name] = schema
+		if parameter.Pattern != "" {
+			patterns[parameter.Name] = parameter.Pattern
+		}
+		b.Parameters[parameter.Name] = bundle.Parameter{
+			Definition:  parameter.Name,
+			Description: parameter.Description,
+			ApplyTo:     parameter.ApplyTo,
+			Required:    required,
+			Destination: porterLocation(parameter.Name, parameter.Env, parameter.Path),
+		}
+	}
+
+	for _, credential := range manifest.Credentials {
+		if credential.Name == "" {
+			return nil, nil, "", fmt.Errorf("Porter manifest %s contains a credential without a name", source)
+		}
+
+		// Porter treats credentials as required unless specified otherwise
+		required := true
+		if credential.Required != nil {
+			required = *credential.Required
+		}
+
+		b.Credentials[credential.Name] = bundle.Credential{
+			Location:    *porterLocation(credential.Name, credential.Env, credential.Path),
+			Description: credential.Description,
+			Required:    required,
+		}
+	}
+
+	for _, output := range manifest.Outputs {
+		if output.Name == "" {
+			return nil, nil, "", fmt.Errorf("Porter manifest %s contains an output without a name", source)
+		}
+
+		schema := output.toDefinition(output.Description, output.Sensitive)
+
+		// Porter collects outputs from /cnab/app/outputs unless a path is specified
+		path := output.Path
+		if path == "" {
+			path = "/cnab/app/outputs/" + output.Name
+		}
+
+		definitionName := output.Name + "-output"
+		b.Definitions[definitionName] = schema
+		b.Outputs[output.Name] = bundle.Output{
+			Definition:  definitionName,
+			Description: output.Description,
+			ApplyTo:     output.ApplyTo,
+			Path:        path,
+		}
+	}
+
+	return &b, patterns, porterBundleTag(manifest), nil
+}
+
+func (schema porterSchema) toDefinition(description string, sensitive bool) *definition.Schema {
+	d := definition.Schema{
+		Type:             schema.Type,
+		Default:          toJSONValue(schema.Default),
+		Description:      description,
+		Minimum:          schema.Minimum,
+		Maximum:          schema.Maximum,
+		ExclusiveMinimum: schema.ExclusiveMinimum,
+		ExclusiveMaximum: schema.ExclusiveMaximum,
+		MinLength:        schema.MinLength,
+		MaxLength:        schema.MaxLength,
+		Format:           schema.Format,
+		ContentEncoding:  schema.ContentEncoding,
+	}
+
+	for _, value := range schema.Enum {
+		d.Enum = append(d.Enum, toJSONValue(value))
+	}
+
+	// Porter defaults the type to string
+	if d.Type == nil {
+		d.Type = "string"
+	}
+
+	if sensitive {
+		writeOnly := true
+		d.WriteOnly = &writeOnly
+	}
+
+	return &d
+}
+
+func porterLocation(name string, env string, path string) *bundle.Location {
+	if env == "" && path == "" {
+		env = strings.ToUpper(name)
+	}
+
+	return &bundle.Location{
+		EnvironmentVariable: env,
+		Path:                path,
+	}
+}
+
+// porterBundleTag returns the tag the bundle will be published with, older manifests specify the tag, newer ones the registry or reference
+func porterBundleTag(manifest porterManifest) string {
+	if manifest.Tag != "" {
+		return manifest.Tag
+	}
+
+	if manifest.Reference != "" {
+		return manifest.Reference
+	}
+
+	if manifest.Registry != "" && manifest.Version != "" {
+		return fmt.Sprintf("%s/%s:v%s", strings.TrimSuffix(manifest.Registry, "/"), manifest.Name, manifest.Version)
+	}
+
+	return ""
+}
+
+// toJSONValue converts values parsed from YAML into the types that would be produced by parsing JSON
+func toJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, item := range v {
+			m[fmt.Sprintf("%v", key)] = toJSONValue(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = toJSONValue(item)
+		}
+		return v
+	case int:
+		return float64(v)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,236 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cnabio/cnab-go/credentials"
+	"github.com/cnabio/cnab-go/valuesource"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/armexpr"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+)
+
+const redactedValue = "*****"
+
+// PreviewTemplateOptions is the set of options for configuring PreviewTemplate
+type PreviewTemplateOptions struct {
+	TemplateFile string
+	// ParametersFile is the ARM template parameters file for the deployment, if it is not set the template parameters must all have default values
+	ParametersFile string
+	// SubscriptionID, TenantID, ResourceGroupName and Location describe the deployment, they can be fake values
+	SubscriptionID    string
+	TenantID          string
+	ResourceGroupName string
+	Location          string
+}
+
+// TemplatePreview is what the driver container would receive if the template was deployed
+type TemplatePreview struct {
+	EnvironmentVariables []PreviewEnvironmentVariable
+	// ParameterSet and CredentialSet are the sets the driver creates for Porter from the environment variables, values from secure environment variables are redacted
+	ParameterSet  common.ParameterSet
+	CredentialSet credentials.CredentialSet
+}
+
+// PreviewEnvironmentVariable is the value of a container environment variable, the value is redacted if it is secure
+type PreviewEnvironmentVariable struct {
+	Name   string
+	Value  string
+	Secure bool
+}
+
+// PreviewTemplate evaluates the container environment variables of a generated template for a deployment without deploying it
+func PreviewTemplate(options PreviewTemplateOptions) (TemplatePreview, error) {
+	var preview TemplatePreview
+
+	generatedTemplate, err := readTemplateFile(options.TemplateFile)
+	if err != nil {
+		return preview, err
+	}
+
+	ctx := &armexpr.Context{
+		SubscriptionID:    options.SubscriptionID,
+		TenantID:          options.TenantID,
+		ResourceGroupName: options.ResourceGroupName,
+		Location:          options.Location,
+		DeploymentName:    strings.TrimSuffix(filepath.Base(options.TemplateFile), filepath.Ext(options.TemplateFile)),
+		Parameters:        map[string]interface{}{},
+		ParameterDefaults: map[string]interface{}{},
+		Variables:         map[string]interface{}{},
+		Reference:         previewReference,
+	}
+
+	for name, parameter := range generatedTemplate.Parameters {
+		if parameter.DefaultValue != nil {
+			ctx.ParameterDefaults[name] = parameter.DefaultValue
+		}
+	}
+
+	for name, value := range generatedTemplate.Variables {
+		ctx.Variables[name] = value
+	}
+
+	if options.ParametersFile != "" {
+		deploymentParameters, err := readParametersFile(options.ParametersFile)
+		if err != nil {
+			return preview, err
+		}
+
+		for name, parameter := range deploymentParameters.Parameters {
+			if _, ok := generatedTemplate.Parameters[name]; !ok {
+				return preview, fmt.Errorf("The template does not have a parameter named %s", name)
+			}
+
+			// Key Vault references are resolved by Azure, the values are secure so they are redacted
+			if parameter.Reference != nil {
+				ctx.Parameters[name] = fmt.Sprintf("<secret %s>", parameter.Reference.SecretName)
+				continue
+			}
+
+			ctx.Parameters[name] = parameter.Value
+		}
+	}
+
+	for _, environmentVariable := range getContainerEnvironmentVariables(generatedTemplate) {
+		value, secure := environmentVariable.Value, environmentVariable.SecureValue != ""
+		if secure {
+			value = environmentVariable.SecureValue
+		} else if _, ok := findSecureParameter(value, generatedTemplate, map[string]bool{}); ok {
+			secure = true
+		}
+
+		evaluated, err := armexpr.EvaluateTemplateString(value, ctx)
+		if err != nil {
+			return preview, fmt.Errorf("Unable to evaluate environment variable %s: %s", environmentVariable.Name, err)
+		}
+
+		s, err := armexpr.ToString(evaluated)
+		if err != nil {
+			return preview, fmt.Errorf("Unable to convert environment variable %s to a string: %s", environmentVariable.Name, err)
+		}
+
+		preview.EnvironmentVariables = append(preview.EnvironmentVariables, PreviewEnvironmentVariable{
+			Name:   environmentVariable.Name,
+			Value:  s,
+			Secure: secure,
+		})
+	}
+
+	if err := preview.addSets(); err != nil {
+		return preview, err
+	}
+
+	for i, environmentVariable := range preview.EnvironmentVariables {
+		if environmentVariable.Secure && environmentVariable.Value != "" {
+			preview.EnvironmentVariables[i].Value = redactedValue
+		}
+	}
+
+	return preview, nil
+}
+
+// addSets creates the parameter and credential sets the same way as the driver, Key Vault secrets are read by the driver so the sets show the secret names
+func (preview *TemplatePreview) addSets() error {
+	names := common.GetEnvironmentVariableNames()
+
+	values := map[string]PreviewEnvironmentVariable{}
+	for _, environmentVariable := range preview.EnvironmentVariables {
+		values[environmentVariable.Name] = environmentVariable
+	}
+
+	nameMap, err := common.ParseNameMap(values[names.CnabNameMap].Value)
+	if err != nil {
+		return err
+	}
+
+	installationName := values[names.CnabInstallationName].Value
+	preview.ParameterSet = common.ParameterSet{Name: installationName}
+	preview.CredentialSet = credentials.CredentialSet{Name: installationName}
+
+	for _, environmentVariable := range preview.EnvironmentVariables {
+		name := environmentVariable.Name
+
+		switch {
+		case strings.HasPrefix(name, names.CnabParameterPrefix):
+			// Parameters that are not set are empty, the driver only passes empty values to Porter for string parameters that apply to the action, which the preview cannot tell without the bundle
+			if environmentVariable.Value == "" {
+				continue
+			}
+			value := environmentVariable.Value
+			if environmentVariable.Secure {
+				value = redactedValue
+			}
+			preview.ParameterSet.Parameters = append(preview.ParameterSet.Parameters, newStrategy(nameMap.ParameterName(strings.TrimPrefix(name, names.CnabParameterPrefix)), "value", value))
+		case strings.HasPrefix(name, names.CnabKeyVaultParameterPrefix):
+			preview.ParameterSet.Parameters = append(preview.ParameterSet.Parameters, newStrategy(nameMap.ParameterName(strings.TrimPrefix(name, names.CnabKeyVaultParameterPrefix)), secretSourceKey, environmentVariable.Value))
+		case strings.HasPrefix(name, names.CnabCredentialFilePrefix):
+			// The driver decodes file credentials to a file named after the credential in a temporary directory
+			safeName := strings.TrimPrefix(name, names.CnabCredentialFilePrefix)
+			preview.CredentialSet.Credentials = append(preview.CredentialSet.Credentials, newStrategy(nameMap.CredentialName(safeName), "path", safeName))
+		case strings.HasPrefix(name, names.CnabCredentialPrefix):
+			preview.CredentialSet.Credentials = append(preview.CredentialSet.Credentials, newStrategy(nameMap.CredentialName(strings.TrimPrefix(name, names.CnabCredentialPrefix)), "env", name))
+		case strings.HasPrefix(name, names.CnabKeyVaultCredentialFilePrefix):
+			preview.CredentialSet.Credentials = append(preview.CredentialSet.Credentials, newStrategy(nameMap.CredentialName(strings.TrimPrefix(name, names.CnabKeyVaultCredentialFilePrefix)), secretSourceKey, environmentVariable.Value))
+		case strings.HasPrefix(name, names.CnabKeyVaultCredentialPrefix):
+			preview.CredentialSet.Credentials = append(preview.CredentialSet.Credentials, newStrategy(nameMap.CredentialName(strings.TrimPrefix(name, names.CnabKeyVaultCredentialPrefix)), secretSourceKey, environmentVariable.Value))
+		}
+	}
+
+	sort.Slice(preview.ParameterSet.Parameters, func(i, j int) bool {
+		return preview.ParameterSet.Parameters[i].Name < preview.ParameterSet.Parameters[j].Name
+	})
+	sort.Slice(preview.CredentialSet.Credentials, func(i, j int) bool {
+		return preview.CredentialSet.Credentials[i].Name < preview.CredentialSet.Credentials[j].Name
+	})
+
+	return nil
+}
+
+// previewReference returns placeholders for the properties of resources that the generated templates reference, e.g. the client id of a managed identity, as they are only known once the resource is deployed
+func previewReference(resourceID string, apiVersion string, full bool) (interface{}, error) {
+	placeholder := func(property string) string {
+		return fmt.Sprintf("<%s of %s>", property, resourceID)
+	}
+
+	return map[string]interface{}{
+		"id":          resourceID,
+		"clientId":    placeholder("clientId"),
+		"principalId": placeholder("principalId"),
+		"tenantId":    placeholder("tenantId"),
+		"customerId":  placeholder("customerId"),
+		"identity": map[string]interface{}{
+			"principalId": placeholder("principalId"),
+			"tenantId":    placeholder("tenantId"),
+		},
+		"outputs": map[string]interface{}{},
+	}, nil
+}
+
+func newStrategy(name string, key string, value string) valuesource.Strategy {
+	return valuesource.Strategy{
+		Name: name,
+		Source: valuesource.Source{
+			Key:   key,
+			Value: value,
+		},
+	}
+}
+
+func readParametersFile(source string) (DeploymentParameters, error) {
+	var deploymentParameters DeploymentParameters
+
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return deploymentParameters, fmt.Errorf("Unable to read parameters file %s: %s", source, err)
+	}
+
+	if err := json.Unmarshal(data, &deploymentParameters); err != nil {
+		return deploymentParameters, fmt.Errorf("Unable to parse parameters file %s: %s", source, err)
+	}
+
+	return deploymentParameters, nil
+}
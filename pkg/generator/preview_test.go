@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/cnabio/cnab-go/valuesource"
+	"gotest.tools/v3/assert"
+)
+
+func TestPreviewTemplate(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+
+	parametersPath := "testdata/generated/azuredeploy.parameters-preview.json"
+	err := ioutil.WriteFile(parametersPath, []byte(`{
+		"parameters": {
+			"cnab_azure_client_id": {"value": "client"},
+			"cnab_azure_client_secret": {"reference": {"keyVault": {"id": "`+testKeyVaultID+`"}, "secretName": "client-secret"}},
+			"age": {"value": 42},
+			"person": {"value": "bob"},
+			"place_of_birth": {"value": "UK"},
+			"retirement_age": {"value": 67},
+			"azure_client_secret": {"value": "client-secret"},
+			"password": {"value": "password"},
+			"secret_file": {"value": "c2VjcmV0"}
+		}
+	}`), 0644)
+	assert.NilError(t, err)
+
+	preview, err := PreviewTemplate(PreviewTemplateOptions{
+		TemplateFile:      "testdata/azuredeploy.json",
+		ParametersFile:    parametersPath,
+		SubscriptionID:    "11111111-1111-1111-1111-111111111111",
+		TenantID:          "22222222-2222-2222-2222-222222222222",
+		ResourceGroupName: "test-rg",
+		Location:          "westeurope",
+	})
+	assert.NilError(t, err)
+
+	values := map[string]PreviewEnvironmentVariable{}
+	for _, environmentVariable := range preview.EnvironmentVariables {
+		values[environmentVariable.Name] = environmentVariable
+	}
+
+	assert.Equal(t, values["CNAB_ACTION"].Value, "install")
+	assert.Equal(t, values["CNAB_AZURE_SUBSCRIPTION_ID"].Value, "11111111-1111-1111-1111-111111111111")
+	assert.Equal(t, values["CNAB_AZURE_LOCATION"].Value, "westeurope")
+	assert.Equal(t, values["CNAB_AZURE_CLIENT_ID"].Value, "client")
+	assert.DeepEqual(t, values["CNAB_AZURE_CLIENT_SECRET"], PreviewEnvironmentVariable{Name: "CNAB_AZURE_CLIENT_SECRET", Value: redactedValue, Secure: true})
+	assert.Equal(t, values["CNAB_PARAM_age"].Value, "42")
+	assert.Equal(t, values["CNAB_PARAM_place_of_birth"].Value, "UK")
+	assert.DeepEqual(t, values["CNAB_PARAM_person"], PreviewEnvironmentVariable{Name: "CNAB_PARAM_person", Value: redactedValue, Secure: true})
+	assert.DeepEqual(t, values["CNAB_AZURE_STATE_STORAGE_ACCOUNT_KEY"], PreviewEnvironmentVariable{Name: "CNAB_AZURE_STATE_STORAGE_ACCOUNT_KEY", Value: redactedValue, Secure: true})
+
+	assert.Equal(t, preview.ParameterSet.Name, "hello-world")
+	assert.DeepEqual(t, preview.ParameterSet.Parameters, []valuesource.Strategy{
+		newStrategy("age", "value", "42"),
+		newStrategy("person", "value", redactedValue),
+		newStrategy("place_of_birth", "value", "UK"),
+		newStrategy("retirement_age", "value", "67"),
+	})
+
+	assert.DeepEqual(t, preview.CredentialSet.Credentials, []valuesource.Strategy{
+		newStrategy("azure_client_secret", "env", "CNAB_CRED_azure_client_secret"),
+		newStrategy("password", "env", "CNAB_CRED_password"),
+		newStrategy("secret_file", "path", "secret_file"),
+	})
+}
+
+func TestPreviewKeyVaultTemplate(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+
+	templatePath := "testdata/generated/azuredeploy-preview-keyvault.json"
+	err := GenerateTemplate(GenerateTemplateOptions{
+		BundleLoc:  "testdata/bundle.json",
+		BundleTag:  "cnabquickstarts.azurecr.io/porter/hello-world/bundle:1.0.0",
+		OutputFile: templatePath,
+		Overwrite:  true,
+		Version:    "latest",
+		KeyVault:   true,
+		LogSink:    "loganalytics",
+	})
+	assert.NilError(t, err)
+
+	parametersPath := "testdata/generated/azuredeploy.parameters-preview-keyvault.json"
+	err = ioutil.WriteFile(parametersPath, []byte(`{
+		"parameters": {
+			"cnab_key_vault_name": {"value": "myvault"},
+			"cnab_key_vault_identity": {"value": "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/id"},
+			"cnab_log_analytics_workspace": {"value": "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.OperationalInsights/workspaces/logs"},
+			"cnab_azure_client_id": {"value": "client"},
+			"cnab_azure_client_secret": {"value": "secret"},
+			"person": {"value": "person-secret"},
+			"place_of_birth": {"value": "UK"},
+			"retirement_age": {"value": 67},
+			"password": {"value": "password-secret"},
+			"secret_file": {"value": "secret-file"}
+		}
+	}`), 0644)
+	assert.NilError(t, err)
+
+	preview, err := PreviewTemplate(PreviewTemplateOptions{TemplateFile: templatePath, ParametersFile: parametersPath})
+	assert.NilError(t, err)
+
+	for _, environmentVariable := range preview.EnvironmentVariables {
+		if environmentVariable.Name == "CNAB_KEYVAULT_CLIENT_ID" {
+			assert.Equal(t, environmentVariable.Value, "<clientId of /subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/id>")
+		}
+		if environmentVariable.Name == "CNAB_LOG_ANALYTICS_WORKSPACE_ID" {
+			assert.Equal(t, environmentVariable.Value, "<customerId of /subscriptions/sub/resourceGroups/rg/providers/Microsoft.OperationalInsights/workspaces/logs>")
+		}
+	}
+
+	assert.DeepEqual(t, preview.ParameterSet.Parameters[1], newStrategy("person", secretSourceKey, "person-secret"))
+	assert.DeepEqual(t, preview.CredentialSet.Credentials[1], newStrategy("password", secretSourceKey, "password-secret"))
+	assert.DeepEqual(t, preview.CredentialSet.Credentials[2], newStrategy("secret_file", secretSourceKey, "secret-file"))
+}
+
+func TestPreviewTemplateErrors(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+
+	parametersPath := "testdata/generated/azuredeploy.parameters-preview-invalid.json"
+	err := ioutil.WriteFile(parametersPath, []byte(`{"parameters": {"name": {"value": "foo"}}}`), 0644)
+	assert.NilError(t, err)
+
+	_, err = PreviewTemplate(PreviewTemplateOptions{TemplateFile: "testdata/azuredeploy.json", ParametersFile: parametersPath})
+	assert.ErrorContains(t, err, "The template does not have a parameter named name")
+
+	_, err = PreviewTemplate(PreviewTemplateOptions{TemplateFile: "testdata/azuredeploy.json"})
+	assert.ErrorContains(t, err, "Unable to evaluate environment variable CNAB_AZURE_CLIENT_ID: unable to evaluate variable cnab_azure_client_id: parameter cnab_azure_client_id does not have a value")
+}
@@ -0,0 +1,324 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cnabio/cnab-go/bundle/definition"
+)
+
+// armParameterType is the closest ARM template parameter type for a JSON schema definition
+type armParameterType struct {
+	// Type is the ARM template parameter type
+	Type string
+	// Notes describe parts of the definition that cannot be expressed in the template, they are added to the parameter description
+	Notes []string
+}
+
+// definitionPatterns are the pattern keywords of bundle definitions by definition name, cnab-go does not parse pattern so it is read from the bundle.json
+type definitionPatterns map[string]string
+
+// getDefinitionPatterns reads the patterns of the definitions in a bundle.json
+func getDefinitionPatterns(data []byte) (definitionPatterns, error) {
+	var b struct {
+		Definitions map[string]struct {
+			Pattern string `json:"pattern"`
+		} `json:"definitions"`
+	}
+
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("Unable to read definition patterns: %s", err)
+	}
+
+	patterns := definitionPatterns{}
+	for name, definition := range b.Definitions {
+		if definition.Pattern != "" {
+			patterns[name] = definition.Pattern
+		}
+	}
+
+	return patterns, nil
+}
+
+// toARMParameterType converts a JSON schema definition to an ARM template parameter type
+func toARMParameterType(schema *definition.Schema, isSensitive bool) (armParameterType, error) {
+	var result armParameterType
+
+	if schema == nil {
+		return result, fmt.Errorf("Definition is missing")
+	}
+
+	jsonTypes, err := getJSONTypes(schema)
+	if err != nil {
+		return result, err
+	}
+
+	// ARM template parameters cannot be null, so null is ignored in type arrays
+	var types []string
+	for _, jsonType := range jsonTypes {
+		if jsonType != "null" {
+			types = append(types, jsonType)
+		}
+	}
+
+	switch {
+	case len(types) == 0:
+		result.Type, err = toARMType("string", isSensitive)
+	case len(types) == 1 && types[0] == "number":
+		// multipleOf is an integer so a number that must be a multiple of it is an integer
+		if schema.MultipleOf != nil {
+			result.Type, err = toARMType("integer", isSensitive)
+		} else {
+			result.Type, err = toARMType("string", isSensitive)
+			result.Notes = append(result.Notes, "number")
+		}
+	case len(types) == 1:
+		result.Type, err = toARMType(types[0], isSensitive)
+	case isNumeric(types):
+		result.Type, err = toARMType("string", isSensitive)
+		result.Notes = append(result.Notes, "number")
+	default:
+		// ARM template parameters have a single type, so values that can have several types are passed as strings
+		for _, jsonType := range types {
+			if !isJSONType(jsonType) {
+				return result, fmt.Errorf("Unable to convert type '%s' to ARM template parameter type", jsonType)
+			}
+		}
+		result.Type, err = toARMType("string", isSensitive)
+		result.Notes = append(result.Notes, strings.Join(types, " or "))
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	if schema.Format != "" {
+		result.Notes = append(result.Notes, fmt.Sprintf("format: %s", schema.Format))
+	}
+
+	if schema.ContentEncoding != "" {
+		result.Notes = append(result.Notes, fmt.Sprintf("%s encoded", schema.ContentEncoding))
+	}
+
+	if schema.ContentMediaType != "" {
+		result.Notes = append(result.Notes, fmt.Sprintf("media type: %s", schema.ContentMediaType))
+	}
+
+	if schema.MultipleOf != nil && *schema.MultipleOf > 1 {
+		result.Notes = append(result.Notes, fmt.Sprintf("multiple of %d", *schema.MultipleOf))
+	}
+
+	// minValue and maxValue can only be set on int parameters, so the range of other types is described instead
+	if result.Type != "int" {
+		result.Notes = append(result.Notes, getRangeNotes(schema)...)
+	}
+
+	return result, nil
+}
+
+// withPattern adds the pattern a value must match to the notes, ARM templates cannot validate a pattern
+func (t armParameterType) withPattern(pattern string) armParameterType {
+	if pattern != "" {
+		t.Notes = append(append([]string{}, t.Notes...), fmt.Sprintf("pattern: %s", pattern))
+	}
+
+	return t
+}
+
+// toOptionalARMParameterType converts a JSON schema definition to an ARM template parameter type that can default to an empty value, only strings can be empty so other types are passed as strings that the driver converts to the type of the definition
+func toOptionalARMParameterType(schema *definition.Schema, isSensitive bool) (armParameterType, error) {
+	result, err := toARMParameterType(schema, isSensitive)
+	if err != nil || result.Type == "string" || result.Type == "securestring" {
+		return result, err
+	}
+
+	var typeNote string
+	switch result.Type {
+	case "int":
+		typeNote = "integer"
+	case "bool":
+		typeNote = "boolean"
+	default:
+		typeNote = "JSON " + strings.TrimPrefix(result.Type, "secure")
+	}
+
+	notes := append([]string{typeNote}, result.Notes...)
+	if result.Type == "int" {
+		notes = append(notes, getRangeNotes(schema)...)
+	}
+
+	result.Notes = notes
+	result.Type, err = toARMType("string", isSensitive)
+	return result, err
+}
+
+// getRangeNotes describes the minimum and maximum of a definition
+func getRangeNotes(schema *definition.Schema) []string {
+	var notes []string
+	if schema.Minimum != nil {
+		notes = append(notes, fmt.Sprintf("minimum %d", *schema.Minimum))
+	}
+	if schema.ExclusiveMinimum != nil {
+		notes = append(notes, fmt.Sprintf("greater than %d", *schema.ExclusiveMinimum))
+	}
+	if schema.Maximum != nil {
+		notes = append(notes, fmt.Sprintf("maximum %d", *schema.Maximum))
+	}
+	if schema.ExclusiveMaximum != nil {
+		notes = append(notes, fmt.Sprintf("less than %d", *schema.ExclusiveMaximum))
+	}
+
+	return notes
+}
+
+// getJSONTypes gets the types allowed by a definition, inferring the type from const, enum or default values when it is not specified
+func getJSONTypes(schema *definition.Schema) ([]string, error) {
+	switch t := schema.Type.(type) {
+	case string:
+		return []string{t}, nil
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("Invalid type %v, types must be strings", item)
+			}
+			types = append(types, s)
+		}
+		return types, nil
+	case []string:
+		return t, nil
+	case nil:
+	default:
+		return nil, fmt.Errorf("Invalid type %v", t)
+	}
+
+	var values []interface{}
+	switch {
+	case schema.Const != nil:
+		values = []interface{}{schema.Const}
+	case len(schema.Enum) > 0:
+		values = schema.Enum
+	case schema.Default != nil:
+		values = []interface{}{schema.Default}
+	case schema.Properties != nil:
+		return []string{"object"}, nil
+	case schema.Items != nil:
+		return []string{"array"}, nil
+	default:
+		// A definition without a type accepts any value, which are passed to the bundle as strings
+		return []string{"string"}, nil
+	}
+
+	found := map[string]bool{}
+	for _, value := range values {
+		found[toJSONType(value)] = true
+	}
+
+	types := make([]string, 0, len(found))
+	for jsonType := range found {
+		types = append(types, jsonType)
+	}
+	sort.Strings(types)
+
+	return types, nil
+}
+
+func toJSONType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case int, int32, int64:
+		return "integer"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func isJSONType(jsonType string) bool {
+	switch jsonType {
+	case "string", "integer", "number", "boolean", "object", "array", "null":
+		return true
+	default:
+		return false
+	}
+}
+
+func isNumeric(types []string) bool {
+	for _, jsonType := range types {
+		if jsonType != "integer" && jsonType != "number" {
+			return false
+		}
+	}
+	return true
+}
+
+// convertValue converts a default, const or enum value to the ARM template parameter type, values that are not strings are converted to JSON when the parameter is a string
+func (t armParameterType) convertValue(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	if t.Type != "string" && t.Type != "securestring" {
+		return value, nil
+	}
+
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to convert value %v to a string: %s", value, err)
+	}
+
+	return string(data), nil
+}
+
+func toARMType(jsonType string, isSensitive bool) (string, error) {
+	var armType string
+	var err error
+
+	switch jsonType {
+	case "boolean":
+		armType = "bool"
+		break
+	case "integer":
+		armType = "int"
+		break
+	case "string":
+		if isSensitive {
+			armType = "securestring"
+		} else {
+			armType = "string"
+		}
+		break
+	case "object":
+		if isSensitive {
+			armType = "secureobject"
+		} else {
+			armType = "object"
+		}
+		break
+	case "array":
+		armType = jsonType
+		break
+	default:
+		err = fmt.Errorf("Unable to convert type '%s' to ARM template parameter type", jsonType)
+	}
+
+	return armType, err
+}
@@ -0,0 +1,134 @@
+package generator
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cnabio/cnab-go/bundle/definition"
+	"gotest.tools/v3/assert"
+)
+
+func TestToARMParameterType(t *testing.T) {
+	tests := []struct {
+		name      string
+		schema    string
+		sensitive bool
+		expected  armParameterType
+	}{
+		{"string", `{"type": "string"}`, false, armParameterType{Type: "string"}},
+		{"sensitive string", `{"type": "string"}`, true, armParameterType{Type: "securestring"}},
+		{"integer", `{"type": "integer"}`, false, armParameterType{Type: "int"}},
+		{"boolean", `{"type": "boolean"}`, false, armParameterType{Type: "bool"}},
+		{"object", `{"type": "object"}`, false, armParameterType{Type: "object"}},
+		{"sensitive object", `{"type": "object"}`, true, armParameterType{Type: "secureobject"}},
+		{"array", `{"type": "array"}`, false, armParameterType{Type: "array"}},
+		{"nullable string", `{"type": ["string", "null"]}`, false, armParameterType{Type: "string"}},
+		{"nullable integer", `{"type": ["null", "integer"]}`, false, armParameterType{Type: "int"}},
+		{"null", `{"type": "null"}`, false, armParameterType{Type: "string"}},
+		{"number", `{"type": "number"}`, false, armParameterType{Type: "string", Notes: []string{"number"}}},
+		{"number with multipleOf", `{"type": "number", "multipleOf": 5}`, false, armParameterType{Type: "int", Notes: []string{"multiple of 5"}}},
+		{"number with minimum and maximum", `{"type": "number", "minimum": 0, "maximum": 10}`, false, armParameterType{Type: "string", Notes: []string{"number", "minimum 0", "maximum 10"}}},
+		{"number with exclusive range", `{"type": "number", "exclusiveMinimum": 0, "exclusiveMaximum": 10}`, false, armParameterType{Type: "string", Notes: []string{"number", "greater than 0", "less than 10"}}},
+		{"integer with minimum", `{"type": "integer", "minimum": 0}`, false, armParameterType{Type: "int"}},
+		{"integer or number", `{"type": ["integer", "number"]}`, false, armParameterType{Type: "string", Notes: []string{"number"}}},
+		{"union", `{"type": ["string", "integer", "null"]}`, false, armParameterType{Type: "string", Notes: []string{"string or integer"}}},
+		{"missing type", `{}`, false, armParameterType{Type: "string"}},
+		{"missing type with const", `{"const": 42}`, false, armParameterType{Type: "int"}},
+		{"missing type with enum", `{"enum": ["a", "b"]}`, false, armParameterType{Type: "string"}},
+		{"missing type with mixed enum", `{"enum": ["a", 1]}`, false, armParameterType{Type: "string", Notes: []string{"integer or string"}}},
+		{"missing type with default", `{"default": true}`, false, armParameterType{Type: "bool"}},
+		{"missing type with properties", `{"properties": {"a": {"type": "string"}}}`, false, armParameterType{Type: "object"}},
+		{"format", `{"type": "string", "format": "date-time"}`, false, armParameterType{Type: "string", Notes: []string{"format: date-time"}}},
+		{"content encoding", `{"type": "string", "contentEncoding": "base64"}`, false, armParameterType{Type: "string", Notes: []string{"base64 encoded"}}},
+	}
+
+	for _, test := range tests {
+		var schema definition.Schema
+		assert.NilError(t, json.Unmarshal([]byte(test.schema), &schema), test.name)
+
+		result, err := toARMParameterType(&schema, test.sensitive)
+		assert.NilError(t, err, test.name)
+		assert.DeepEqual(t, result, test.expected)
+	}
+}
+
+func TestDefinitionPatterns(t *testing.T) {
+	patterns, err := getDefinitionPatterns([]byte(`{
+		"definitions": {
+			"name": {"type": "string", "pattern": "^[a-z]+$"},
+			"port": {"type": "integer"}
+		}
+	}`))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, patterns, definitionPatterns{"name": "^[a-z]+$"})
+
+	var schema definition.Schema
+	assert.NilError(t, json.Unmarshal([]byte(`{"type": "string", "format": "hostname"}`), &schema))
+
+	result, err := toARMParameterType(&schema, false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result.withPattern(patterns["name"]), armParameterType{Type: "string", Notes: []string{"format: hostname", "pattern: ^[a-z]+$"}})
+	assert.DeepEqual(t, result.withPattern(patterns["port"]), armParameterType{Type: "string", Notes: []string{"format: hostname"}})
+}
+
+func TestToOptionalARMParameterType(t *testing.T) {
+	tests := []struct {
+		name      string
+		schema    string
+		sensitive bool
+		expected  armParameterType
+	}{
+		{"string", `{"type": "string", "minLength": 1}`, false, armParameterType{Type: "string"}},
+		{"sensitive string", `{"type": "string"}`, true, armParameterType{Type: "securestring"}},
+		{"integer", `{"type": "integer", "minimum": 1, "maximum": 10}`, false, armParameterType{Type: "string", Notes: []string{"integer", "minimum 1", "maximum 10"}}},
+		{"boolean", `{"type": "boolean"}`, false, armParameterType{Type: "string", Notes: []string{"boolean"}}},
+		{"sensitive object", `{"type": "object"}`, true, armParameterType{Type: "securestring", Notes: []string{"JSON object"}}},
+		{"array", `{"type": "array"}`, false, armParameterType{Type: "string", Notes: []string{"JSON array"}}},
+		{"number", `{"type": "number", "minimum": 0}`, false, armParameterType{Type: "string", Notes: []string{"number", "minimum 0"}}},
+	}
+
+	for _, test := range tests {
+		var schema definition.Schema
+		assert.NilError(t, json.Unmarshal([]byte(test.schema), &schema), test.name)
+
+		result, err := toOptionalARMParameterType(&schema, test.sensitive)
+		assert.NilError(t, err, test.name)
+		assert.DeepEqual(t, result, test.expected)
+	}
+}
+
+func TestToARMParameterTypeErrors(t *testing.T) {
+	tests := []struct {
+		schema   definition.Schema
+		expected string
+	}{
+		{definition.Schema{Type: "date"}, "Unable to convert type 'date' to ARM template parameter type"},
+		{definition.Schema{Type: []interface{}{"string", "date"}}, "Unable to convert type 'date' to ARM template parameter type"},
+		{definition.Schema{Type: []interface{}{"string", 1}}, "Invalid type 1, types must be strings"},
+		{definition.Schema{Type: 1}, "Invalid type 1"},
+	}
+
+	for _, test := range tests {
+		_, err := toARMParameterType(&test.schema, false)
+		assert.ErrorContains(t, err, test.expected)
+	}
+
+	_, err := toARMParameterType(nil, false)
+	assert.ErrorContains(t, err, "Definition is missing")
+}
+
+func TestConvertValue(t *testing.T) {
+	stringType := armParameterType{Type: "string"}
+
+	value, err := stringType.convertValue(1.5)
+	assert.NilError(t, err)
+	assert.Equal(t, value, "1.5")
+
+	value, err = stringType.convertValue(map[string]interface{}{"a": "b"})
+	assert.NilError(t, err)
+	assert.Equal(t, value, `{"a":"b"}`)
+
+	value, err = armParameterType{Type: "int"}.convertValue(float64(3))
+	assert.NilError(t, err)
+	assert.Equal(t, value, float64(3))
+}
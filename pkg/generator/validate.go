@@ -0,0 +1,299 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/cnabio/cnab-go/bundle"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/armexpr"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/template"
+)
+
+// ValidateTemplateOptions is the set of options for configuring ValidateTemplate
+type ValidateTemplateOptions struct {
+	TemplateFile string
+	// BundleLoc is the bundle the template was generated from, if it and BundleTag are not set the template is not checked against the bundle
+	BundleLoc string
+	BundleTag string
+	// ParameterProfile, IncludeParameters and ExcludeParameters select the bundle parameters that the template is expected to expose, as they do for GenerateTemplate
+	ParameterProfile  string
+	IncludeParameters []string
+	ExcludeParameters []string
+}
+
+// ValidateTemplate checks a generated or hand edited template for mistakes that would otherwise only be found when it is deployed, returning a description of each problem found
+func ValidateTemplate(options ValidateTemplateOptions) ([]string, error) {
+	data, err := ioutil.ReadFile(options.TemplateFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read template file %s: %s", options.TemplateFile, err)
+	}
+
+	var generatedTemplate template.Template
+	if err := json.Unmarshal(data, &generatedTemplate); err != nil {
+		return nil, fmt.Errorf("Unable to parse template file %s: %s", options.TemplateFile, err)
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("Unable to parse template file %s: %s", options.TemplateFile, err)
+	}
+
+	problems := validateReferences(raw, generatedTemplate)
+	problems = append(problems, validateAllowedValues(generatedTemplate)...)
+	problems = append(problems, validateSecureValues(generatedTemplate)...)
+
+	if options.BundleLoc != "" || options.BundleTag != "" {
+		bundle, _, _, err := loadBundle(GenerateTemplateOptions{BundleLoc: options.BundleLoc, BundleTag: options.BundleTag})
+		if err != nil {
+			return nil, err
+		}
+
+		parameterFilter, err := NewParameterFilter(options.ParameterProfile, options.IncludeParameters, options.ExcludeParameters)
+		if err != nil {
+			return nil, err
+		}
+
+		problems = append(problems, validateBundleEnvironmentVariables(generatedTemplate, bundle, parameterFilter)...)
+	}
+
+	return problems, nil
+}
+
+// validateReferences checks that every parameters('x') and variables('x') call in the template refers to a parameter or variable that is defined
+func validateReferences(raw interface{}, generatedTemplate template.Template) []string {
+	var problems []string
+
+	walkTemplateStrings(raw, "", func(path string, value string) {
+		if !armexpr.IsExpression(value) {
+			return
+		}
+
+		node, err := armexpr.ParseTemplateString(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid expression %s: %s", path, value, err))
+			return
+		}
+
+		for _, name := range armexpr.References(node, "parameters") {
+			if _, ok := generatedTemplate.Parameters[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: parameter %s is not defined", path, name))
+			}
+		}
+
+		for _, name := range armexpr.References(node, "variables") {
+			if _, ok := generatedTemplate.Variables[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: variable %s is not defined", path, name))
+			}
+		}
+	})
+
+	return problems
+}
+
+// walkTemplateStrings calls visit with the path of every string value and property name in the template, in a stable order
+func walkTemplateStrings(value interface{}, path string, visit func(path string, value string)) {
+	switch v := value.(type) {
+	case string:
+		visit(path, v)
+	case []interface{}:
+		for i, item := range v {
+			walkTemplateStrings(item, fmt.Sprintf("%s[%d]", path, i), visit)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			itemPath := key
+			if path != "" {
+				itemPath = path + "." + key
+			}
+			visit(itemPath, key)
+			walkTemplateStrings(v[key], itemPath, visit)
+		}
+	}
+}
+
+// validateAllowedValues checks that the default value of each parameter with allowed values is one of them
+func validateAllowedValues(generatedTemplate template.Template) []string {
+	var problems []string
+
+	for _, name := range sortedParameterNames(generatedTemplate) {
+		parameter := generatedTemplate.Parameters[name]
+		if parameter.DefaultValue == nil || parameter.AllowedValues == nil {
+			continue
+		}
+
+		// A default set by an expression cannot be checked until it is deployed
+		if s, ok := parameter.DefaultValue.(string); ok && armexpr.IsExpression(s) {
+			continue
+		}
+
+		allowedValues, ok := parameter.AllowedValues.([]interface{})
+		if !ok {
+			problems = append(problems, fmt.Sprintf("parameters.%s: allowedValues must be an array", name))
+			continue
+		}
+
+		found := false
+		for _, allowedValue := range allowedValues {
+			if reflect.DeepEqual(allowedValue, parameter.DefaultValue) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			problems = append(problems, fmt.Sprintf("parameters.%s: the default value %v is not one of the allowed values", name, parameter.DefaultValue))
+		}
+	}
+
+	return problems
+}
+
+// validateSecureValues checks that container environment variables set from securestring or secureobject parameters, directly or through variables, use secureValue so the value is not shown in the portal
+func validateSecureValues(generatedTemplate template.Template) []string {
+	var problems []string
+
+	for _, environmentVariable := range getContainerEnvironmentVariables(generatedTemplate) {
+		if environmentVariable.Value == "" {
+			continue
+		}
+
+		if parameter, ok := findSecureParameter(environmentVariable.Value, generatedTemplate, map[string]bool{}); ok {
+			problems = append(problems, fmt.Sprintf("environment variable %s: value is set from the secure parameter %s, use secureValue instead", environmentVariable.Name, parameter))
+		}
+	}
+
+	return problems
+}
+
+// findSecureParameter finds a secure parameter referenced by an expression, following references to variables
+func findSecureParameter(value string, generatedTemplate template.Template, visited map[string]bool) (string, bool) {
+	node, err := armexpr.ParseTemplateString(value)
+	if err != nil {
+		return "", false
+	}
+
+	for _, name := range armexpr.References(node, "parameters") {
+		if parameter, ok := generatedTemplate.Parameters[name]; ok && isSecureType(parameter.Type) {
+			return name, true
+		}
+	}
+
+	for _, name := range armexpr.References(node, "variables") {
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+
+		if parameter, ok := findSecureParameter(generatedTemplate.Variables[name], generatedTemplate, visited); ok {
+			return parameter, true
+		}
+	}
+
+	return "", false
+}
+
+func isSecureType(armType string) bool {
+	return strings.EqualFold(armType, "securestring") || strings.EqualFold(armType, "secureobject")
+}
+
+// validateBundleEnvironmentVariables checks that every bundle parameter and credential is set by a container environment variable, and that every parameter and credential environment variable is defined by the bundle
+func validateBundleEnvironmentVariables(generatedTemplate template.Template, bundle *bundle.Bundle, parameterFilter ParameterFilter) []string {
+	names := common.GetEnvironmentVariableNames()
+
+	// Longer prefixes are checked first as they start with the shorter ones
+	parameterPrefixes := []string{names.CnabKeyVaultParameterPrefix, names.CnabParameterPrefix}
+	credentialPrefixes := []string{names.CnabKeyVaultCredentialFilePrefix, names.CnabKeyVaultCredentialPrefix, names.CnabCredentialFilePrefix, names.CnabCredentialPrefix}
+
+	parameters := map[string]bool{}
+	credentials := map[string]bool{}
+
+	var problems []string
+	for _, environmentVariable := range getContainerEnvironmentVariables(generatedTemplate) {
+		if name, ok := trimPrefixes(environmentVariable.Name, parameterPrefixes); ok {
+			parameters[name] = true
+			continue
+		}
+
+		if name, ok := trimPrefixes(environmentVariable.Name, credentialPrefixes); ok {
+			credentials[name] = true
+		}
+	}
+
+	bundleParameters := map[string]bool{}
+	for _, name := range sortedKeys(bundle.Parameters) {
+		safeName := common.ToSafeName(name)
+		bundleParameters[safeName] = true
+
+		if !parameterFilter.IsExcluded(name) && !parameters[safeName] {
+			problems = append(problems, fmt.Sprintf("bundle parameter %s is not set by a container environment variable", name))
+		}
+	}
+
+	bundleCredentials := map[string]bool{}
+	for _, name := range sortedKeys(bundle.Credentials) {
+		safeName := common.ToSafeName(name)
+		bundleCredentials[safeName] = true
+
+		if !credentials[safeName] {
+			problems = append(problems, fmt.Sprintf("bundle credential %s is not set by a container environment variable", name))
+		}
+	}
+
+	for _, name := range sortedKeys(parameters) {
+		if !bundleParameters[name] {
+			problems = append(problems, fmt.Sprintf("container environment variables set parameter %s which is not defined by the bundle", name))
+		}
+	}
+
+	for _, name := range sortedKeys(credentials) {
+		if !bundleCredentials[name] {
+			problems = append(problems, fmt.Sprintf("container environment variables set credential %s which is not defined by the bundle", name))
+		}
+	}
+
+	return problems
+}
+
+func trimPrefixes(name string, prefixes []string) (string, bool) {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix), true
+		}
+	}
+
+	return "", false
+}
+
+func sortedParameterNames(generatedTemplate template.Template) []string {
+	names := make([]string, 0, len(generatedTemplate.Parameters))
+	for name := range generatedTemplate.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// sortedKeys returns the keys of a map with string keys in order
+func sortedKeys(m interface{}) []string {
+	value := reflect.ValueOf(m)
+
+	keys := make([]string, 0, value.Len())
+	for _, key := range value.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,74 @@
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestValidateGeneratedTemplates(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+
+	tests := []GenerateTemplateOptions{
+		{},
+		{Simplify: true},
+		{KeyVault: true, ManagedIdentity: "user"},
+		{ManagedIdentity: "user", Simplify: true, Runner: "cnab", ConfigFile: true},
+		{LogFormat: "json", LogSink: "loganalytics"},
+		{LogSink: "http"},
+	}
+
+	for _, options := range tests {
+		options.BundleLoc = "testdata/bundle.json"
+		options.BundleTag = "cnabquickstarts.azurecr.io/porter/hello-world/bundle:1.0.0"
+		options.OutputFile = "testdata/generated/azuredeploy-validate.json"
+		options.Overwrite = true
+		options.Version = "latest"
+
+		err := GenerateTemplate(options)
+		assert.NilError(t, err)
+
+		problems, err := ValidateTemplate(ValidateTemplateOptions{
+			TemplateFile: options.OutputFile,
+			BundleLoc:    options.BundleLoc,
+		})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, problems, []string(nil))
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+
+	os.MkdirAll("testdata/generated", 0777)
+
+	data, err := ioutil.ReadFile("testdata/azuredeploy.json")
+	assert.NilError(t, err)
+
+	text := string(data)
+	text = strings.Replace(text, `"[parameters('cnab_action')]"`, `"[parameters('cnab_actions')]"`, 1)
+	text = strings.Replace(text, `"secureValue": "[parameters('person')]"`, `"value": "[parameters('person')]"`, 1)
+	text = strings.Replace(text, `"name": "CNAB_PARAM_place_of_birth"`, `"name": "CNAB_PARAM_birthplace"`, 1)
+	text = strings.Replace(text, `"defaultValue": "install"`, `"defaultValue": "deploy"`, 1)
+
+	templatePath := "testdata/generated/azuredeploy-invalid.json"
+	err = ioutil.WriteFile(templatePath, []byte(text), 0644)
+	assert.NilError(t, err)
+
+	problems, err := ValidateTemplate(ValidateTemplateOptions{
+		TemplateFile: templatePath,
+		BundleLoc:    "testdata/bundle.json",
+	})
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, problems, []string{
+		"variables.cnab_action: parameter cnab_actions is not defined",
+		"parameters.cnab_action: the default value deploy is not one of the allowed values",
+		"environment variable CNAB_PARAM_person: value is set from the secure parameter person, use secureValue instead",
+		"bundle parameter place_of_birth is not set by a container environment variable",
+		"container environment variables set parameter birthplace which is not defined by the bundle",
+	})
+}
@@ -0,0 +1,171 @@
+package keyvault
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+)
+
+const (
+	// DefaultTokenEndpoint is the Azure Instance Metadata Service endpoint used to get managed identity tokens
+	DefaultTokenEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+	resource   = "https://vault.azure.net"
+	apiVersion = "7.1"
+)
+
+// Client gets secrets from an Azure Key Vault using a managed identity
+type Client struct {
+	// VaultURL is the URL of the Key Vault, e.g. https://myvault.vault.azure.net
+	VaultURL string
+	// ClientID is the client id of the user assigned managed identity, if not set the system assigned identity is used
+	ClientID string
+	// TokenEndpoint is the endpoint used to get managed identity tokens, if not set DefaultTokenEndpoint is used
+	TokenEndpoint string
+	HTTPClient    *http.Client
+
+	token string
+}
+
+// NewClient creates a Client for the Key Vault with the given name
+func NewClient(vaultName string, clientID string) *Client {
+	return &Client{
+		VaultURL:   fmt.Sprintf("https://%s.vault.azure.net", vaultName),
+		ClientID:   clientID,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// GetSecret gets the current version of a secret
+func (client *Client) GetSecret(name string) (string, error) {
+	token, err := client.getToken()
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/secrets/%s?api-version=%s", strings.TrimSuffix(client.VaultURL, "/"), url.PathEscape(name), apiVersion), nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	var secret struct {
+		Value string `json:"value"`
+	}
+	if err := client.do(request, &secret); err != nil {
+		return "", fmt.Errorf("Unable to get secret %s: %s", name, err)
+	}
+
+	return secret.Value, nil
+}
+
+// getToken gets a token for Key Vault from the managed identity endpoint, the token is reused for subsequent requests
+func (client *Client) getToken() (string, error) {
+	if client.token != "" {
+		return client.token, nil
+	}
+
+	endpoint := client.TokenEndpoint
+	if endpoint == "" {
+		endpoint = DefaultTokenEndpoint
+	}
+
+	query := url.Values{}
+	query.Set("api-version", "2018-02-01")
+	query.Set("resource", resource)
+	if client.ClientID != "" {
+		query.Set("client_id", client.ClientID)
+	}
+
+	request, err := http.NewRequest(http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Metadata", "true")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := client.do(request, &token); err != nil {
+		return "", fmt.Errorf("Unable to get managed identity token: %s", err)
+	}
+
+	client.token = token.AccessToken
+	return client.token, nil
+}
+
+func (client *Client) do(request *http.Request, result interface{}) error {
+	httpClient := client.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+// SecretGetter gets the value of a secret
+type SecretGetter interface {
+	GetSecret(name string) (string, error)
+}
+
+// SetEnvironmentVariables gets the Key Vault secrets referenced by CNAB_KEYVAULT_* environment variables and sets the parameter and credential environment variables to their values
+func SetEnvironmentVariables(secrets SecretGetter) error {
+	names := common.GetEnvironmentVariableNames()
+
+	// The file prefix must be checked first as it starts with the credential prefix
+	prefixes := []struct {
+		keyVaultPrefix string
+		prefix         string
+	}{
+		{names.CnabKeyVaultCredentialFilePrefix, names.CnabCredentialFilePrefix},
+		{names.CnabKeyVaultCredentialPrefix, names.CnabCredentialPrefix},
+		{names.CnabKeyVaultParameterPrefix, names.CnabParameterPrefix},
+	}
+
+	for _, env := range os.Environ() {
+		envVar := strings.SplitN(env, "=", 2)
+		if len(envVar) != 2 || envVar[1] == "" {
+			continue
+		}
+
+		for _, p := range prefixes {
+			if !strings.HasPrefix(envVar[0], p.keyVaultPrefix) {
+				continue
+			}
+
+			value, err := secrets.GetSecret(envVar[1])
+			if err != nil {
+				return err
+			}
+
+			if err := os.Setenv(p.prefix+strings.TrimPrefix(envVar[0], p.keyVaultPrefix), value); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	return nil
+}
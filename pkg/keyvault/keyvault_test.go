@@ -0,0 +1,82 @@
+package keyvault
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestGetSecret(t *testing.T) {
+	tokenRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			tokenRequests++
+			assert.Equal(t, r.Header.Get("Metadata"), "true")
+			assert.Equal(t, r.URL.Query().Get("resource"), "https://vault.azure.net")
+			assert.Equal(t, r.URL.Query().Get("client_id"), "client")
+			fmt.Fprint(w, `{"access_token":"token"}`)
+		case "/secrets/db-password":
+			assert.Equal(t, r.Header.Get("Authorization"), "Bearer token")
+			fmt.Fprint(w, `{"value":"secret"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"code":"SecretNotFound"}}`)
+		}
+	}))
+	defer server.Close()
+
+	client := &Client{
+		VaultURL:      server.URL,
+		ClientID:      "client",
+		TokenEndpoint: server.URL + "/token",
+	}
+
+	value, err := client.GetSecret("db-password")
+	assert.NilError(t, err)
+	assert.Equal(t, value, "secret")
+
+	_, err = client.GetSecret("missing")
+	assert.ErrorContains(t, err, "Unable to get secret missing: 404 Not Found")
+
+	assert.Equal(t, tokenRequests, 1)
+}
+
+type fakeSecrets map[string]string
+
+func (secrets fakeSecrets) GetSecret(name string) (string, error) {
+	value, ok := secrets[name]
+	if !ok {
+		return "", fmt.Errorf("Secret %s not found", name)
+	}
+	return value, nil
+}
+
+func TestSetEnvironmentVariables(t *testing.T) {
+	os.Setenv("CNAB_KEYVAULT_PARAM_db_password", "db-password")
+	os.Setenv("CNAB_KEYVAULT_CRED_token", "token")
+	os.Setenv("CNAB_KEYVAULT_CRED_FILE_kubeconfig", "kubeconfig")
+	os.Setenv("CNAB_KEYVAULT_CRED_optional", "")
+	defer func() {
+		for _, name := range []string{"CNAB_KEYVAULT_PARAM_db_password", "CNAB_KEYVAULT_CRED_token", "CNAB_KEYVAULT_CRED_FILE_kubeconfig", "CNAB_KEYVAULT_CRED_optional", "CNAB_PARAM_db_password", "CNAB_CRED_token", "CNAB_CRED_FILE_kubeconfig"} {
+			os.Unsetenv(name)
+		}
+	}()
+
+	err := SetEnvironmentVariables(fakeSecrets{
+		"db-password": "password",
+		"token":       "abc",
+		"kubeconfig":  "YXBpVmVyc2lvbjogdjE=",
+	})
+	assert.NilError(t, err)
+
+	assert.Equal(t, os.Getenv("CNAB_PARAM_db_password"), "password")
+	assert.Equal(t, os.Getenv("CNAB_CRED_token"), "abc")
+	assert.Equal(t, os.Getenv("CNAB_CRED_FILE_kubeconfig"), "YXBpVmVyc2lvbjogdjE=")
+	_, ok := os.LookupEnv("CNAB_CRED_optional")
+	assert.Assert(t, !ok)
+}
@@ -0,0 +1,59 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// HTTPSink posts batches of log records to an HTTP endpoint as a JSON array
+type HTTPSink struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// NewHTTPSink creates an HTTPSink that posts records to the URL
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{
+		URL:        url,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Send posts the records to the URL
+func (sink *HTTPSink) Send(records []Record) error {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, sink.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	return send(sink.HTTPClient, request)
+}
+
+func send(client *http.Client, request *http.Request) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("%s %s returned %s: %s", request.Method, request.URL.Redacted(), response.Status, string(body))
+	}
+
+	return nil
+}
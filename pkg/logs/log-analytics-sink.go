@@ -0,0 +1,89 @@
+package logs
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLogType is the name of the Log Analytics custom log that records are sent to, Log Analytics adds the _CL suffix to the table name
+	DefaultLogType = "CnabArmDriver"
+
+	logAnalyticsAPIVersion = "2016-04-01"
+)
+
+// LogAnalyticsSink sends log records to a Log Analytics workspace using the HTTP Data Collector API
+type LogAnalyticsSink struct {
+	WorkspaceID string
+	SharedKey   []byte
+	// LogType is the name of the custom log, if not set DefaultLogType is used
+	LogType string
+	// Endpoint is the Data Collector API endpoint, e.g. https://<workspace id>.ods.opinsights.azure.com
+	Endpoint   string
+	HTTPClient *http.Client
+
+	now func() time.Time
+}
+
+// NewLogAnalyticsSink creates a LogAnalyticsSink for a workspace in the Azure public cloud, the shared key is the base64 encoded primary or secondary key of the workspace
+func NewLogAnalyticsSink(workspaceID string, sharedKey string) (*LogAnalyticsSink, error) {
+	key, err := base64.StdEncoding.DecodeString(sharedKey)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid Log Analytics shared key: %s", err)
+	}
+
+	return &LogAnalyticsSink{
+		WorkspaceID: workspaceID,
+		SharedKey:   key,
+		Endpoint:    fmt.Sprintf("https://%s.ods.opinsights.azure.com", workspaceID),
+		HTTPClient:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Send posts the records to the workspace, the record timestamp is used as the time the record was generated
+func (sink *LogAnalyticsSink) Send(records []Record) error {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now
+	if sink.now != nil {
+		now = sink.now
+	}
+	date := now().UTC().Format(http.TimeFormat)
+
+	logType := sink.LogType
+	if logType == "" {
+		logType = DefaultLogType
+	}
+
+	request, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/logs?api-version=%s", strings.TrimSuffix(sink.Endpoint, "/"), logAnalyticsAPIVersion), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Log-Type", logType)
+	request.Header.Set("x-ms-date", date)
+	request.Header.Set("time-generated-field", "timestamp")
+	request.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", sink.WorkspaceID, sink.sign(len(data), date)))
+
+	return send(sink.HTTPClient, request)
+}
+
+// sign creates the signature for a request to the Data Collector API
+func (sink *LogAnalyticsSink) sign(contentLength int, date string) string {
+	stringToSign := fmt.Sprintf("POST\n%d\napplication/json\nx-ms-date:%s\n/api/logs", contentLength, date)
+
+	mac := hmac.New(sha256.New, sink.SharedKey)
+	mac.Write([]byte(stringToSign))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
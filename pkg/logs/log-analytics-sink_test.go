@@ -0,0 +1,40 @@
+package logs
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLogAnalyticsSink(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte("shared-key"))
+
+	sink, err := NewLogAnalyticsSink("workspace", key)
+	assert.NilError(t, err)
+	assert.Equal(t, sink.Endpoint, "https://workspace.ods.opinsights.azure.com")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/api/logs")
+		assert.Equal(t, r.URL.Query().Get("api-version"), "2016-04-01")
+		assert.Equal(t, r.Header.Get("Log-Type"), DefaultLogType)
+		assert.Equal(t, r.Header.Get("x-ms-date"), "Thu, 01 Oct 2020 12:00:00 GMT")
+		assert.Equal(t, r.Header.Get("time-generated-field"), "timestamp")
+		assert.Equal(t, r.Header.Get("Authorization"), "SharedKey workspace:"+sink.sign(int(r.ContentLength), "Thu, 01 Oct 2020 12:00:00 GMT"))
+	}))
+	defer server.Close()
+
+	sink.Endpoint = server.URL
+	sink.now = testNow
+
+	err = sink.Send([]Record{{Timestamp: testNow(), Action: "install", Stream: StreamStdout, Message: "hello"}})
+	assert.NilError(t, err)
+
+	// The signature is an HMAC-SHA256 of the request details using the decoded key
+	assert.Equal(t, sink.sign(10, "Thu, 01 Oct 2020 12:00:00 GMT"), "3gEZPjDj2ONDdn9tmzcmO+MxiFAMwkt06fDu6ztBvRA=")
+
+	_, err = NewLogAnalyticsSink("workspace", "not base64!")
+	assert.ErrorContains(t, err, "Invalid Log Analytics shared key")
+}
@@ -0,0 +1,287 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FormatText writes the output of the action as it is
+	FormatText = "text"
+	// FormatJSON writes each line of the output of the action as a JSON log record
+	FormatJSON = "json"
+
+	// StreamStdout and StreamStderr identify the stream a line of output was written to
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+
+	defaultBatchSize     = 100
+	defaultFlushInterval = 5 * time.Second
+	defaultQueueSize     = 10
+)
+
+// Record is a line of output from a bundle action
+type Record struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Action       string    `json:"action"`
+	Installation string    `json:"installation"`
+	Stream       string    `json:"stream"`
+	Message      string    `json:"message"`
+}
+
+// Sink receives log records, e.g. to store them in Log Analytics so they can be searched
+type Sink interface {
+	// Send sends a batch of records
+	Send(records []Record) error
+}
+
+// Logger captures the output of a bundle action line by line, writes it in the selected format and forwards the records to the sink
+// Records are sent to the sink in the background so that a slow sink does not hold up the output of the action, the logger must be closed to send the remaining records
+type Logger struct {
+	Action       string
+	Installation string
+	// Format is FormatText or FormatJSON, if not set the output is written as it is
+	Format string
+	// Sink receives the records in batches, if nil the records are not forwarded
+	Sink Sink
+	// BatchSize is the number of records that are sent to the sink at once, if not set 100 records are sent at once
+	BatchSize int
+	// FlushInterval is how often records are sent to the sink when there is not a full batch, so that records are forwarded while the action runs, if not set records are sent every 5 seconds
+	FlushInterval time.Duration
+	// QueueSize is the number of batches that can wait to be sent, batches are dropped when the queue is full, if not set 10 batches can wait
+	QueueSize int
+
+	mutex   sync.Mutex
+	pending []Record
+	now     func() time.Time
+	batches chan []Record
+	stopped chan struct{}
+	closed  bool
+	failed  int
+	err     error
+}
+
+// IsValidFormat checks if the format is supported, an empty format is the default text format
+func IsValidFormat(format string) bool {
+	return format == "" || format == FormatText || format == FormatJSON
+}
+
+// Writer returns a writer for a stream of the action output, each line is written to out in the logger format and forwarded to the sink
+// The writer must be closed once the action completes to write any output that does not end with a new line
+func (logger *Logger) Writer(stream string, out io.Writer) io.WriteCloser {
+	return &lineWriter{
+		logger: logger,
+		stream: stream,
+		out:    out,
+	}
+}
+
+// Close sends the remaining records to the sink and waits for the queued records to be sent, an error is returned if any records could not be sent
+// Output that is written after the logger is closed is not forwarded
+func (logger *Logger) Close() error {
+	logger.mutex.Lock()
+	if logger.closed || logger.batches == nil {
+		logger.closed = true
+		logger.mutex.Unlock()
+		return nil
+	}
+	logger.closed = true
+	records := logger.pending
+	logger.pending = nil
+	logger.mutex.Unlock()
+
+	// Nothing else queues records once the logger is closed, so the remaining records wait for the queue rather than being dropped
+	if len(records) > 0 {
+		logger.batches <- records
+	}
+	close(logger.batches)
+	<-logger.stopped
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	if logger.failed > 0 {
+		return fmt.Errorf("Unable to send %d log records: %s", logger.failed, logger.err)
+	}
+
+	return nil
+}
+
+// log writes a line of output and adds it to the records for the sink, the records are queued to be sent once there is a batch of them
+func (logger *Logger) log(stream string, message string, out io.Writer) error {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	now := time.Now
+	if logger.now != nil {
+		now = logger.now
+	}
+
+	record := Record{
+		Timestamp:    now().UTC(),
+		Action:       logger.Action,
+		Installation: logger.Installation,
+		Stream:       stream,
+		Message:      message,
+	}
+
+	var err error
+	if logger.Format == FormatJSON {
+		var data []byte
+		data, err = json.Marshal(record)
+		if err == nil {
+			_, err = fmt.Fprintf(out, "%s\n", data)
+		}
+	} else {
+		_, err = fmt.Fprintln(out, message)
+	}
+	if err != nil {
+		return err
+	}
+
+	if logger.Sink == nil || logger.closed {
+		return nil
+	}
+
+	if logger.batches == nil {
+		logger.start()
+	}
+
+	logger.pending = append(logger.pending, record)
+
+	batchSize := logger.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	if len(logger.pending) >= batchSize {
+		logger.queuePending()
+	}
+
+	return nil
+}
+
+// start starts sending records to the sink in the background, the mutex must be held
+func (logger *Logger) start() {
+	queueSize := logger.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	interval := logger.FlushInterval
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+
+	logger.batches = make(chan []Record, queueSize)
+	logger.stopped = make(chan struct{})
+
+	go logger.run(logger.batches, interval)
+}
+
+// run sends the queued batches to the sink until the queue is closed, the pending records are queued at each flush interval
+func (logger *Logger) run(batches <-chan []Record, interval time.Duration) {
+	defer close(logger.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case records, ok := <-batches:
+			if !ok {
+				return
+			}
+			logger.send(records)
+		case <-ticker.C:
+			logger.mutex.Lock()
+			if !logger.closed {
+				logger.queuePending()
+			}
+			logger.mutex.Unlock()
+		}
+	}
+}
+
+// send sends a batch to the sink, the action keeps running if the sink is unavailable as the records are still written to the output
+func (logger *Logger) send(records []Record) {
+	if err := logger.Sink.Send(records); err != nil {
+		log.Printf("Unable to send %d log records: %s\n", len(records), err)
+		logger.fail(len(records), err)
+	}
+}
+
+// queuePending queues the pending records to be sent, they are dropped if the queue is full so that a slow sink does not hold up the action, the mutex must be held
+func (logger *Logger) queuePending() {
+	if len(logger.pending) == 0 {
+		return
+	}
+
+	records := logger.pending
+	logger.pending = nil
+
+	select {
+	case logger.batches <- records:
+	default:
+		log.Printf("Dropped %d log records as the log sink is not keeping up\n", len(records))
+		logger.failed += len(records)
+		logger.err = fmt.Errorf("The log sink is not keeping up")
+	}
+}
+
+func (logger *Logger) fail(count int, err error) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	logger.failed += count
+	logger.err = err
+}
+
+// lineWriter splits the output written to it into lines, it can be written to concurrently, e.g. when a driver copies stdout and stderr to the same writer
+type lineWriter struct {
+	logger *Logger
+	stream string
+	out    io.Writer
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (writer *lineWriter) Write(p []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	writer.buffer.Write(p)
+
+	for {
+		index := bytes.IndexByte(writer.buffer.Bytes(), '\n')
+		if index < 0 {
+			return len(p), nil
+		}
+
+		line := string(writer.buffer.Next(index + 1))
+		if err := writer.logger.log(writer.stream, strings.TrimRight(line, "\r\n"), writer.out); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// Close writes any output that does not end with a new line
+func (writer *lineWriter) Close() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.buffer.Len() == 0 {
+		return nil
+	}
+
+	line := writer.buffer.String()
+	writer.buffer.Reset()
+
+	return writer.logger.log(writer.stream, strings.TrimRight(line, "\r"), writer.out)
+}
@@ -0,0 +1,185 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+type testSink struct {
+	mutex   sync.Mutex
+	batches [][]Record
+	err     error
+	// block holds up Send until it is closed
+	block chan struct{}
+}
+
+func (sink *testSink) Send(records []Record) error {
+	if sink.block != nil {
+		<-sink.block
+	}
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	sink.batches = append(sink.batches, records)
+	return sink.err
+}
+
+func (sink *testSink) getBatches() [][]Record {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	return append([][]Record{}, sink.batches...)
+}
+
+// waitForBatches waits for the sink to receive the number of batches as they are sent in the background
+func (sink *testSink) waitForBatches(t *testing.T, count int) [][]Record {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		batches := sink.getBatches()
+		if len(batches) >= count || time.Now().After(deadline) {
+			assert.Equal(t, len(batches), count)
+			return batches
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func testNow() time.Time {
+	return time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+}
+
+func TestJSONFormat(t *testing.T) {
+	logger := &Logger{Action: "install", Installation: "mybundle1", Format: FormatJSON, now: testNow}
+
+	var out bytes.Buffer
+	writer := logger.Writer(StreamStderr, &out)
+
+	_, err := fmt.Fprint(writer, "Installing\r\nDone")
+	assert.NilError(t, err)
+	assert.Equal(t, out.String(), `{"timestamp":"2020-10-01T12:00:00Z","action":"install","installation":"mybundle1","stream":"stderr","message":"Installing"}`+"\n")
+
+	err = writer.Close()
+	assert.NilError(t, err)
+	assert.Equal(t, out.String(), `{"timestamp":"2020-10-01T12:00:00Z","action":"install","installation":"mybundle1","stream":"stderr","message":"Installing"}`+"\n"+
+		`{"timestamp":"2020-10-01T12:00:00Z","action":"install","installation":"mybundle1","stream":"stderr","message":"Done"}`+"\n")
+}
+
+func TestTextFormatWithSink(t *testing.T) {
+	sink := &testSink{}
+	logger := &Logger{Action: "upgrade", Installation: "mybundle1", Sink: sink, BatchSize: 2, now: testNow}
+
+	var out bytes.Buffer
+	stdout := logger.Writer(StreamStdout, &out)
+	stderr := logger.Writer(StreamStderr, &out)
+
+	fmt.Fprintln(stdout, "one")
+	fmt.Fprintln(stderr, "two")
+	fmt.Fprintln(stdout, "three")
+
+	assert.Equal(t, out.String(), "one\ntwo\nthree\n")
+	batches := sink.waitForBatches(t, 1)
+	assert.DeepEqual(t, batches[0], []Record{
+		{Timestamp: testNow(), Action: "upgrade", Installation: "mybundle1", Stream: StreamStdout, Message: "one"},
+		{Timestamp: testNow(), Action: "upgrade", Installation: "mybundle1", Stream: StreamStderr, Message: "two"},
+	})
+
+	err := logger.Close()
+	assert.NilError(t, err)
+	batches = sink.getBatches()
+	assert.Equal(t, len(batches), 2)
+	assert.Equal(t, batches[1][0].Message, "three")
+
+	fmt.Fprintln(stdout, "after close")
+	err = logger.Close()
+	assert.NilError(t, err)
+	assert.Equal(t, len(sink.getBatches()), 2)
+}
+
+func TestFlushInterval(t *testing.T) {
+	sink := &testSink{}
+	logger := &Logger{Sink: sink, FlushInterval: 10 * time.Millisecond}
+
+	var out bytes.Buffer
+	fmt.Fprintln(logger.Writer(StreamStdout, &out), "not a full batch")
+
+	batches := sink.waitForBatches(t, 1)
+	assert.Equal(t, batches[0][0].Message, "not a full batch")
+
+	err := logger.Close()
+	assert.NilError(t, err)
+	assert.Equal(t, len(sink.getBatches()), 1)
+}
+
+func TestSlowSink(t *testing.T) {
+	sink := &testSink{block: make(chan struct{})}
+	logger := &Logger{Sink: sink, BatchSize: 1, QueueSize: 1}
+
+	// The first batch is held up by the sink, the second waits in the queue and the rest are dropped rather than holding up the output
+	var out bytes.Buffer
+	writer := logger.Writer(StreamStdout, &out)
+	for i := 0; i < 5; i++ {
+		_, err := fmt.Fprintln(writer, i)
+		assert.NilError(t, err)
+	}
+	assert.Equal(t, out.String(), "0\n1\n2\n3\n4\n")
+
+	close(sink.block)
+	err := logger.Close()
+	assert.ErrorContains(t, err, "Unable to send")
+	assert.Assert(t, len(sink.getBatches()) < 5)
+}
+
+func TestSinkErrors(t *testing.T) {
+	sink := &testSink{err: fmt.Errorf("unavailable")}
+	logger := &Logger{Sink: sink, BatchSize: 1}
+
+	var out bytes.Buffer
+	_, err := fmt.Fprintln(logger.Writer(StreamStdout, &out), "still written")
+	assert.NilError(t, err)
+	assert.Equal(t, out.String(), "still written\n")
+
+	logger.mutex.Lock()
+	logger.BatchSize = 10
+	logger.mutex.Unlock()
+	fmt.Fprintln(logger.Writer(StreamStdout, &out), "pending")
+
+	err = logger.Close()
+	assert.Error(t, err, "Unable to send 2 log records: unavailable")
+}
+
+func TestHTTPSink(t *testing.T) {
+	var received []Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.Method, http.MethodPost)
+		assert.Equal(t, r.Header.Get("Content-Type"), "application/json")
+
+		data, err := ioutil.ReadAll(r.Body)
+		assert.NilError(t, err)
+		assert.NilError(t, json.Unmarshal(data, &received))
+
+		if received[0].Message == "fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "bad record")
+		}
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.URL + "/logs")
+
+	err := sink.Send([]Record{{Timestamp: testNow(), Action: "install", Stream: StreamStdout, Message: "hello"}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, received, []Record{{Timestamp: testNow(), Action: "install", Stream: StreamStdout, Message: "hello"}})
+
+	err = sink.Send([]Record{{Message: "fail"}})
+	assert.ErrorContains(t, err, "returned 400 Bad Request: bad record")
+}
@@ -0,0 +1,220 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CredentialsFunc returns the username and password to use for a registry, empty values mean anonymous access
+type CredentialsFunc func(registry string) (username string, password string, err error)
+
+type dockerConfig struct {
+	Auths map[string]dockerConfigAuth `json:"auths"`
+}
+
+type dockerConfigAuth struct {
+	Auth     string `json:"auth,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+// DockerConfigCredentials reads credentials for a registry from the docker config file ($DOCKER_CONFIG/config.json or ~/.docker/config.json), credential helpers are not supported
+func DockerConfigCredentials(registry string) (string, string, error) {
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", nil
+		}
+		configDir = filepath.Join(home, ".docker")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", "", nil
+		}
+		return "", "", err
+	}
+
+	var config dockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", "", fmt.Errorf("Unable to parse docker config: %s", err)
+	}
+
+	keys := []string{registry, "https://" + registry, "http://" + registry}
+	if registry == dockerHubDomain {
+		keys = append(keys, "https://index.docker.io/v1/")
+	}
+
+	for _, key := range keys {
+		auth, ok := config.Auths[key]
+		if !ok {
+			continue
+		}
+
+		if auth.Auth == "" {
+			return auth.Username, auth.Password, nil
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return "", "", fmt.Errorf("Unable to decode docker config auth for %s: %s", registry, err)
+		}
+
+		splits := strings.SplitN(string(decoded), ":", 2)
+		if len(splits) != 2 {
+			return "", "", fmt.Errorf("Invalid docker config auth for %s", registry)
+		}
+
+		return splits[0], splits[1], nil
+	}
+
+	return "", "", nil
+}
+
+// authenticate responds to a WWW-Authenticate challenge, storing the resulting authorization header for the registry
+func (c *client) authenticate(reference Reference, challenge string) error {
+	username, password, err := c.credentials(reference.Registry)
+	if err != nil {
+		return err
+	}
+
+	scheme, params := parseChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if username == "" {
+			return fmt.Errorf("registry %s requires credentials", reference.Registry)
+		}
+		c.tokens[reference.host()] = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	case "bearer":
+		token, err := c.fetchToken(reference, params, username, password)
+		if err != nil {
+			return fmt.Errorf("Unable to authenticate with registry %s: %s", reference.Registry, err)
+		}
+		c.tokens[reference.host()] = "Bearer " + token
+	default:
+		return fmt.Errorf("registry %s returned unsupported authentication challenge: %s", reference.Registry, challenge)
+	}
+
+	return nil
+}
+
+func (c *client) fetchToken(reference Reference, params map[string]string, username string, password string) (string, error) {
+	realm, ok := params["realm"]
+	if !ok {
+		return "", fmt.Errorf("challenge does not contain a realm")
+	}
+
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return "", err
+	}
+
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", reference.Repository)
+	}
+
+	query := tokenURL.Query()
+	query.Set("scope", scope)
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	tokenURL.RawQuery = query.Encode()
+
+	request, err := http.NewRequest(http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if username != "" {
+		request.SetBasicAuth(username, password)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %s", response.Status)
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	if token.Token != "" {
+		return token.Token, nil
+	}
+
+	if token.AccessToken != "" {
+		return token.AccessToken, nil
+	}
+
+	return "", fmt.Errorf("token endpoint did not return a token")
+}
+
+// parseChallenge parses a WWW-Authenticate header such as Bearer realm="https://auth",service="registry"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+
+	splits := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	scheme := splits[0]
+	if len(splits) == 1 {
+		return scheme, params
+	}
+
+	remainder := splits[1]
+	for remainder != "" {
+		i := strings.Index(remainder, "=")
+		if i < 0 {
+			break
+		}
+
+		key := strings.ToLower(strings.TrimSpace(remainder[:i]))
+		remainder = remainder[i+1:]
+
+		var value string
+		if strings.HasPrefix(remainder, `"`) {
+			end := strings.Index(remainder[1:], `"`)
+			if end < 0 {
+				value = remainder[1:]
+				remainder = ""
+			} else {
+				value = remainder[1 : end+1]
+				remainder = remainder[end+2:]
+			}
+		} else {
+			end := strings.Index(remainder, ",")
+			if end < 0 {
+				value = remainder
+				remainder = ""
+			} else {
+				value = remainder[:end]
+				remainder = remainder[end:]
+			}
+		}
+
+		params[key] = strings.TrimSpace(value)
+		remainder = strings.TrimLeft(remainder, ", ")
+	}
+
+	return scheme, params
+}
@@ -0,0 +1,98 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	dockerHubDomain   = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+)
+
+// Reference defines the location of a bundle in an OCI registry
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses a bundle tag such as myregistry.azurecr.io/foo/bundle:1.0.0 into a Reference
+func ParseReference(tag string) (Reference, error) {
+	var reference Reference
+
+	if tag == "" {
+		return reference, fmt.Errorf("Bundle tag must be specified")
+	}
+
+	remainder := tag
+	if i := strings.Index(remainder, "@"); i >= 0 {
+		reference.Digest = remainder[i+1:]
+		remainder = remainder[:i]
+		if !strings.Contains(reference.Digest, ":") {
+			return reference, fmt.Errorf("Invalid digest in bundle tag: %s", tag)
+		}
+	}
+
+	// The registry is only present if the first path component looks like a host name
+	parts := strings.SplitN(remainder, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		reference.Registry = parts[0]
+		remainder = parts[1]
+	} else {
+		reference.Registry = dockerHubDomain
+	}
+
+	if i := strings.LastIndex(remainder, ":"); i >= 0 {
+		reference.Tag = remainder[i+1:]
+		remainder = remainder[:i]
+	}
+
+	if remainder == "" {
+		return reference, fmt.Errorf("Invalid bundle tag, repository is missing: %s", tag)
+	}
+
+	if reference.Registry == dockerHubDomain && !strings.Contains(remainder, "/") {
+		remainder = "library/" + remainder
+	}
+
+	reference.Repository = remainder
+
+	if reference.Tag == "" && reference.Digest == "" {
+		reference.Tag = "latest"
+	}
+
+	return reference, nil
+}
+
+// String returns the reference in the form registry/repository:tag@digest
+func (reference Reference) String() string {
+	s := reference.Registry + "/" + reference.Repository
+	if reference.Tag != "" {
+		s += ":" + reference.Tag
+	}
+	if reference.Digest != "" {
+		s += "@" + reference.Digest
+	}
+
+	return s
+}
+
+// host returns the host name used to talk to the registry API
+func (reference Reference) host() string {
+	if reference.Registry == dockerHubDomain {
+		return dockerHubRegistry
+	}
+
+	return reference.Registry
+}
+
+// manifestReference returns the digest if present otherwise the tag, as used in the manifests API
+func (reference Reference) manifestReference() string {
+	if reference.Digest != "" {
+		return reference.Digest
+	}
+
+	return reference.Tag
+}
@@ -0,0 +1,271 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cnabio/cnab-go/bundle"
+)
+
+const (
+	mediaTypeOCIIndex          = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest       = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerManifestV2  = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestSet = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// cnabManifestTypeAnnotation is set by cnab-to-oci on the index entries to identify the bundle config manifest
+	cnabManifestTypeAnnotation = "io.cnab.manifest.type"
+	cnabManifestTypeConfig     = "config"
+
+	// maxBlobSize limits the size of manifests and bundle configs read from a registry
+	maxBlobSize = 4 * 1024 * 1024
+)
+
+// Client pulls bundles from an OCI registry
+type Client interface {
+	// PullBundle fetches the bundle.json for the bundle tag from the registry
+	PullBundle(tag string) (*bundle.Bundle, error)
+	// PullBundleData fetches the bundle.json for the bundle tag from the registry as it was pushed, e.g. to read keywords that cnab-go does not parse
+	PullBundleData(tag string) ([]byte, error)
+}
+
+// ClientOptions is the set of options for configuring the registry client created by NewClient
+type ClientOptions struct {
+	// HTTPClient is used to make requests to the registry, a client with a 60 second timeout is used if not set
+	HTTPClient *http.Client
+	// Insecure specifies if to use plain http rather than https to talk to the registry
+	Insecure bool
+	// Credentials returns the credentials for a registry, if not set credentials are read from the docker config file
+	Credentials CredentialsFunc
+}
+
+type client struct {
+	httpClient  *http.Client
+	scheme      string
+	credentials CredentialsFunc
+	tokens      map[string]string
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Config    *descriptor  `json:"config,omitempty"`
+	Manifests []descriptor `json:"manifests,omitempty"`
+}
+
+// NewClient creates a registry client that resolves bundles pushed with cnab-to-oci (e.g. using porter publish)
+func NewClient(options ClientOptions) Client {
+	httpClient := options.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 60 * time.Second}
+	}
+
+	scheme := "https"
+	if options.Insecure {
+		scheme = "http"
+	}
+
+	credentials := options.Credentials
+	if credentials == nil {
+		credentials = DockerConfigCredentials
+	}
+
+	return &client{
+		httpClient:  httpClient,
+		scheme:      scheme,
+		credentials: credentials,
+		tokens:      map[string]string{},
+	}
+}
+
+// PullBundle fetches the bundle.json for the bundle tag from the registry
+func (c *client) PullBundle(tag string) (*bundle.Bundle, error) {
+	data, err := c.PullBundleData(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := bundle.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse bundle from %s: %s", tag, err)
+	}
+
+	return b, nil
+}
+
+func (c *client) PullBundleData(tag string) ([]byte, error) {
+	reference, err := ParseReference(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := c.getManifest(reference, reference.manifestReference())
+	if err != nil {
+		return nil, err
+	}
+
+	// cnab-to-oci pushes an index, with the bundle config in a manifest annotated as the config manifest
+	if m.MediaType == mediaTypeOCIIndex || m.MediaType == mediaTypeDockerManifestSet || len(m.Manifests) > 0 {
+		configManifest, err := findConfigManifest(m)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find bundle in %s: %s", reference, err)
+		}
+
+		if m, err = c.getManifest(reference, configManifest.Digest); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.Config == nil {
+		return nil, fmt.Errorf("Unable to find bundle in %s: manifest has no config", reference)
+	}
+
+	return c.getBlob(reference, *m.Config)
+}
+
+func findConfigManifest(index manifest) (descriptor, error) {
+	for _, m := range index.Manifests {
+		if m.Annotations[cnabManifestTypeAnnotation] == cnabManifestTypeConfig {
+			return m, nil
+		}
+	}
+
+	return descriptor{}, fmt.Errorf("index does not contain a manifest annotated with %s=%s", cnabManifestTypeAnnotation, cnabManifestTypeConfig)
+}
+
+func (c *client) getManifest(reference Reference, manifestReference string) (manifest, error) {
+	var m manifest
+
+	url := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", c.scheme, reference.host(), reference.Repository, manifestReference)
+	accept := []string{mediaTypeOCIIndex, mediaTypeDockerManifestSet, mediaTypeOCIManifest, mediaTypeDockerManifestV2}
+
+	data, err := c.get(reference, url, strings.Join(accept, ", "))
+	if err != nil {
+		return m, fmt.Errorf("Unable to get manifest %s for %s: %s", manifestReference, reference, err)
+	}
+
+	if strings.HasPrefix(manifestReference, "sha256:") {
+		if err := VerifyDigest(data, manifestReference); err != nil {
+			return m, fmt.Errorf("Manifest %s for %s failed verification: %s", manifestReference, reference, err)
+		}
+	}
+
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("Unable to parse manifest %s for %s: %s", manifestReference, reference, err)
+	}
+
+	return m, nil
+}
+
+func (c *client) getBlob(reference Reference, blob descriptor) ([]byte, error) {
+	url := fmt.Sprintf("%s://%s/v2/%s/blobs/%s", c.scheme, reference.host(), reference.Repository, blob.Digest)
+
+	data, err := c.get(reference, url, "")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get blob %s for %s: %s", blob.Digest, reference, err)
+	}
+
+	if err := VerifyDigest(data, blob.Digest); err != nil {
+		return nil, fmt.Errorf("Blob %s for %s failed verification: %s", blob.Digest, reference, err)
+	}
+
+	return data, nil
+}
+
+// get performs a GET request, authenticating with the registry if it returns a challenge
+func (c *client) get(reference Reference, url string, accept string) ([]byte, error) {
+	response, err := c.do(reference, url, accept)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusUnauthorized {
+		if err := c.authenticate(reference, response.Header.Get("WWW-Authenticate")); err != nil {
+			return nil, err
+		}
+
+		response.Body.Close()
+		if response, err = c.do(reference, url, accept); err != nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry returned %s", response.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(response.Body, maxBlobSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxBlobSize {
+		return nil, fmt.Errorf("response exceeds maximum size of %d bytes", maxBlobSize)
+	}
+
+	return data, nil
+}
+
+func (c *client) do(reference Reference, url string, accept string) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+
+	if token, ok := c.tokens[reference.host()]; ok {
+		request.Header.Set("Authorization", token)
+	}
+
+	return c.httpClient.Do(request)
+}
+
+// digestPattern matches a sha256 digest, the only algorithm that is supported
+var digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// ComputeDigest returns the sha256 digest of the content
+func ComputeDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// ValidateDigest checks that the digest is a lower case sha256 digest, so that it is safe to use in URLs and file names
+func ValidateDigest(digest string) error {
+	if !digestPattern.MatchString(digest) {
+		return fmt.Errorf("Invalid digest %s, must be sha256: followed by 64 lower case hex characters", digest)
+	}
+
+	return nil
+}
+
+// VerifyDigest checks that the content has the digest
+func VerifyDigest(data []byte, digest string) error {
+	if err := ValidateDigest(digest); err != nil {
+		return err
+	}
+
+	if actual := ComputeDigest(data); actual != digest {
+		return fmt.Errorf("expected digest %s but content has digest %s", digest, actual)
+	}
+
+	return nil
+}
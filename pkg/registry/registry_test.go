@@ -0,0 +1,146 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const testBundle = `{"schemaVersion":"v1.0.0","name":"hello-world","version":"1.0.0","invocationImages":[{"image":"cnabquickstarts.azurecr.io/porter/hello-world/bundle-installer:1.0.0","imageType":"docker"}]}`
+
+// newTestRegistry starts an in-process registry serving a bundle pushed in the cnab-to-oci layout
+func newTestRegistry(t *testing.T, repository string, tag string, requireToken bool) *httptest.Server {
+	config := []byte(testBundle)
+	configManifest, _ := json.Marshal(manifest{
+		MediaType: mediaTypeOCIManifest,
+		Config: &descriptor{
+			MediaType: "application/vnd.cnab.config.v1+json",
+			Digest:    ComputeDigest(config),
+			Size:      int64(len(config)),
+		},
+	})
+	index, _ := json.Marshal(manifest{
+		MediaType: mediaTypeOCIIndex,
+		Manifests: []descriptor{
+			{
+				MediaType:   mediaTypeOCIManifest,
+				Digest:      ComputeDigest(configManifest),
+				Size:        int64(len(configManifest)),
+				Annotations: map[string]string{cnabManifestTypeAnnotation: cnabManifestTypeConfig},
+			},
+		},
+	})
+
+	content := map[string][]byte{
+		fmt.Sprintf("/v2/%s/manifests/%s", repository, tag):                           index,
+		fmt.Sprintf("/v2/%s/manifests/%s", repository, ComputeDigest(configManifest)): configManifest,
+		fmt.Sprintf("/v2/%s/blobs/%s", repository, ComputeDigest(config)):             config,
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			username, password, _ := r.BasicAuth()
+			if username != "user" || password != "pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			assert.Equal(t, r.URL.Query().Get("scope"), fmt.Sprintf("repository:%s:pull", repository))
+			fmt.Fprint(w, `{"token":"testtoken"}`)
+			return
+		}
+
+		if requireToken && r.Header.Get("Authorization") != "Bearer testtoken" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:%s:pull"`, server.URL, repository))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		data, ok := content[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Write(data)
+	}))
+
+	return server
+}
+
+func TestPullBundle(t *testing.T) {
+	server := newTestRegistry(t, "porter/hello-world/bundle", "1.0.0", false)
+	defer server.Close()
+
+	client := NewClient(ClientOptions{Insecure: true})
+
+	tag := strings.TrimPrefix(server.URL, "http://") + "/porter/hello-world/bundle:1.0.0"
+	b, err := client.PullBundle(tag)
+
+	assert.NilError(t, err)
+	assert.Equal(t, b.Name, "hello-world")
+	assert.Equal(t, b.Version, "1.0.0")
+}
+
+func TestPullBundleWithTokenAuthentication(t *testing.T) {
+	server := newTestRegistry(t, "porter/hello-world/bundle", "1.0.0", true)
+	defer server.Close()
+
+	credentials := func(registry string) (string, string, error) {
+		return "user", "pass", nil
+	}
+	client := NewClient(ClientOptions{Insecure: true, Credentials: credentials})
+
+	tag := strings.TrimPrefix(server.URL, "http://") + "/porter/hello-world/bundle:1.0.0"
+	b, err := client.PullBundle(tag)
+
+	assert.NilError(t, err)
+	assert.Equal(t, b.Name, "hello-world")
+}
+
+func TestPullBundleNotFound(t *testing.T) {
+	server := newTestRegistry(t, "porter/hello-world/bundle", "1.0.0", false)
+	defer server.Close()
+
+	client := NewClient(ClientOptions{Insecure: true})
+
+	tag := strings.TrimPrefix(server.URL, "http://") + "/porter/hello-world/bundle:2.0.0"
+	_, err := client.PullBundle(tag)
+
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		tag      string
+		expected Reference
+	}{
+		{"cnabquickstarts.azurecr.io/porter/foo/bundle:0.1.0", Reference{Registry: "cnabquickstarts.azurecr.io", Repository: "porter/foo/bundle", Tag: "0.1.0"}},
+		{"localhost:5000/foo/bundle", Reference{Registry: "localhost:5000", Repository: "foo/bundle", Tag: "latest"}},
+		{"getporter/hello:v0.1.0", Reference{Registry: "docker.io", Repository: "getporter/hello", Tag: "v0.1.0"}},
+		{"hello", Reference{Registry: "docker.io", Repository: "library/hello", Tag: "latest"}},
+		{"myacr.azurecr.io/foo/bundle@sha256:abc", Reference{Registry: "myacr.azurecr.io", Repository: "foo/bundle", Digest: "sha256:abc"}},
+	}
+
+	for _, test := range tests {
+		reference, err := ParseReference(test.tag)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, reference, test.expected)
+	}
+}
+
+func TestVerifyDigest(t *testing.T) {
+	data := []byte(`{"name":"foo"}`)
+
+	assert.NilError(t, VerifyDigest(data, ComputeDigest(data)))
+	assert.ErrorContains(t, VerifyDigest([]byte("other"), ComputeDigest(data)), "expected digest "+ComputeDigest(data))
+
+	for _, digest := range []string{"", "sha512:abc", "sha256:abc", "sha256:../../" + strings.Repeat("a", 58), strings.ToUpper(ComputeDigest(data))} {
+		assert.ErrorContains(t, VerifyDigest(data, digest), "Invalid digest")
+	}
+}
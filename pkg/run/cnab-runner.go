@@ -0,0 +1,147 @@
+package run
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/cnabio/cnab-go/action"
+	"github.com/cnabio/cnab-go/bundle"
+	"github.com/cnabio/cnab-go/claim"
+	"github.com/cnabio/cnab-go/driver"
+	"github.com/cnabio/cnab-go/driver/command"
+	"github.com/cnabio/cnab-go/utils/crud"
+	"github.com/cnabio/cnab-go/valuesource"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/registry"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/storage"
+)
+
+// cnabRunner runs bundle actions in-process using the cnab-go action package, claims are stored in the state storage account
+type cnabRunner struct {
+	registry registry.Client
+	claims   claim.Provider
+	driver   driver.Driver
+}
+
+// newCnabRunner creates a cnabRunner that runs the invocation image using the cnab-azure driver, claims are kept in memory when there is no state storage
+func newCnabRunner(blobClient storage.BlobClient) *cnabRunner {
+	if blobClient == nil {
+		blobClient = storage.NewMemoryClient()
+	}
+
+	return &cnabRunner{
+		registry: registry.NewClient(registry.ClientOptions{}),
+		claims:   claim.NewClaimStore(crud.NewBackingStore(storage.NewCrudStore(blobClient, "porter")), nil, nil),
+		driver:   &command.Driver{Name: "azure"},
+	}
+}
+
+// Run pulls the bundle and runs the action, the claim and its result are saved before and after the action runs
+func (runner *cnabRunner) Run(a Action) error {
+	bun, err := runner.registry.PullBundle(a.BundleTag)
+	if err != nil {
+		return newError(ConfigError, "Unable to pull bundle %s: %s", a.BundleTag, err)
+	}
+
+	parameters, err := getParameters(bun, a.Name)
+	if err != nil {
+		return err
+	}
+
+	values, err := coerceParameters(bun, parameters)
+	if err != nil {
+		return err
+	}
+
+	creds, err := getCredentialValues()
+	if err != nil {
+		return err
+	}
+
+	c, err := runner.newClaim(a, *bun, values)
+	if err != nil {
+		return err
+	}
+
+	actionRunner := action.New(runner.driver, runner.claims)
+	actionRunner.SaveAllOutputs = true
+
+	if err := actionRunner.SaveInitialClaim(c, claim.StatusRunning); err != nil {
+		return withKind(StorageError, err)
+	}
+
+	log.Printf("Running %s on installation %s of %s\n", a.Name, a.InstallationName, a.BundleTag)
+	opResult, result, err := actionRunner.Run(c, creds, func(op *driver.Operation) error {
+		// The driver writes both stdout and stderr of the invocation image to the operation output
+		op.Out = a.stdout()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to run %s: %s", a.Name, err)
+	}
+
+	if err := actionRunner.SaveOperationResult(opResult, c, result); err != nil {
+		return fmt.Errorf("%s failed with %s", a.Name, err)
+	}
+
+	return nil
+}
+
+// Outputs gets the latest value of each output of the installation from the claims
+func (runner *cnabRunner) Outputs(installationName string) (map[string]string, error) {
+	claimOutputs, err := runner.claims.ReadLastOutputs(installationName)
+	if err != nil {
+		return nil, newError(StorageError, "Unable to read outputs: %s", err)
+	}
+
+	outputs := make(map[string]string, claimOutputs.Len())
+	for i := 0; i < claimOutputs.Len(); i++ {
+		output, _ := claimOutputs.GetByIndex(i)
+		outputs[output.Name] = string(output.Value)
+	}
+
+	return outputs, nil
+}
+
+// newClaim creates the claim for the action from the last claim for the installation, a new installation is only created by install or a custom action
+func (runner *cnabRunner) newClaim(a Action, bun bundle.Bundle, parameters map[string]interface{}) (claim.Claim, error) {
+	lastClaim, err := runner.claims.ReadLastClaim(a.InstallationName)
+	if err == claim.ErrInstallationNotFound {
+		if a.Name == claim.ActionUpgrade || a.Name == claim.ActionUninstall {
+			return claim.Claim{}, fmt.Errorf("Installation %s does not exist", a.InstallationName)
+		}
+
+		return claim.New(a.InstallationName, a.Name, bun, parameters)
+	}
+	if err != nil {
+		return claim.Claim{}, newError(StorageError, "Unable to read installation %s: %s", a.InstallationName, err)
+	}
+
+	return lastClaim.NewClaim(a.Name, bun, parameters)
+}
+
+// getCredentialValues gets the credential values set by environment variables, credentials set from files are decoded
+func getCredentialValues() (valuesource.Set, error) {
+	credentialVariables, err := getCredentialVariables()
+	if err != nil {
+		return nil, err
+	}
+
+	creds := valuesource.Set{}
+	for _, variable := range credentialVariables {
+		value := os.Getenv(variable.environmentVariable)
+
+		if variable.file {
+			data, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return nil, newError(CredentialError, "Unable to decode %s: %s", variable.name, err)
+			}
+			value = string(data)
+		}
+
+		creds[variable.name] = value
+	}
+
+	return creds, nil
+}
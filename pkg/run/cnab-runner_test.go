@@ -0,0 +1,163 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/cnabio/cnab-go/bundle"
+	"github.com/cnabio/cnab-go/bundle/definition"
+	"github.com/cnabio/cnab-go/claim"
+	"github.com/cnabio/cnab-go/driver"
+	"github.com/cnabio/cnab-go/utils/crud"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/storage"
+	"gotest.tools/v3/assert"
+)
+
+type testRegistry struct {
+	bundle bundle.Bundle
+	err    error
+}
+
+func (r *testRegistry) PullBundle(tag string) (*bundle.Bundle, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return &r.bundle, nil
+}
+
+func (r *testRegistry) PullBundleData(tag string) ([]byte, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return json.Marshal(r.bundle)
+}
+
+// testDriver records the operations it runs and produces a host output
+type testDriver struct {
+	operations []*driver.Operation
+	err        error
+}
+
+func (d *testDriver) Run(op *driver.Operation) (driver.OperationResult, error) {
+	d.operations = append(d.operations, op)
+	fmt.Fprintf(op.Out, "running %s\n", op.Action)
+
+	return driver.OperationResult{Outputs: map[string]string{"host": "example.com"}}, d.err
+}
+
+func (d *testDriver) Handles(imageType string) bool {
+	return true
+}
+
+func newTestCnabRunner(d driver.Driver) *cnabRunner {
+	return &cnabRunner{
+		registry: &testRegistry{
+			bundle: bundle.Bundle{
+				Name:             "mybundle",
+				Version:          "0.1.0",
+				InvocationImages: []bundle.InvocationImage{{BaseImage: bundle.BaseImage{Image: "myregistry.io/mybundle:0.1.0", ImageType: "docker"}}},
+				Definitions: definition.Definitions{
+					"string": &definition.Schema{Type: "string"},
+				},
+				Parameters: map[string]bundle.Parameter{
+					"db-name": {Definition: "string", Destination: &bundle.Location{EnvironmentVariable: "DB_NAME"}},
+				},
+				Credentials: map[string]bundle.Credential{
+					"kubeconfig": {Location: bundle.Location{Path: "/root/.kube/config"}, Required: true},
+				},
+				Outputs: map[string]bundle.Output{
+					"host": {Definition: "string", Path: "/cnab/app/outputs/host"},
+				},
+			},
+		},
+		claims: claim.NewClaimStore(crud.NewBackingStore(storage.NewCrudStore(storage.NewMemoryClient(), "porter")), nil, nil),
+		driver: d,
+	}
+}
+
+func TestCnabRunner(t *testing.T) {
+	os.Setenv("CNAB_NAME_MAP", `{"parameters":{"db_name":"db-name"}}`)
+	os.Setenv("CNAB_PARAM_db_name", "mydb")
+	os.Setenv("CNAB_CRED_FILE_kubeconfig", "Y29uZmln")
+	defer os.Unsetenv("CNAB_NAME_MAP")
+	defer os.Unsetenv("CNAB_PARAM_db_name")
+	defer os.Unsetenv("CNAB_CRED_FILE_kubeconfig")
+
+	d := &testDriver{}
+	runner := newTestCnabRunner(d)
+
+	err := runner.Run(Action{InstallationName: "mybundle1", Name: "upgrade", BundleTag: "myregistry.io/mybundle:0.1.0"})
+	assert.ErrorContains(t, err, "Installation mybundle1 does not exist")
+
+	err = runner.Run(Action{InstallationName: "mybundle1", Name: "install", BundleTag: "myregistry.io/mybundle:0.1.0"})
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(d.operations), 1)
+	assert.Equal(t, d.operations[0].Environment["DB_NAME"], "mydb")
+	assert.Equal(t, d.operations[0].Files["/root/.kube/config"], "config")
+
+	outputs, err := runner.Outputs("mybundle1")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, outputs, map[string]string{"host": "example.com"})
+
+	d.err = fmt.Errorf("exit status 1")
+	err = runner.Run(Action{InstallationName: "mybundle1", Name: "upgrade", BundleTag: "myregistry.io/mybundle:0.1.0"})
+	assert.ErrorContains(t, err, "upgrade failed with")
+
+	c, err := runner.claims.ReadLastClaim("mybundle1")
+	assert.NilError(t, err)
+	assert.Equal(t, c.Action, "upgrade")
+
+	result, err := runner.claims.ReadLastResult(c.ID)
+	assert.NilError(t, err)
+	assert.Equal(t, result.Status, claim.StatusFailed)
+}
+
+func TestCnabRunnerWithUnavailableBundle(t *testing.T) {
+	runner := newCnabRunner(nil)
+	runner.registry = &testRegistry{err: fmt.Errorf("unauthorized")}
+
+	err := runner.Run(Action{InstallationName: "mybundle1", Name: "install", BundleTag: "myregistry.io/mybundle:0.1.0"})
+	assert.ErrorContains(t, err, "Unable to pull bundle myregistry.io/mybundle:0.1.0: unauthorized")
+	assert.Equal(t, ExitCode(err), ExitCodeConfigError)
+}
+
+func TestNewRunner(t *testing.T) {
+	os.Setenv("CNAB_RUNNER", "docker")
+	defer os.Unsetenv("CNAB_RUNNER")
+
+	_, err := newRunner(nil)
+	assert.ErrorContains(t, err, "Unsupported CNAB_RUNNER docker, must be porter or cnab")
+
+	os.Setenv("CNAB_RUNNER", "cnab")
+	runner, err := newRunner(nil)
+	assert.NilError(t, err)
+	_, ok := runner.(*cnabRunner)
+	assert.Assert(t, ok)
+}
+
+func TestNewRunnerForStatelessAction(t *testing.T) {
+	os.Unsetenv("CNAB_RUNNER")
+
+	runner, err := newRunner(storage.NewMemoryClient())
+	assert.NilError(t, err)
+	_, ok := runner.(*porterRunner)
+	assert.Assert(t, ok)
+
+	runner, err = newRunner(nil)
+	assert.NilError(t, err)
+	_, ok = runner.(*cnabRunner)
+	assert.Assert(t, ok)
+
+	os.Setenv("CNAB_RUNNER", "porter")
+	defer os.Unsetenv("CNAB_RUNNER")
+
+	runner, err = newRunner(nil)
+	assert.NilError(t, err)
+	_, ok = runner.(*cnabRunner)
+	assert.Assert(t, ok)
+}
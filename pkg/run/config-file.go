@@ -0,0 +1,199 @@
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+	"gopkg.in/yaml.v2"
+)
+
+// configFile is the optional file named by CNAB_CONFIG_FILE that sets the driver configuration, it is usually mounted from an ACI secret volume so that large or multiline values do not have to be set as environment variables
+// Values that are not strings are converted to JSON, so that a file has the same meaning whether it is written in YAML or JSON
+type configFile struct {
+	// Environment sets the environment variables that configure the driver, e.g. CNAB_ACTION
+	Environment map[string]interface{} `json:"environment" yaml:"environment"`
+	// Parameters sets the bundle parameters by their names in the bundle
+	Parameters map[string]interface{} `json:"parameters" yaml:"parameters"`
+	// Credentials sets the bundle credentials by their names in the bundle, file credentials are set to the contents of the file
+	Credentials map[string]interface{} `json:"credentials" yaml:"credentials"`
+}
+
+// loadConfigFile reads the file named by CNAB_CONFIG_FILE, if it is set, and sets the environment variables for its values, environment variables that are already set override the values in the file
+func loadConfigFile() error {
+	names := common.GetEnvironmentVariableNames()
+
+	source := os.Getenv(names.CnabConfigFile)
+	if source == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return fmt.Errorf("Unable to read config file %s: %s", source, err)
+	}
+
+	var config configFile
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		// Numbers are kept as they are written rather than converted to floats
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&config)
+	} else {
+		err = yaml.Unmarshal(data, &config)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to parse config file %s: %s", source, err)
+	}
+
+	environment, err := toConfigValues(config.Environment)
+	if err != nil {
+		return fmt.Errorf("Invalid environment in config file %s: %s", source, err)
+	}
+
+	parameters, err := toConfigValues(config.Parameters)
+	if err != nil {
+		return fmt.Errorf("Invalid parameters in config file %s: %s", source, err)
+	}
+
+	credentials, err := toConfigValues(config.Credentials)
+	if err != nil {
+		return fmt.Errorf("Invalid credentials in config file %s: %s", source, err)
+	}
+
+	validNames := getConfigEnvironmentVariableNames()
+	for _, name := range sortedKeys(environment) {
+		if !validNames[name] {
+			return fmt.Errorf("Config file %s sets unknown environment variable %s, parameters and credentials must be set in the parameters and credentials sections", source, name)
+		}
+
+		setIfEmpty(name, environment[name])
+	}
+
+	// The name map is read after the environment so that it can also be set by the config file
+	nameMap, err := common.GetNameMap()
+	if err != nil {
+		return err
+	}
+	if nameMap.Parameters == nil {
+		nameMap.Parameters = map[string]string{}
+	}
+	if nameMap.Credentials == nil {
+		nameMap.Credentials = map[string]string{}
+	}
+
+	for _, name := range sortedKeys(parameters) {
+		safeName := addToNameMap(nameMap.Parameters, name)
+		setIfEmpty(names.CnabParameterPrefix+safeName, parameters[name])
+	}
+
+	for _, name := range sortedKeys(credentials) {
+		safeName := addToNameMap(nameMap.Credentials, name)
+
+		// Credentials can be set by either variable, so the file value is only used when neither is set
+		if os.Getenv(names.CnabCredentialFilePrefix+safeName) != "" {
+			continue
+		}
+		setIfEmpty(names.CnabCredentialPrefix+safeName, credentials[name])
+	}
+
+	if nameMap.IsEmpty() {
+		return nil
+	}
+
+	data, err = json.Marshal(nameMap)
+	if err != nil {
+		return err
+	}
+
+	return os.Setenv(names.CnabNameMap, string(data))
+}
+
+// toConfigValues converts the values of a section of the config file to the strings that environment variables are set to, values that are not strings are converted to JSON
+func toConfigValues(values map[string]interface{}) (map[string]string, error) {
+	result := make(map[string]string, len(values))
+	for name, value := range values {
+		switch v := value.(type) {
+		case nil:
+			result[name] = ""
+		case string:
+			result[name] = v
+		default:
+			data, err := json.Marshal(toJSONValue(value))
+			if err != nil {
+				return nil, fmt.Errorf("Unable to convert the value of %s to a string: %s", name, err)
+			}
+			result[name] = string(data)
+		}
+	}
+
+	return result, nil
+}
+
+// toJSONValue converts the maps decoded from YAML, whose keys can be of any type, to maps that can be converted to JSON
+func toJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			object[fmt.Sprintf("%v", key)] = toJSONValue(item)
+		}
+		return object
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, item := range v {
+			array[i] = toJSONValue(item)
+		}
+		return array
+	default:
+		return value
+	}
+}
+
+// getConfigEnvironmentVariableNames gets the environment variables that can be set by the config file, which are all of the common environment variables apart from prefixes
+func getConfigEnvironmentVariableNames() map[string]bool {
+	names := map[string]bool{}
+
+	value := reflect.ValueOf(common.GetEnvironmentVariableNames())
+	for i := 0; i < value.NumField(); i++ {
+		if strings.HasSuffix(value.Type().Field(i).Name, "Prefix") || value.Type().Field(i).Name == "CnabConfigFile" {
+			continue
+		}
+		names[value.Field(i).String()] = true
+	}
+
+	return names
+}
+
+// addToNameMap adds a bundle name to the name map if it is not a safe name, returning the safe name
+func addToNameMap(nameMap map[string]string, name string) string {
+	safeName := common.ToSafeName(name)
+	if safeName != name {
+		nameMap[safeName] = name
+	}
+
+	return safeName
+}
+
+// setIfEmpty sets an environment variable if it is not set or is empty, the template sets parameters that do not apply to the action to an empty value
+func setIfEmpty(name string, value string) {
+	if os.Getenv(name) == "" {
+		os.Setenv(name, value)
+	}
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
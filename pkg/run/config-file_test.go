@@ -0,0 +1,113 @@
+package run
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnabarmdriver")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.yaml")
+	err = ioutil.WriteFile(configPath, []byte(`
+environment:
+  CNAB_ACTION: install
+  CNAB_INSTALLATION_NAME: mybundle1
+parameters:
+  db-name: mydb
+  port: 8080
+credentials:
+  kubeconfig: |
+    apiVersion: v1
+    kind: Config
+`), 0644)
+	assert.NilError(t, err)
+
+	os.Setenv("CNAB_CONFIG_FILE", configPath)
+	os.Setenv("CNAB_ACTION", "upgrade")
+	os.Setenv("CNAB_PARAM_port", "")
+	defer os.Unsetenv("CNAB_CONFIG_FILE")
+	defer os.Unsetenv("CNAB_ACTION")
+	defer os.Unsetenv("CNAB_INSTALLATION_NAME")
+	defer os.Unsetenv("CNAB_PARAM_db_name")
+	defer os.Unsetenv("CNAB_PARAM_port")
+	defer os.Unsetenv("CNAB_CRED_kubeconfig")
+	defer os.Unsetenv("CNAB_NAME_MAP")
+
+	err = loadConfigFile()
+	assert.NilError(t, err)
+
+	assert.Equal(t, os.Getenv("CNAB_ACTION"), "upgrade")
+	assert.Equal(t, os.Getenv("CNAB_INSTALLATION_NAME"), "mybundle1")
+	assert.Equal(t, os.Getenv("CNAB_PARAM_port"), "8080")
+	assert.Equal(t, os.Getenv("CNAB_CRED_kubeconfig"), "apiVersion: v1\nkind: Config\n")
+
+	parameters, err := getParameters(nil, "install")
+	assert.NilError(t, err)
+	values := map[string]string{}
+	for _, parameter := range parameters {
+		values[parameter.Name] = parameter.Source.Value
+	}
+	assert.Equal(t, values["db-name"], "mydb")
+}
+
+func TestLoadJSONConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnabarmdriver")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	names := []string{"CNAB_CONFIG_FILE", "VERBOSE", "CNAB_PARAM_port", "CNAB_PARAM_ratio", "CNAB_PARAM_tags", "CNAB_PARAM_zones"}
+	unset := func() {
+		for _, name := range names {
+			os.Unsetenv(name)
+		}
+	}
+	defer unset()
+
+	for _, test := range []struct {
+		name   string
+		config string
+	}{
+		{"config.json", `{"environment": {"VERBOSE": true}, "parameters": {"port": 8080, "ratio": 0.5, "tags": {"env": "test"}, "zones": [1, 2]}}`},
+		{"config.yaml", "environment:\n  VERBOSE: true\nparameters:\n  port: 8080\n  ratio: 0.5\n  tags:\n    env: test\n  zones: [1, 2]\n"},
+	} {
+		configPath := filepath.Join(dir, test.name)
+		err = ioutil.WriteFile(configPath, []byte(test.config), 0644)
+		assert.NilError(t, err)
+
+		os.Setenv("CNAB_CONFIG_FILE", configPath)
+
+		err = loadConfigFile()
+		assert.NilError(t, err, test.name)
+
+		assert.Equal(t, os.Getenv("VERBOSE"), "true", test.name)
+		assert.Equal(t, os.Getenv("CNAB_PARAM_port"), "8080", test.name)
+		assert.Equal(t, os.Getenv("CNAB_PARAM_ratio"), "0.5", test.name)
+		assert.Equal(t, os.Getenv("CNAB_PARAM_tags"), `{"env":"test"}`, test.name)
+		assert.Equal(t, os.Getenv("CNAB_PARAM_zones"), "[1,2]", test.name)
+
+		unset()
+	}
+}
+
+func TestLoadConfigFileWithUnknownEnvironmentVariable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cnabarmdriver")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(configPath, []byte(`{"environment":{"CNAB_PARAM_foo":"1"}}`), 0644)
+	assert.NilError(t, err)
+
+	os.Setenv("CNAB_CONFIG_FILE", configPath)
+	defer os.Unsetenv("CNAB_CONFIG_FILE")
+
+	err = loadConfigFile()
+	assert.ErrorContains(t, err, "sets unknown environment variable CNAB_PARAM_foo")
+}
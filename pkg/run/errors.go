@@ -0,0 +1,91 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorKind identifies what failed when running a bundle action, each kind has its own process exit code so the deployment can tell what failed from the state of the container
+type ErrorKind int
+
+const (
+	// ConfigError is returned when the environment variables that configure the driver are missing or invalid
+	ConfigError ErrorKind = iota + 1
+	// CredentialError is returned when the parameters or credentials cannot be read, decoded or fetched from Key Vault
+	CredentialError
+	// StorageError is returned when the state storage account cannot be used
+	StorageError
+	// ActionError is returned when the bundle action fails
+	ActionError
+)
+
+// Exit codes returned by the driver for each kind of error, 1 is used for any other error
+const (
+	ExitCodeConfigError     = 2
+	ExitCodeCredentialError = 3
+	ExitCodeStorageError    = 4
+	ExitCodeActionError     = 5
+)
+
+// Error is an error returned by Run
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the process exit code for the kind of error
+func (e *Error) ExitCode() int {
+	switch e.Kind {
+	case ConfigError:
+		return ExitCodeConfigError
+	case CredentialError:
+		return ExitCodeCredentialError
+	case StorageError:
+		return ExitCodeStorageError
+	case ActionError:
+		return ExitCodeActionError
+	default:
+		return 1
+	}
+}
+
+// ExitCode returns the process exit code for an error returned by Run, 0 if there is no error and 1 if the error is not an Error
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var runErr *Error
+	if errors.As(err, &runErr) {
+		return runErr.ExitCode()
+	}
+
+	return 1
+}
+
+// newError creates an Error of the kind with a formatted message
+func newError(kind ErrorKind, format string, a ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, a...)}
+}
+
+// withKind sets the kind of an error that does not already have one
+func withKind(kind ErrorKind, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var runErr *Error
+	if errors.As(err, &runErr) {
+		return err
+	}
+
+	return &Error{Kind: kind, Err: err}
+}
@@ -0,0 +1,42 @@
+package run
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, ExitCode(nil), 0)
+	assert.Equal(t, ExitCode(fmt.Errorf("unknown")), 1)
+	assert.Equal(t, ExitCode(newError(ActionError, "porter command failed with %s", "exit status 1")), ExitCodeActionError)
+	assert.Equal(t, ExitCode(withKind(StorageError, newError(CredentialError, "Unable to decode %s", "kubeconfig"))), ExitCodeCredentialError)
+}
+
+func TestRunWithMissingConfig(t *testing.T) {
+	os.Setenv("CNAB_ACTION_STATELESS", "true")
+	defer os.Unsetenv("CNAB_ACTION_STATELESS")
+
+	err := Run()
+	assert.ErrorContains(t, err, "The following environment variables must be set but are missing: CNAB_BUNDLE_TAG, CNAB_ACTION, CNAB_INSTALLATION_NAME")
+	assert.Equal(t, ExitCode(err), ExitCodeConfigError)
+}
+
+func TestRunWithMissingConfigAndStorage(t *testing.T) {
+	os.Unsetenv("AZURE_STORAGE_CONNECTION_STRING")
+
+	err := Run()
+	assert.ErrorContains(t, err, "The following environment variables must be set but are missing")
+	assert.Equal(t, ExitCode(err), ExitCodeConfigError)
+}
+
+func TestGenerateCredsFileWithInvalidFile(t *testing.T) {
+	os.Setenv("CNAB_CRED_FILE_kubeconfig", "not base64")
+	defer os.Unsetenv("CNAB_CRED_FILE_kubeconfig")
+
+	_, err := generateCredsFile("mybundle1")
+	assert.ErrorContains(t, err, "Unable to decode kubeconfig")
+	assert.Equal(t, ExitCode(err), ExitCodeCredentialError)
+}
@@ -0,0 +1,73 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/logs"
+)
+
+// newLogger creates the logger for the output of the action from CNAB_LOG_FORMAT and the log sink environment variables, nil is returned when the output is written as it is and is not forwarded
+func newLogger(action Action) (*logs.Logger, error) {
+	names := common.GetEnvironmentVariableNames()
+
+	format := os.Getenv(names.CnabLogFormat)
+	if !logs.IsValidFormat(format) {
+		return nil, fmt.Errorf("Unsupported %s %s, must be %s or %s", names.CnabLogFormat, format, logs.FormatText, logs.FormatJSON)
+	}
+
+	sink, err := newLogSink()
+	if err != nil {
+		return nil, err
+	}
+
+	if format != logs.FormatJSON && sink == nil {
+		return nil, nil
+	}
+
+	return &logs.Logger{
+		Action:       action.Name,
+		Installation: action.InstallationName,
+		Format:       format,
+		Sink:         sink,
+	}, nil
+}
+
+// newLogSink creates the sink that log records are forwarded to, either an HTTP endpoint set by CNAB_LOG_SINK_URL or a Log Analytics workspace
+func newLogSink() (logs.Sink, error) {
+	names := common.GetEnvironmentVariableNames()
+
+	url := os.Getenv(names.CnabLogSinkURL)
+	workspaceID := os.Getenv(names.CnabLogAnalyticsWorkspaceID)
+
+	switch {
+	case url != "" && workspaceID != "":
+		return nil, fmt.Errorf("Only one of %s and %s can be set", names.CnabLogSinkURL, names.CnabLogAnalyticsWorkspaceID)
+	case url != "":
+		return logs.NewHTTPSink(url), nil
+	case workspaceID != "":
+		key := os.Getenv(names.CnabLogAnalyticsKey)
+		if key == "" {
+			return nil, fmt.Errorf("%s must be set to forward logs to Log Analytics", names.CnabLogAnalyticsKey)
+		}
+		return logs.NewLogAnalyticsSink(workspaceID, key)
+	default:
+		return nil, nil
+	}
+}
+
+// closeLogger writes any remaining output and sends the remaining records to the sink, errors are logged as the logs are not needed for the action to succeed
+func closeLogger(logger *logs.Logger, writers ...io.Closer) {
+	for _, writer := range writers {
+		if err := writer.Close(); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if err := logger.Close(); err != nil {
+		log.Println(err)
+	}
+}
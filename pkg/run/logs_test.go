@@ -0,0 +1,70 @@
+package run
+
+import (
+	"encoding/base64"
+	"os"
+	"testing"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/logs"
+	"gotest.tools/v3/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+	action := Action{InstallationName: "mybundle1", Name: "install"}
+
+	logger, err := newLogger(action)
+	assert.NilError(t, err)
+	assert.Assert(t, logger == nil)
+
+	os.Setenv("CNAB_LOG_FORMAT", "json")
+	defer os.Unsetenv("CNAB_LOG_FORMAT")
+
+	logger, err = newLogger(action)
+	assert.NilError(t, err)
+	assert.Equal(t, logger.Format, logs.FormatJSON)
+	assert.Equal(t, logger.Action, "install")
+	assert.Equal(t, logger.Installation, "mybundle1")
+	assert.Assert(t, logger.Sink == nil)
+
+	os.Setenv("CNAB_LOG_FORMAT", "text")
+	os.Setenv("CNAB_LOG_SINK_URL", "https://logs.example.com")
+	defer os.Unsetenv("CNAB_LOG_SINK_URL")
+
+	logger, err = newLogger(action)
+	assert.NilError(t, err)
+	assert.Equal(t, logger.Sink.(*logs.HTTPSink).URL, "https://logs.example.com")
+
+	os.Unsetenv("CNAB_LOG_SINK_URL")
+	os.Setenv("CNAB_LOG_ANALYTICS_WORKSPACE_ID", "workspace")
+	os.Setenv("CNAB_LOG_ANALYTICS_KEY", base64.StdEncoding.EncodeToString([]byte("key")))
+	defer os.Unsetenv("CNAB_LOG_ANALYTICS_WORKSPACE_ID")
+	defer os.Unsetenv("CNAB_LOG_ANALYTICS_KEY")
+
+	logger, err = newLogger(action)
+	assert.NilError(t, err)
+	assert.Equal(t, logger.Sink.(*logs.LogAnalyticsSink).WorkspaceID, "workspace")
+}
+
+func TestNewLoggerErrors(t *testing.T) {
+	tests := []struct {
+		environment map[string]string
+		expected    string
+	}{
+		{map[string]string{"CNAB_LOG_FORMAT": "xml"}, "Unsupported CNAB_LOG_FORMAT xml, must be text or json"},
+		{map[string]string{"CNAB_LOG_SINK_URL": "https://logs.example.com", "CNAB_LOG_ANALYTICS_WORKSPACE_ID": "workspace"}, "Only one of CNAB_LOG_SINK_URL and CNAB_LOG_ANALYTICS_WORKSPACE_ID can be set"},
+		{map[string]string{"CNAB_LOG_ANALYTICS_WORKSPACE_ID": "workspace"}, "CNAB_LOG_ANALYTICS_KEY must be set to forward logs to Log Analytics"},
+	}
+
+	for _, test := range tests {
+		for name, value := range test.environment {
+			os.Setenv(name, value)
+		}
+
+		_, err := newLogger(Action{})
+		assert.ErrorContains(t, err, test.expected)
+
+		for name := range test.environment {
+			os.Unsetenv(name)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/storage"
+)
+
+const (
+	outputsStatusSucceeded = "succeeded"
+	outputsStatusFailed    = "failed"
+)
+
+// bundleOutputs is the document uploaded to the state storage account for the deployment script in the template to read the bundle outputs from
+type bundleOutputs struct {
+	Status  string            `json:"status"`
+	Error   string            `json:"error,omitempty"`
+	Outputs map[string]string `json:"outputs"`
+}
+
+// uploadOutputs uploads the bundle outputs, or the error if the action failed, when the template retrieves the bundle outputs
+func uploadOutputs(blobClient storage.BlobClient, runner Runner, cnabInstallationName string, actionErr error) error {
+	blobName, ok := os.LookupEnv(common.GetEnvironmentVariableNames().CnabOutputsBlob)
+	if !ok || blobName == "" {
+		return nil
+	}
+
+	outputs := bundleOutputs{
+		Status:  outputsStatusSucceeded,
+		Outputs: map[string]string{},
+	}
+
+	if actionErr == nil {
+		var err error
+		outputs.Outputs, err = runner.Outputs(cnabInstallationName)
+		if err != nil {
+			actionErr = err
+		}
+	}
+
+	if actionErr != nil {
+		outputs.Status = outputsStatusFailed
+		outputs.Error = actionErr.Error()
+	}
+
+	data, err := json.Marshal(outputs)
+	if err != nil {
+		return fmt.Errorf("Unable to create outputs: %s", err)
+	}
+
+	log.Printf("Uploading outputs to %s\n", blobName)
+	if err := blobClient.UploadBlob("porter", blobName, data); err != nil {
+		return newError(StorageError, "Unable to upload outputs: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package run
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/storage"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestUploadOutputsForFailedAction(t *testing.T) {
+	os.Setenv("CNAB_OUTPUTS_BLOB", "outputs/mybundle1/id.json")
+	defer os.Unsetenv("CNAB_OUTPUTS_BLOB")
+
+	blobClient := storage.NewMemoryClient()
+	uploadOutputs(blobClient, &porterRunner{}, "mybundle1", fmt.Errorf("porter command failed with exit status 1"))
+
+	data, err := blobClient.DownloadBlob("porter", "outputs/mybundle1/id.json")
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), `{"status":"failed","error":"porter command failed with exit status 1","outputs":{}}`)
+}
@@ -0,0 +1,161 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cnabio/cnab-go/bundle"
+	"github.com/cnabio/cnab-go/valuesource"
+)
+
+// coerceParameters converts the parameter values set by environment variables to the types of their bundle definitions and validates them, parameters without a definition or with several types are left as strings
+func coerceParameters(bun *bundle.Bundle, parameters []valuesource.Strategy) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(parameters))
+
+	for _, parameter := range parameters {
+		value, err := coerceParameterValue(bun, parameter.Name, parameter.Source.Value)
+		if err != nil {
+			return nil, newError(ConfigError, "%s", err)
+		}
+
+		values[parameter.Name] = value
+	}
+
+	return values, nil
+}
+
+// isUnsetParameter checks if an empty parameter value means that the parameter is not set, which is the case for parameters that do not apply to the action and parameters whose type cannot be empty, the template sets these to empty values
+func isUnsetParameter(bun *bundle.Bundle, name string, action string) bool {
+	if bun == nil {
+		return false
+	}
+
+	parameter, ok := bun.Parameters[name]
+	if !ok {
+		return false
+	}
+
+	if !parameter.AppliesTo(action) {
+		return true
+	}
+
+	definition, ok := bun.Definitions[parameter.Definition]
+	if !ok || definition == nil {
+		return false
+	}
+
+	dataType, ok, _ := definition.GetType()
+	return ok && dataType != "string"
+}
+
+// isMissingRequiredParameter checks if an empty parameter value leaves a required parameter without a value, the template makes parameters that only apply to some actions optional so they can be left empty for the other actions
+func isMissingRequiredParameter(bun *bundle.Bundle, name string, action string) bool {
+	if bun == nil {
+		return false
+	}
+
+	parameter, ok := bun.Parameters[name]
+	if !ok || !parameter.Required || !parameter.AppliesTo(action) {
+		return false
+	}
+
+	definition, ok := bun.Definitions[parameter.Definition]
+	return !ok || definition == nil || definition.Default == nil
+}
+
+// coerceParameterValue converts a parameter value to the type of its definition, ARM sets bool parameters to True or False and object and array parameters to JSON
+func coerceParameterValue(bun *bundle.Bundle, name string, value string) (interface{}, error) {
+	if bun == nil {
+		return value, nil
+	}
+
+	parameter, ok := bun.Parameters[name]
+	if !ok {
+		return nil, fmt.Errorf("Parameter %s is not defined by the bundle", name)
+	}
+
+	definition, ok := bun.Definitions[parameter.Definition]
+	if !ok || definition == nil {
+		return value, nil
+	}
+
+	dataType, ok, _ := definition.GetType()
+	if !ok {
+		return value, nil
+	}
+
+	var typedValue interface{}
+	switch dataType {
+	case "boolean":
+		switch strings.ToLower(value) {
+		case "true":
+			typedValue = true
+		case "false":
+			typedValue = false
+		default:
+			return nil, fmt.Errorf("Parameter %s must be a boolean, true or false", name)
+		}
+	case "integer":
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Parameter %s must be an integer", name)
+		}
+		typedValue = i
+	case "number":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Parameter %s must be a number", name)
+		}
+		typedValue = f
+	case "object":
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(value), &object); err != nil {
+			return nil, fmt.Errorf("Parameter %s must be a JSON object: %s", name, err)
+		}
+		typedValue = object
+	case "array":
+		var array []interface{}
+		if err := json.Unmarshal([]byte(value), &array); err != nil {
+			return nil, fmt.Errorf("Parameter %s must be a JSON array: %s", name, err)
+		}
+		typedValue = array
+	default:
+		typedValue = value
+	}
+
+	validationErrors, err := definition.Validate(typedValue)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to validate parameter %s: %s", name, err)
+	}
+	if len(validationErrors) > 0 {
+		messages := make([]string, 0, len(validationErrors))
+		for _, validationError := range validationErrors {
+			messages = append(messages, validationError.Error)
+		}
+		return nil, fmt.Errorf("Parameter %s is invalid: %s", name, strings.Join(messages, ", "))
+	}
+
+	return typedValue, nil
+}
+
+// formatParameterValue converts a typed parameter value to the string Porter expects in a parameter set
+func formatParameterValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
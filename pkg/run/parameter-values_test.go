@@ -0,0 +1,108 @@
+package run
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cnabio/cnab-go/bundle"
+	"github.com/cnabio/cnab-go/valuesource"
+	"gotest.tools/v3/assert"
+)
+
+func TestCoerceParameters(t *testing.T) {
+	bun, err := bundle.Unmarshal([]byte(`{
+		"name": "typed",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/typed:0.1.0"}],
+		"definitions": {
+			"bool": {"type": "boolean"},
+			"int": {"type": "integer", "maximum": 10},
+			"object": {"type": "object"},
+			"array": {"type": "array"},
+			"string": {"type": "string", "enum": ["a", "b"]}
+		},
+		"parameters": {
+			"debug": {"definition": "bool"},
+			"count": {"definition": "int"},
+			"tags": {"definition": "object"},
+			"zones": {"definition": "array"},
+			"tier": {"definition": "string"}
+		}
+	}`))
+	assert.NilError(t, err)
+
+	parameter := func(name string, value string) valuesource.Strategy {
+		return valuesource.Strategy{Name: name, Source: valuesource.Source{Key: "value", Value: value}}
+	}
+
+	values, err := coerceParameters(bun, []valuesource.Strategy{
+		parameter("debug", "True"),
+		parameter("count", "3"),
+		parameter("tags", `{"env":"test"}`),
+		parameter("zones", `["1","2"]`),
+		parameter("tier", "a"),
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, map[string]interface{}{
+		"debug": true,
+		"count": int64(3),
+		"tags":  map[string]interface{}{"env": "test"},
+		"zones": []interface{}{"1", "2"},
+		"tier":  "a",
+	})
+
+	tests := []struct {
+		parameter valuesource.Strategy
+		err       string
+	}{
+		{parameter("debug", "yes"), "Parameter debug must be a boolean, true or false"},
+		{parameter("count", "three"), "Parameter count must be an integer"},
+		{parameter("count", "11"), "Parameter count is invalid"},
+		{parameter("tags", `["env"]`), "Parameter tags must be a JSON object"},
+		{parameter("tier", "c"), "Parameter tier is invalid"},
+		{parameter("region", "uk"), "Parameter region is not defined by the bundle"},
+	}
+
+	for _, test := range tests {
+		_, err := coerceParameters(bun, []valuesource.Strategy{test.parameter})
+		assert.ErrorContains(t, err, test.err)
+		assert.Equal(t, ExitCode(err), ExitCodeConfigError)
+	}
+}
+
+func TestGenerateParamsFileWithTypedValues(t *testing.T) {
+	bun, err := bundle.Unmarshal([]byte(`{
+		"name": "typed",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/typed:0.1.0"}],
+		"definitions": {"bool": {"type": "boolean"}, "object": {"type": "object"}},
+		"parameters": {"debug": {"definition": "bool"}, "tags": {"definition": "object"}}
+	}`))
+	assert.NilError(t, err)
+
+	os.Setenv("CNAB_PARAM_debug", "False")
+	os.Setenv("CNAB_PARAM_tags", `{ "env": "test" }`)
+	defer os.Unsetenv("CNAB_PARAM_debug")
+	defer os.Unsetenv("CNAB_PARAM_tags")
+
+	// Parameters set by other tests are not defined by this bundle
+	for _, env := range getCnabParams() {
+		name := strings.SplitN(env, "=", 2)[0]
+		if name != "CNAB_PARAM_debug" && name != "CNAB_PARAM_tags" {
+			value := os.Getenv(name)
+			os.Unsetenv(name)
+			defer os.Setenv(name, value)
+		}
+	}
+
+	path, err := generateParamsFile("mybundle1", "install", bun)
+	assert.NilError(t, err)
+
+	content, _ := ioutil.ReadFile(path)
+	assert.Assert(t, strings.Contains(string(content), `{"name":"debug","source":{"value":"false"}}`))
+	assert.Assert(t, strings.Contains(string(content), `{"name":"tags","source":{"value":"{\"env\":\"test\"}"}}`))
+}
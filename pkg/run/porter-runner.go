@@ -0,0 +1,82 @@
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/registry"
+)
+
+// porterRunner runs bundle actions by executing the porter CLI with the Azure driver, Porter stores the installation state using its Azure plugin
+type porterRunner struct {
+	// registry is used to pull the bundle to read its parameter definitions
+	registry registry.Client
+}
+
+// porterOutput is an output listed by porter installation outputs list
+type porterOutput struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Run runs the action using porter
+func (runner *porterRunner) Run(action Action) error {
+	// The bundle is pulled to convert and validate the parameter values before Porter runs, Porter pulls the bundle using the same registry credentials so it could not run the action either
+	bun, err := runner.registry.PullBundle(action.BundleTag)
+	if err != nil {
+		return newError(ConfigError, "Unable to pull bundle %s to validate the parameter values: %s", action.BundleTag, err)
+	}
+
+	cmdParams, err := buildPorterCommandParams(action.InstallationName, action.Name, action.BundleTag, bun)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("porter", cmdParams...)
+	log.Println(cmd.String())
+	cmd.Stdout = action.stdout()
+	cmd.Stderr = action.stderr()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("porter command failed with %s", err)
+	}
+
+	return nil
+}
+
+// Outputs gets the outputs of the installation using porter
+func (runner *porterRunner) Outputs(installationName string) (map[string]string, error) {
+	var stdout bytes.Buffer
+	cmd := exec.Command("porter", "installation", "outputs", "list", "-i", installationName, "-o", "json")
+	log.Println(cmd.String())
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("Unable to list outputs: %s", err)
+	}
+
+	return parsePorterOutputs(stdout.Bytes())
+}
+
+func parsePorterOutputs(data []byte) (map[string]string, error) {
+	outputs := map[string]string{}
+
+	// porter prints nothing when the installation has no outputs
+	if len(bytes.TrimSpace(data)) == 0 {
+		return outputs, nil
+	}
+
+	var porterOutputs []porterOutput
+	if err := json.Unmarshal(data, &porterOutputs); err != nil {
+		return nil, fmt.Errorf("Unable to parse outputs: %s", err)
+	}
+
+	for _, output := range porterOutputs {
+		outputs[output.Name] = output.Value
+	}
+
+	return outputs, nil
+}
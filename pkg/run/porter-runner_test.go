@@ -0,0 +1,28 @@
+package run
+
+import (
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParsePorterOutputs(t *testing.T) {
+	outputs, err := parsePorterOutputs([]byte(`[{"name":"host","definition":{"type":"string"},"value":"example.com","type":"string"},{"name":"port","value":"8080","type":"integer"}]`))
+
+	assert.NilError(t, err)
+	assert.DeepEqual(t, outputs, map[string]string{"host": "example.com", "port": "8080"})
+
+	outputs, err = parsePorterOutputs([]byte("\n"))
+
+	assert.NilError(t, err)
+	assert.Equal(t, len(outputs), 0)
+}
+
+func TestPorterRunnerWithUnavailableBundle(t *testing.T) {
+	runner := &porterRunner{registry: &testRegistry{err: errors.New("unauthorized")}}
+
+	err := runner.Run(Action{InstallationName: "mybundle1", Name: "install", BundleTag: "myregistry.io/mybundle:0.1.0"})
+	assert.ErrorContains(t, err, "Unable to pull bundle myregistry.io/mybundle:0.1.0 to validate the parameter values: unauthorized")
+	assert.Equal(t, ExitCode(err), ExitCodeConfigError)
+}
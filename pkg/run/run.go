@@ -7,15 +7,17 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path"
+	"strconv"
 	"strings"
-	"time"
 
+	"github.com/cnabio/cnab-go/bundle"
 	"github.com/cnabio/cnab-go/credentials"
-	"github.com/cnabio/cnab-go/schema"
 	"github.com/cnabio/cnab-go/valuesource"
 	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/keyvault"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/logs"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/storage"
 )
 
 type config struct {
@@ -24,72 +26,161 @@ type config struct {
 	cnabInstallationName string
 }
 
-type parameterSet struct {
-	SchemaVersion schema.Version         `json:"schemaVersion" yaml:"schemaVersion"`
-	Name          string                 `json:"name" yaml:"name"`
-	Created       time.Time              `json:"created" yaml:"created"`
-	Modified      time.Time              `json:"modified" yaml:"modified"`
-	Parameters    []valuesource.Strategy `json:"parameters" yaml:"parameters"`
-}
-
-//Run runs Porter with the Azure driver, using environment variables
+//Run runs the bundle action with the Azure driver, using environment variables, the returned error is an *Error that identifies what failed
 func Run() error {
 
-	// Hack to get around issue with Porter not liking an empty blob container without a schema file in
-	uploadSchema()
+	if err := loadConfigFile(); err != nil {
+		return withKind(ConfigError, err)
+	}
 
+	// The config is checked first so that missing config is reported as a config error rather than as the storage error it causes
 	config, err := getConfig()
 	if err != nil {
-		log.Fatalf("%s\n", err)
+		return withKind(ConfigError, err)
+	}
+
+	stateless := isStatelessAction()
+
+	var blobClient storage.BlobClient
+	if !stateless {
+		blobClient, err = storage.NewClientFromConnectionString(os.Getenv(common.GetEnvironmentVariableNames().AzureStorageConnectionString))
+		if err != nil {
+			return newError(StorageError, "Unable to create storage client: %s", err)
+		}
+
+		// Hack to get around issue with Porter not liking an empty blob container without a schema file in
+		// Stateless actions do not have state storage
+		if err := uploadSchema(blobClient); err != nil {
+			return withKind(StorageError, err)
+		}
 	}
 
-	cnabBundleTag := config.cnabBundleTag
-	cnabAction := config.cnabAction
-	cnabInstallationName := config.cnabInstallationName
+	if err := configureAzureAuthentication(); err != nil {
+		return withKind(ConfigError, err)
+	}
 
-	cmdParams := buildPorterCommandParams(cnabInstallationName, cnabAction, cnabBundleTag)
+	// Parameters and credentials stored in Key Vault are fetched using the managed identity of the container
+	if vaultName := os.Getenv(common.GetEnvironmentVariableNames().CnabKeyVaultName); vaultName != "" {
+		client := keyvault.NewClient(vaultName, os.Getenv(common.GetEnvironmentVariableNames().CnabKeyVaultClientID))
+		if err := keyvault.SetEnvironmentVariables(client); err != nil {
+			return newError(CredentialError, "Failed to get secrets from Key Vault %s: %s", vaultName, err)
+		}
+	}
 
-	cmd := exec.Command("porter", cmdParams...)
-	log.Println(cmd.String())
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
+	runner, err := newRunner(blobClient)
 	if err != nil {
-		log.Fatalf("porter command failed with %s\n", err)
+		return withKind(ConfigError, err)
+	}
+
+	action := Action{
+		InstallationName: config.cnabInstallationName,
+		Name:             config.cnabAction,
+		BundleTag:        config.cnabBundleTag,
+	}
+
+	logger, err := newLogger(action)
+	if err != nil {
+		return withKind(ConfigError, err)
+	}
+	if logger != nil {
+		stdout := logger.Writer(logs.StreamStdout, os.Stdout)
+		stderr := logger.Writer(logs.StreamStderr, os.Stderr)
+		action.Stdout = stdout
+		action.Stderr = stderr
+		defer closeLogger(logger, stdout, stderr)
+	}
+
+	if err := runner.Run(action); err != nil {
+		err = withKind(ActionError, err)
+		if !stateless {
+			// The action error is returned even if its outputs cannot be uploaded
+			if uploadErr := uploadOutputs(blobClient, runner, action.InstallationName, err); uploadErr != nil {
+				log.Println(uploadErr)
+			}
+		}
+		return err
+	}
+
+	if !stateless {
+		if err := uploadOutputs(blobClient, runner, action.InstallationName, nil); err != nil {
+			return withKind(StorageError, err)
+		}
 	}
 
 	return nil
 }
 
-func uploadSchema() {
-	tempDir, _ := ioutil.TempDir("", "cnabarmdriver")
-	schemaFilePath := path.Join(tempDir, "schema")
+// configureAzureAuthentication checks the settings the driver uses to authenticate to Azure, when a managed identity is used the service principal settings are removed so the driver does not try to use them
+func configureAzureAuthentication() error {
+	names := common.GetEnvironmentVariableNames()
+
+	msiType := os.Getenv(names.CnabAzureMsiType)
+	switch msiType {
+	case "":
+		return nil
+	case "user":
+		if os.Getenv(names.CnabAzureUserMsiResourceID) == "" {
+			return fmt.Errorf("%s must be set when %s is user", names.CnabAzureUserMsiResourceID, names.CnabAzureMsiType)
+		}
+	default:
+		// A system assigned identity only exists once the container group has started, so its role assignment could not be in place before the driver runs
+		return fmt.Errorf("Unsupported %s %s, must be user", names.CnabAzureMsiType, msiType)
+	}
+
+	log.Println("Using user assigned managed identity to authenticate to Azure")
+
+	os.Unsetenv(names.CnabAzureClientID)
+	os.Unsetenv(names.CnabAzureClientSecret)
+
+	return nil
+}
+
+func uploadSchema(blobClient storage.BlobClient) error {
 	schemaFile := `{"claims":"cnab-claim-1.0.0-DRAFT+b5ed2f3","credentials":"cnab-credentialsets-1.0.0-DRAFT+b6c701f","parameters":"cnab-parametersets-1.0.0-DRAFT+TODO"}`
-	ioutil.WriteFile(schemaFilePath, []byte(schemaFile), 0644)
-	cmd := exec.Command("az", "storage", "blob", "upload", "--connection-string", os.Getenv("AZURE_STORAGE_CONNECTION_STRING"), "--container-name", "porter", "--name", "schema", "--file", schemaFilePath)
-	log.Println(cmd.String())
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
-	if err != nil {
-		log.Fatalf("porter command failed with %s\n", err)
+	log.Println("Uploading schema to porter container")
+	if err := blobClient.UploadBlob("porter", "schema", []byte(schemaFile)); err != nil {
+		return fmt.Errorf("Unable to upload schema: %s", err)
 	}
+	return nil
 }
 
-func buildPorterCommandParams(cnabInstallationName string, cnabAction string, cnabBundleTag string) []string {
+// buildPorterCommandParams builds the porter command line for the action, bun is used to convert the parameter values to the types Porter expects and is nil if the bundle could not be pulled
+func buildPorterCommandParams(cnabInstallationName string, cnabAction string, cnabBundleTag string, bun *bundle.Bundle) ([]string, error) {
 	credsPath, err := generateCredsFile(cnabInstallationName)
 	if err != nil {
-		log.Fatalf("generateCredsFile command failed with %s\n", err)
+		return nil, err
 	}
 
-	paramsPath, err := generateParamsFile(cnabInstallationName)
+	paramsPath, err := generateParamsFile(cnabInstallationName, cnabAction, bun)
 	if err != nil {
-		log.Fatalf("generateParamsFile command failed with %s\n", err)
+		return nil, err
 	}
 
-	cmdParams := []string{cnabAction, cnabInstallationName, "-d", "azure", "--tag", cnabBundleTag, "--cred", credsPath, "--parameter-set", paramsPath}
+	cmdParams := []string{cnabAction, cnabInstallationName}
+
+	// Custom actions are run using porter invoke
+	if !isDefaultAction(cnabAction) {
+		cmdParams = []string{"invoke", cnabInstallationName, "--action", cnabAction}
+	}
 
-	return cmdParams
+	cmdParams = append(cmdParams, "-d", "azure", "--tag", cnabBundleTag, "--cred", credsPath, "--parameter-set", paramsPath)
+
+	return cmdParams, nil
+}
+
+func isDefaultAction(cnabAction string) bool {
+	switch cnabAction {
+	case "install", "upgrade", "uninstall":
+		return true
+	default:
+		return false
+	}
+}
+
+// isStatelessAction checks if the template has set the action as stateless, in which case there is no state storage
+func isStatelessAction() bool {
+	stateless, err := strconv.ParseBool(os.Getenv(common.GetEnvironmentVariableNames().CnabActionStateless))
+	return err == nil && stateless
 }
 
 func getConfig() (config, error) {
@@ -122,48 +213,130 @@ func getConfig() (config, error) {
 	return config, err
 }
 
+// credentialVariable is an environment variable that sets a credential
+type credentialVariable struct {
+	name                string
+	environmentVariable string
+	// file is set when the environment variable is the base64 encoded contents of a file
+	file bool
+}
+
+// getCredentialVariables gets the environment variables that set credentials, mapping their safe names to credential names
+func getCredentialVariables() ([]credentialVariable, error) {
+	nameMap, err := common.GetNameMap()
+	if err != nil {
+		return nil, withKind(ConfigError, err)
+	}
+
+	var credentialVariables []credentialVariable
+	names := map[string]string{}
+
+	for _, cnabCred := range getCnabCreds() {
+		envVar := strings.Split(cnabCred, "=")[0]
+
+		var variable credentialVariable
+		if strings.HasPrefix(envVar, common.GetEnvironmentVariableNames().CnabCredentialFilePrefix) {
+			variable = credentialVariable{
+				name:                nameMap.CredentialName(strings.TrimPrefix(envVar, common.GetEnvironmentVariableNames().CnabCredentialFilePrefix)),
+				environmentVariable: envVar,
+				file:                true,
+			}
+		} else {
+			variable = credentialVariable{
+				name:                nameMap.CredentialName(strings.TrimPrefix(envVar, common.GetEnvironmentVariableNames().CnabCredentialPrefix)),
+				environmentVariable: envVar,
+			}
+		}
+
+		if existing, ok := names[variable.name]; ok {
+			return nil, newError(ConfigError, "Credential %s is set by both %s and %s", variable.name, existing, envVar)
+		}
+		names[variable.name] = envVar
+
+		credentialVariables = append(credentialVariables, variable)
+	}
+
+	return credentialVariables, nil
+}
+
+// getParameters gets the parameter values set by environment variables for the action, mapping their safe names to parameter names, bun is used to find values that are not set and is nil if it is not known
+func getParameters(bun *bundle.Bundle, action string) ([]valuesource.Strategy, error) {
+	nameMap, err := common.GetNameMap()
+	if err != nil {
+		return nil, withKind(ConfigError, err)
+	}
+
+	var parameters []valuesource.Strategy
+	names := map[string]string{}
+
+	for _, cnabParam := range getCnabParams() {
+		envVar := strings.Split(cnabParam, "=")[0]
+		key := nameMap.ParameterName(strings.TrimPrefix(envVar, common.GetEnvironmentVariableNames().CnabParameterPrefix))
+
+		if os.Getenv(envVar) == "" && isMissingRequiredParameter(bun, key, action) {
+			return nil, newError(ConfigError, "Parameter %s is required for the %s action but is not set", key, action)
+		}
+
+		// Parameters that are not set are empty, leaving them unset lets the runner apply defaults and check required parameters
+		if os.Getenv(envVar) == "" && isUnsetParameter(bun, key, action) {
+			continue
+		}
+
+		if existing, ok := names[key]; ok {
+			return nil, newError(ConfigError, "Parameter %s is set by both %s and %s", key, existing, envVar)
+		}
+		names[key] = envVar
+
+		parameters = append(parameters, valuesource.Strategy{
+			Name: key,
+			Source: valuesource.Source{
+				Key:   "value",
+				Value: os.Getenv(envVar),
+			},
+		})
+	}
+
+	return parameters, nil
+}
+
 func generateCredsFile(cnabInstallationName string) (string, error) {
 	tempDir, _ := ioutil.TempDir("", "cnabarmdriver")
 
-	cnabCreds := getCnabCreds()
+	credentialVariables, err := getCredentialVariables()
+	if err != nil {
+		return "", err
+	}
 
 	creds := credentials.CredentialSet{
 		Name: cnabInstallationName,
 	}
 
-	for _, cnabCred := range cnabCreds {
-		splits := strings.Split(cnabCred, "=")
-		envVar := splits[0]
-
-		var key string
+	for _, variable := range credentialVariables {
 		var cred valuesource.Strategy
-		if strings.HasPrefix(envVar, common.GetEnvironmentVariableNames().CnabCredentialFilePrefix) {
-			key = strings.TrimPrefix(envVar, common.GetEnvironmentVariableNames().CnabCredentialFilePrefix)
-
-			data, err := base64.StdEncoding.DecodeString(os.Getenv(envVar))
+		if variable.file {
+			data, err := base64.StdEncoding.DecodeString(os.Getenv(variable.environmentVariable))
 			if err != nil {
-				return "", fmt.Errorf("Unable to decode %s: %s", key, err)
+				return "", newError(CredentialError, "Unable to decode %s: %s", variable.name, err)
 			}
 
-			path := path.Join(tempDir, key)
+			path := path.Join(tempDir, strings.TrimPrefix(variable.environmentVariable, common.GetEnvironmentVariableNames().CnabCredentialFilePrefix))
 			if err := ioutil.WriteFile(path, data, 0644); err != nil {
 				return "", err
 			}
 
 			cred = valuesource.Strategy{
-				Name: key,
+				Name: variable.name,
 				Source: valuesource.Source{
 					Key:   "path",
 					Value: path,
 				},
 			}
 		} else {
-			key = strings.TrimPrefix(envVar, common.GetEnvironmentVariableNames().CnabCredentialPrefix)
 			cred = valuesource.Strategy{
-				Name: key,
+				Name: variable.name,
 				Source: valuesource.Source{
 					Key:   "env",
-					Value: envVar,
+					Value: variable.environmentVariable,
 				},
 			}
 		}
@@ -183,29 +356,33 @@ func generateCredsFile(cnabInstallationName string) (string, error) {
 	return credPath, nil
 }
 
-func generateParamsFile(cnabInstallationName string) (string, error) {
+func generateParamsFile(cnabInstallationName string, cnabAction string, bun *bundle.Bundle) (string, error) {
 	tempDir, _ := ioutil.TempDir("", "cnabarmdriver")
 
-	cnabParams := getCnabParams()
-
 	paramsFileName := cnabInstallationName + "-params.json"
 	paramsPath := path.Join(tempDir, paramsFileName)
 
-	params := parameterSet{
-		Name: cnabInstallationName,
+	parameters, err := getParameters(bun, cnabAction)
+	if err != nil {
+		return "", err
 	}
 
-	for _, cnabParam := range cnabParams {
-		splits := strings.Split(cnabParam, "=")
-		envVar := splits[0]
-		key := strings.TrimPrefix(envVar, common.GetEnvironmentVariableNames().CnabParameterPrefix)
-		params.Parameters = append(params.Parameters, valuesource.Strategy{
-			Name: key,
-			Source: valuesource.Source{
-				Key:   "value",
-				Value: os.Getenv(envVar),
-			},
-		})
+	values, err := coerceParameters(bun, parameters)
+	if err != nil {
+		return "", err
+	}
+
+	for i, parameter := range parameters {
+		value, err := formatParameterValue(values[parameter.Name])
+		if err != nil {
+			return "", fmt.Errorf("Unable to format parameter %s: %s", parameter.Name, err)
+		}
+		parameters[i].Source.Value = value
+	}
+
+	params := common.ParameterSet{
+		Name:       cnabInstallationName,
+		Parameters: parameters,
 	}
 	paramsData, _ := json.Marshal(params)
 
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/cnabio/cnab-go/bundle"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/storage"
 	"gotest.tools/v3/assert"
 )
 
@@ -16,7 +18,8 @@ func TestBuildPorterCommandParams(t *testing.T) {
 	cnabAction := "install"
 	cnabInstallationName := "mybundle1"
 
-	cmdParams := buildPorterCommandParams(cnabInstallationName, cnabAction, cnabBundleTag)
+	cmdParams, err := buildPorterCommandParams(cnabInstallationName, cnabAction, cnabBundleTag, nil)
+	assert.NilError(t, err)
 
 	expectedPattern :=
 		`install mybundle1 -d azure --tag myregistry.io\/mybundle:0\.1\.0 --cred \/tmp\/cnabarmdriver(.*)\/mybundle1-creds\.json --parameter-set \/tmp\/cnabarmdriver(.*)\/mybundle1-params\.json`
@@ -28,12 +31,32 @@ func TestBuildPorterCommandParams(t *testing.T) {
 	assert.Equal(t, match, true)
 }
 
+func TestBuildPorterCommandParamsForCustomAction(t *testing.T) {
+	cnabBundleTag := "myregistry.io/mybundle:0.1.0"
+	cnabAction := "status"
+	cnabInstallationName := "mybundle1"
+
+	cmdParams, err := buildPorterCommandParams(cnabInstallationName, cnabAction, cnabBundleTag, nil)
+	assert.NilError(t, err)
+
+	expectedPattern :=
+		`^invoke mybundle1 --action status -d azure --tag myregistry.io\/mybundle:0\.1\.0 --cred `
+
+	match, _ := regexp.MatchString(expectedPattern, strings.Join(cmdParams, " "))
+
+	assert.Equal(t, match, true)
+}
+
 func TestGenerateParamsFile(t *testing.T) {
 	os.Setenv("CNAB_PARAM_foo", "1")
 	os.Setenv("CNAB_PARAM_bar", "2")
+	os.Setenv("CNAB_PARAM_baz", "")
+	defer os.Unsetenv("CNAB_PARAM_foo")
+	defer os.Unsetenv("CNAB_PARAM_bar")
+	defer os.Unsetenv("CNAB_PARAM_baz")
 
 	cnabInstallationName := "mybundle1"
-	path, err := generateParamsFile(cnabInstallationName)
+	path, err := generateParamsFile(cnabInstallationName, "install", nil)
 
 	assert.NilError(t, err)
 
@@ -41,11 +64,79 @@ func TestGenerateParamsFile(t *testing.T) {
 	text := string(content)
 
 	expected :=
-		`{"schemaVersion":"","name":"mybundle1","created":"0001-01-01T00:00:00Z","modified":"0001-01-01T00:00:00Z","parameters":[{"name":"foo","source":{"value":"1"}},{"name":"bar","source":{"value":"2"}}]}`
+		`{"schemaVersion":"","name":"mybundle1","created":"0001-01-01T00:00:00Z","modified":"0001-01-01T00:00:00Z","parameters":[{"name":"foo","source":{"value":"1"}},{"name":"bar","source":{"value":"2"}},{"name":"baz","source":{"value":""}}]}`
 
 	assert.Equal(t, expected, text)
 }
 
+func TestGenerateParamsFileWithEmptyValues(t *testing.T) {
+	bun, err := bundle.Unmarshal([]byte(`{
+		"name": "empty",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/empty:0.1.0"}],
+		"definitions": {"string": {"type": "string", "default": "default"}, "port": {"type": "integer"}},
+		"parameters": {
+			"name": {"definition": "string"},
+			"upgrade_name": {"definition": "string", "applyTo": ["upgrade"]},
+			"port": {"definition": "port"}
+		}
+	}`))
+	assert.NilError(t, err)
+
+	os.Setenv("CNAB_PARAM_name", "")
+	os.Setenv("CNAB_PARAM_upgrade_name", "")
+	os.Setenv("CNAB_PARAM_port", "")
+	defer os.Unsetenv("CNAB_PARAM_name")
+	defer os.Unsetenv("CNAB_PARAM_upgrade_name")
+	defer os.Unsetenv("CNAB_PARAM_port")
+
+	// An empty string overrides the default, empty values of parameters that do not apply to the action or that are not strings are not set
+	parameters, err := getParameters(bun, "install")
+	assert.NilError(t, err)
+	assert.Equal(t, len(parameters), 1)
+	assert.Equal(t, parameters[0].Name, "name")
+	assert.Equal(t, parameters[0].Source.Value, "")
+
+	parameters, err = getParameters(bun, "upgrade")
+	assert.NilError(t, err)
+	assert.Equal(t, len(parameters), 2)
+}
+
+func TestGetParametersWithMissingRequiredValue(t *testing.T) {
+	bun, err := bundle.Unmarshal([]byte(`{
+		"name": "required",
+		"version": "0.1.0",
+		"schemaVersion": "v1.0.0",
+		"invocationImages": [{"imageType": "docker", "image": "example/required:0.1.0"}],
+		"definitions": {"string": {"type": "string"}, "port": {"type": "integer", "default": 8080}},
+		"parameters": {
+			"upgrade_name": {"definition": "string", "applyTo": ["upgrade"], "required": true},
+			"upgrade_port": {"definition": "port", "applyTo": ["upgrade"], "required": true}
+		}
+	}`))
+	assert.NilError(t, err)
+
+	os.Setenv("CNAB_PARAM_upgrade_name", "")
+	os.Setenv("CNAB_PARAM_upgrade_port", "")
+	defer os.Unsetenv("CNAB_PARAM_upgrade_name")
+	defer os.Unsetenv("CNAB_PARAM_upgrade_port")
+
+	// The parameter can be left empty for the actions it does not apply to, a required parameter with a default is left for the runner to set
+	parameters, err := getParameters(bun, "install")
+	assert.NilError(t, err)
+	assert.Equal(t, len(parameters), 0)
+
+	_, err = getParameters(bun, "upgrade")
+	assert.Error(t, err, "Parameter upgrade_name is required for the upgrade action but is not set")
+	assert.Equal(t, ExitCode(err), ExitCodeConfigError)
+
+	os.Setenv("CNAB_PARAM_upgrade_name", "name")
+	parameters, err = getParameters(bun, "upgrade")
+	assert.NilError(t, err)
+	assert.Equal(t, len(parameters), 1)
+}
+
 func TestGenerateCredsFile(t *testing.T) {
 	os.Setenv("CNAB_CRED_foo", "1")
 	os.Setenv("CNAB_CRED_FILE_bar", base64.StdEncoding.EncodeToString([]byte("2")))
@@ -65,3 +156,63 @@ func TestGenerateCredsFile(t *testing.T) {
 
 	assert.Equal(t, match, true)
 }
+
+func TestGenerateParamsFileWithNameMap(t *testing.T) {
+	os.Setenv("CNAB_NAME_MAP", `{"parameters":{"db_name":"db-name"}}`)
+	os.Setenv("CNAB_PARAM_db_name", "mydb")
+	defer os.Unsetenv("CNAB_NAME_MAP")
+	defer os.Unsetenv("CNAB_PARAM_db_name")
+
+	path, err := generateParamsFile("mybundle1", "install", nil)
+	assert.NilError(t, err)
+
+	content, _ := ioutil.ReadFile(path)
+	assert.Assert(t, strings.Contains(string(content), `{"name":"db-name","source":{"value":"mydb"}}`))
+}
+
+func TestGenerateCredsFileWithNameMap(t *testing.T) {
+	os.Setenv("CNAB_NAME_MAP", `{"credentials":{"db_password":"db-password"}}`)
+	os.Setenv("CNAB_CRED_db_password", "secret")
+	os.Setenv("CNAB_CRED_db-password", "secret")
+	defer os.Unsetenv("CNAB_NAME_MAP")
+	defer os.Unsetenv("CNAB_CRED_db_password")
+	defer os.Unsetenv("CNAB_CRED_db-password")
+
+	_, err := generateCredsFile("mybundle1")
+	assert.ErrorContains(t, err, "Credential db-password is set by both")
+}
+
+func TestConfigureAzureAuthentication(t *testing.T) {
+	os.Setenv("CNAB_AZURE_CLIENT_ID", "client")
+	os.Setenv("CNAB_AZURE_CLIENT_SECRET", "secret")
+	os.Setenv("CNAB_AZURE_MSI_TYPE", "system")
+	defer os.Unsetenv("CNAB_AZURE_MSI_TYPE")
+
+	err := configureAzureAuthentication()
+	assert.Error(t, err, "Unsupported CNAB_AZURE_MSI_TYPE system, must be user")
+
+	os.Setenv("CNAB_AZURE_MSI_TYPE", "user")
+
+	err = configureAzureAuthentication()
+	assert.ErrorContains(t, err, "CNAB_AZURE_USER_MSI_RESOURCE_ID must be set when CNAB_AZURE_MSI_TYPE is user")
+
+	os.Setenv("CNAB_AZURE_USER_MSI_RESOURCE_ID", "/subscriptions/id/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/cnab")
+	defer os.Unsetenv("CNAB_AZURE_USER_MSI_RESOURCE_ID")
+
+	err = configureAzureAuthentication()
+	assert.NilError(t, err)
+
+	_, ok := os.LookupEnv("CNAB_AZURE_CLIENT_SECRET")
+	assert.Assert(t, !ok)
+}
+
+func TestUploadSchema(t *testing.T) {
+	blobClient := storage.NewMemoryClient()
+
+	err := uploadSchema(blobClient)
+	assert.NilError(t, err)
+
+	data, err := blobClient.DownloadBlob("porter", "schema")
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(data), `"claims":"cnab-claim-1.0.0-DRAFT+b5ed2f3"`))
+}
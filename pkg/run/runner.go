@@ -0,0 +1,65 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/registry"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/storage"
+)
+
+// Action is a bundle action to run against an installation
+type Action struct {
+	InstallationName string
+	Name             string
+	BundleTag        string
+	// Stdout and Stderr receive the output of the action, if they are not set the output is written to os.Stdout and os.Stderr
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func (a Action) stdout() io.Writer {
+	if a.Stdout != nil {
+		return a.Stdout
+	}
+
+	return os.Stdout
+}
+
+func (a Action) stderr() io.Writer {
+	if a.Stderr != nil {
+		return a.Stderr
+	}
+
+	return os.Stderr
+}
+
+// Runner runs bundle actions using the parameters and credentials set in CNAB_PARAM_* and CNAB_CRED_* environment variables
+type Runner interface {
+	// Run runs the action, an error is returned if the action could not be run or failed
+	Run(action Action) error
+	// Outputs gets the latest value of each output of the installation
+	Outputs(installationName string) (map[string]string, error)
+}
+
+// newRunner creates the runner selected by CNAB_RUNNER, blobClient is the state storage which is nil for stateless actions
+func newRunner(blobClient storage.BlobClient) (Runner, error) {
+	name := os.Getenv(common.GetEnvironmentVariableNames().CnabRunner)
+
+	switch name {
+	case "", common.RunnerPorter:
+		// Porter stores its installations in the state storage, stateless actions have no state storage so they are run in-process with the claims kept in memory
+		if blobClient == nil {
+			log.Println("Running stateless action using the cnab runner")
+			return newCnabRunner(nil), nil
+		}
+		return &porterRunner{registry: registry.NewClient(registry.ClientOptions{})}, nil
+	case common.RunnerCnab:
+		return newCnabRunner(blobClient), nil
+	default:
+		return nil, fmt.Errorf("Unsupported %s %s, must be %s or %s", common.GetEnvironmentVariableNames().CnabRunner, name, common.RunnerPorter, common.RunnerCnab)
+	}
+}
@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const apiVersion = "2019-12-12"
+
+// BlobClient uploads and downloads blobs in a storage account
+type BlobClient interface {
+	// UploadBlob creates or replaces a block blob
+	UploadBlob(container string, name string, data []byte) error
+	// DownloadBlob gets the contents of a blob
+	DownloadBlob(container string, name string) ([]byte, error)
+	// ListBlobs lists the names of the blobs that start with the prefix
+	ListBlobs(container string, prefix string) ([]string, error)
+	// DeleteBlob deletes a blob
+	DeleteBlob(container string, name string) error
+}
+
+// IsNotFound checks if an error is caused by a blob that does not exist
+func IsNotFound(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "BlobNotFound")
+}
+
+// SharedKeyClient is a BlobClient that authenticates to the Blob service REST API using the storage account key
+type SharedKeyClient struct {
+	AccountName string
+	AccountKey  []byte
+	// Endpoint is the blob service endpoint, e.g. https://myaccount.blob.core.windows.net or http://127.0.0.1:10000/devstoreaccount1 for Azurite
+	Endpoint   string
+	HTTPClient *http.Client
+}
+
+// NewSharedKeyClient creates a SharedKeyClient for a storage account in the Azure public cloud
+func NewSharedKeyClient(accountName string, accountKey string) (*SharedKeyClient, error) {
+	return newSharedKeyClient(accountName, accountKey, fmt.Sprintf("https://%s.blob.core.windows.net", accountName))
+}
+
+// NewClientFromConnectionString creates a SharedKeyClient from a storage account connection string, the blob endpoint is taken from BlobEndpoint or EndpointSuffix if they are set
+func NewClientFromConnectionString(connectionString string) (*SharedKeyClient, error) {
+	settings := map[string]string{}
+	for _, setting := range strings.Split(connectionString, ";") {
+		if setting == "" {
+			continue
+		}
+		keyValue := strings.SplitN(setting, "=", 2)
+		if len(keyValue) != 2 {
+			return nil, fmt.Errorf("Invalid connection string setting %s", strings.SplitN(setting, "=", 2)[0])
+		}
+		settings[strings.ToLower(keyValue[0])] = keyValue[1]
+	}
+
+	accountName := settings["accountname"]
+	accountKey := settings["accountkey"]
+	if accountName == "" || accountKey == "" {
+		return nil, fmt.Errorf("Connection string must contain AccountName and AccountKey")
+	}
+
+	endpoint := settings["blobendpoint"]
+	if endpoint == "" {
+		protocol := settings["defaultendpointsprotocol"]
+		if protocol == "" {
+			protocol = "https"
+		}
+
+		suffix := settings["endpointsuffix"]
+		if suffix == "" {
+			suffix = "core.windows.net"
+		}
+
+		endpoint = fmt.Sprintf("%s://%s.blob.%s", protocol, accountName, suffix)
+	}
+
+	return newSharedKeyClient(accountName, accountKey, endpoint)
+}
+
+func newSharedKeyClient(accountName string, accountKey string, endpoint string) (*SharedKeyClient, error) {
+	key, err := base64.StdEncoding.DecodeString(accountKey)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid storage account key: %s", err)
+	}
+
+	return &SharedKeyClient{
+		AccountName: accountName,
+		AccountKey:  key,
+		Endpoint:    strings.TrimSuffix(endpoint, "/"),
+		HTTPClient:  &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+// UploadBlob creates or replaces a block blob
+func (client *SharedKeyClient) UploadBlob(container string, name string, data []byte) error {
+	request, err := client.newRequest(http.MethodPut, container, name, data)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("x-ms-blob-type", "BlockBlob")
+
+	if _, err := client.do(request); err != nil {
+		return fmt.Errorf("Unable to upload blob %s/%s: %s", container, name, err)
+	}
+
+	return nil
+}
+
+// DownloadBlob gets the contents of a blob
+func (client *SharedKeyClient) DownloadBlob(container string, name string) ([]byte, error) {
+	request, err := client.newRequest(http.MethodGet, container, name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := client.do(request)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to download blob %s/%s: %s", container, name, err)
+	}
+
+	return data, nil
+}
+
+// ListBlobs lists the names of the blobs that start with the prefix
+func (client *SharedKeyClient) ListBlobs(container string, prefix string) ([]string, error) {
+	var names []string
+	marker := ""
+
+	for {
+		query := url.Values{}
+		query.Set("restype", "container")
+		query.Set("comp", "list")
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+
+		request, err := client.newRequest(http.MethodGet, container, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		request.URL.Path = strings.TrimSuffix(request.URL.Path, "/")
+		request.URL.RawPath = ""
+		request.URL.RawQuery = query.Encode()
+
+		data, err := client.do(request)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to list blobs in %s: %s", container, err)
+		}
+
+		var result struct {
+			Blobs struct {
+				Blob []struct {
+					Name string `xml:"Name"`
+				} `xml:"Blob"`
+			} `xml:"Blobs"`
+			NextMarker string `xml:"NextMarker"`
+		}
+		if err := xml.Unmarshal(data, &result); err != nil {
+			return nil, fmt.Errorf("Unable to parse blob list for %s: %s", container, err)
+		}
+
+		for _, blob := range result.Blobs.Blob {
+			names = append(names, blob.Name)
+		}
+
+		if result.NextMarker == "" {
+			return names, nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+// DeleteBlob deletes a blob
+func (client *SharedKeyClient) DeleteBlob(container string, name string) error {
+	request, err := client.newRequest(http.MethodDelete, container, name, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := client.do(request); err != nil {
+		return fmt.Errorf("Unable to delete blob %s/%s: %s", container, name, err)
+	}
+
+	return nil
+}
+
+func (client *SharedKeyClient) newRequest(method string, container string, name string, data []byte) (*http.Request, error) {
+	blobURL := fmt.Sprintf("%s/%s/%s", client.Endpoint, container, (&url.URL{Path: name}).EscapedPath())
+
+	request, err := http.NewRequest(method, blobURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	request.ContentLength = int64(len(data))
+	request.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	request.Header.Set("x-ms-version", apiVersion)
+
+	return request, nil
+}
+
+func (client *SharedKeyClient) do(request *http.Request) ([]byte, error) {
+	signature, err := client.sign(request)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", client.AccountName, signature))
+
+	httpClient := client.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("%s: %s", response.Status, response.Header.Get("x-ms-error-code"))
+	}
+
+	return body, nil
+}
+
+// sign creates the Shared Key signature for a request, see https://docs.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func (client *SharedKeyClient) sign(request *http.Request) (string, error) {
+	contentLength := ""
+	if request.ContentLength > 0 {
+		contentLength = strconv.FormatInt(request.ContentLength, 10)
+	}
+
+	stringToSign := strings.Join([]string{
+		request.Method,
+		request.Header.Get("Content-Encoding"),
+		request.Header.Get("Content-Language"),
+		contentLength,
+		request.Header.Get("Content-MD5"),
+		request.Header.Get("Content-Type"),
+		request.Header.Get("Date"),
+		request.Header.Get("If-Modified-Since"),
+		request.Header.Get("If-Match"),
+		request.Header.Get("If-None-Match"),
+		request.Header.Get("If-Unmodified-Since"),
+		request.Header.Get("Range"),
+		canonicalizedHeaders(request.Header) + canonicalizedResource(client.AccountName, request.URL),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, client.AccountKey)
+	if _, err := mac.Write([]byte(stringToSign)); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func canonicalizedHeaders(header http.Header) string {
+	var names []string
+	for name := range header {
+		if strings.HasPrefix(strings.ToLower(name), "x-ms-") {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+
+	var s strings.Builder
+	for _, name := range names {
+		s.WriteString(strings.ToLower(name) + ":" + strings.TrimSpace(strings.Join(header[name], ",")) + "\n")
+	}
+
+	return s.String()
+}
+
+func canonicalizedResource(accountName string, u *url.URL) string {
+	resource := "/" + accountName + u.EscapedPath()
+
+	query := u.Query()
+	var names []string
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		resource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+
+	return resource
+}
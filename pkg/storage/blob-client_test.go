@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// azuriteConnectionString uses the well known Azurite development storage account
+const azuriteConnectionString = "DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey=Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==;BlobEndpoint=http://127.0.0.1:10000/devstoreaccount1;"
+
+func TestNewClientFromConnectionString(t *testing.T) {
+	client, err := NewClientFromConnectionString(azuriteConnectionString)
+	assert.NilError(t, err)
+	assert.Equal(t, client.AccountName, "devstoreaccount1")
+	assert.Equal(t, client.Endpoint, "http://127.0.0.1:10000/devstoreaccount1")
+
+	client, err = NewClientFromConnectionString("AccountName=cnabstate;AccountKey=a2V5")
+	assert.NilError(t, err)
+	assert.Equal(t, client.Endpoint, "https://cnabstate.blob.core.windows.net")
+
+	_, err = NewClientFromConnectionString("AccountName=cnabstate")
+	assert.ErrorContains(t, err, "Connection string must contain AccountName and AccountKey")
+}
+
+func TestSign(t *testing.T) {
+	client, err := NewClientFromConnectionString(azuriteConnectionString)
+	assert.NilError(t, err)
+
+	request, err := client.newRequest(http.MethodPut, "porter", "schema", []byte("schema"))
+	assert.NilError(t, err)
+	request.Header.Set("x-ms-date", "Sat, 17 Oct 2026 12:00:00 GMT")
+	request.Header.Set("x-ms-blob-type", "BlockBlob")
+
+	signature, err := client.sign(request)
+	assert.NilError(t, err)
+	assert.Equal(t, signature, "xPk8OTwqIIyO5OfX74Brr0OkOiWYoMMo88aZqm7uEZM=")
+}
+
+func TestUploadAndDownloadBlob(t *testing.T) {
+	blobs := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Assert(t, strings.HasPrefix(r.Header.Get("Authorization"), "SharedKey devstoreaccount1:"))
+		switch r.Method {
+		case http.MethodPut:
+			assert.Equal(t, r.Header.Get("x-ms-blob-type"), "BlockBlob")
+			data, _ := ioutil.ReadAll(r.Body)
+			blobs[r.URL.Path] = data
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			data, ok := blobs[r.URL.Path]
+			if !ok {
+				w.Header().Set("x-ms-error-code", "BlobNotFound")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClientFromConnectionString(strings.Replace(azuriteConnectionString, "http://127.0.0.1:10000", server.URL, 1))
+	assert.NilError(t, err)
+
+	err = client.UploadBlob("porter", "outputs/app/id.json", []byte(`{"status":"succeeded"}`))
+	assert.NilError(t, err)
+	_, ok := blobs["/devstoreaccount1/porter/outputs/app/id.json"]
+	assert.Assert(t, ok)
+
+	data, err := client.DownloadBlob("porter", "outputs/app/id.json")
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Equal(data, []byte(`{"status":"succeeded"}`)))
+
+	_, err = client.DownloadBlob("porter", "missing")
+	assert.ErrorContains(t, err, "Unable to download blob porter/missing: 404 Not Found: BlobNotFound")
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/cnabio/cnab-go/utils/crud"
+)
+
+const crudStorePrefix = "cnab"
+
+// CrudStore is a cnab-go crud.Store that keeps items as blobs, it is used to store claims when bundles are run with cnab-go
+//
+// Items are stored as cnab/<item type>/<name>, the group an item belongs to is recorded by an empty blob named cnab/<item type>-groups/<group>/<name>
+type CrudStore struct {
+	client    BlobClient
+	container string
+}
+
+var _ crud.Store = &CrudStore{}
+
+// NewCrudStore creates a CrudStore that keeps items in a blob container
+func NewCrudStore(client BlobClient, container string) *CrudStore {
+	return &CrudStore{
+		client:    client,
+		container: container,
+	}
+}
+
+// Count counts the items of the item type in the group
+func (store *CrudStore) Count(itemType string, group string) (int, error) {
+	names, err := store.List(itemType, group)
+	return len(names), err
+}
+
+// List lists the names of the items of the item type in the group, or all items of the item type if the group is not set
+func (store *CrudStore) List(itemType string, group string) ([]string, error) {
+	prefix := store.itemPrefix(itemType)
+	if group != "" {
+		prefix = store.groupPrefix(itemType, group)
+	}
+
+	blobs, err := store.client.ListBlobs(store.container, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(blobs))
+	for _, blob := range blobs {
+		names = append(names, strings.TrimPrefix(blob, prefix))
+	}
+
+	return names, nil
+}
+
+// Save saves an item and records the group it belongs to
+func (store *CrudStore) Save(itemType string, group string, name string, data []byte) error {
+	if err := store.client.UploadBlob(store.container, store.itemPrefix(itemType)+name, data); err != nil {
+		return err
+	}
+
+	if group == "" {
+		return nil
+	}
+
+	return store.client.UploadBlob(store.container, store.groupPrefix(itemType, group)+name, []byte{})
+}
+
+// Read reads an item, crud.ErrRecordDoesNotExist is returned if the item does not exist
+func (store *CrudStore) Read(itemType string, name string) ([]byte, error) {
+	data, err := store.client.DownloadBlob(store.container, store.itemPrefix(itemType)+name)
+	if IsNotFound(err) {
+		return nil, fmt.Errorf("%s: %s %s", crud.ErrRecordDoesNotExist, itemType, name)
+	}
+
+	return data, err
+}
+
+// Delete deletes an item and removes it from the groups it belongs to
+func (store *CrudStore) Delete(itemType string, name string) error {
+	err := store.client.DeleteBlob(store.container, store.itemPrefix(itemType)+name)
+	if IsNotFound(err) {
+		return fmt.Errorf("%s: %s %s", crud.ErrRecordDoesNotExist, itemType, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	groups, err := store.client.ListBlobs(store.container, path.Join(crudStorePrefix, itemType+"-groups")+"/")
+	if err != nil {
+		return err
+	}
+
+	for _, blob := range groups {
+		if path.Base(blob) != name {
+			continue
+		}
+
+		if err := store.client.DeleteBlob(store.container, blob); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (store *CrudStore) itemPrefix(itemType string) string {
+	return path.Join(crudStorePrefix, itemType) + "/"
+}
+
+func (store *CrudStore) groupPrefix(itemType string, group string) string {
+	return path.Join(crudStorePrefix, itemType+"-groups", group) + "/"
+}
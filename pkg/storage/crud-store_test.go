@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/cnabio/cnab-go/utils/crud"
+	"gotest.tools/v3/assert"
+)
+
+func TestCrudStore(t *testing.T) {
+	store := NewCrudStore(NewMemoryClient(), "porter")
+
+	assert.NilError(t, store.Save("claims", "mybundle1", "claim1", []byte("1")))
+	assert.NilError(t, store.Save("claims", "mybundle1", "claim2", []byte("2")))
+	assert.NilError(t, store.Save("claims", "mybundle2", "claim3", []byte("3")))
+
+	names, err := store.List("claims", "mybundle1")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, names, []string{"claim1", "claim2"})
+
+	count, err := store.Count("claims", "")
+	assert.NilError(t, err)
+	assert.Equal(t, count, 3)
+
+	data, err := store.Read("claims", "claim2")
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "2")
+
+	assert.NilError(t, store.Delete("claims", "claim2"))
+
+	names, err = store.List("claims", "mybundle1")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, names, []string{"claim1"})
+
+	_, err = store.Read("claims", "claim2")
+	assert.ErrorContains(t, err, crud.ErrRecordDoesNotExist.Error())
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryClient is a BlobClient that keeps blobs in memory, for use in tests
+type MemoryClient struct {
+	mutex sync.Mutex
+	blobs map[string][]byte
+}
+
+// NewMemoryClient creates an empty MemoryClient
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{
+		blobs: map[string][]byte{},
+	}
+}
+
+// UploadBlob creates or replaces a blob
+func (client *MemoryClient) UploadBlob(container string, name string, data []byte) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.blobs[container+"/"+name] = append([]byte{}, data...)
+
+	return nil
+}
+
+// DownloadBlob gets the contents of a blob
+func (client *MemoryClient) DownloadBlob(container string, name string) ([]byte, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	data, ok := client.blobs[container+"/"+name]
+	if !ok {
+		return nil, fmt.Errorf("Unable to download blob %s/%s: BlobNotFound", container, name)
+	}
+
+	return append([]byte{}, data...), nil
+}
+
+// ListBlobs lists the names of the blobs that start with the prefix
+func (client *MemoryClient) ListBlobs(container string, prefix string) ([]string, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	var names []string
+	for key := range client.blobs {
+		if strings.HasPrefix(key, container+"/"+prefix) {
+			names = append(names, strings.TrimPrefix(key, container+"/"))
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// DeleteBlob deletes a blob
+func (client *MemoryClient) DeleteBlob(container string, name string) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if _, ok := client.blobs[container+"/"+name]; !ok {
+		return fmt.Errorf("Unable to delete blob %s/%s: BlobNotFound", container, name)
+	}
+	delete(client.blobs, container+"/"+name)
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+)
+
+const (
+	// StatefulActionCondition is the condition for resources that are only needed for actions that are not stateless
+	StatefulActionCondition = "[variables('cnab_stateful_action')]"
+
+	actionDescription = "The name of the action to be performed on the application instance."
+)
+
+// Action defines a bundle action that can be performed by the generated template
+type Action struct {
+	Name        string
+	Description string
+	// Stateless actions do not require an installation and do not store state
+	Stateless bool
+	// Modifies is set for actions that modify the resources managed by the bundle
+	Modifies bool
+	// Custom is set for actions defined by the bundle
+	Custom bool
+}
+
+// getActionDescription gets the description for the cnab_action parameter, including the descriptions of custom actions
+func getActionDescription(actions []Action) string {
+	var descriptions []string
+	for _, action := range actions {
+		if !action.Custom {
+			continue
+		}
+
+		var notes []string
+		if action.Stateless {
+			notes = append(notes, "stateless")
+		}
+		if !action.Modifies {
+			notes = append(notes, "does not modify resources")
+		}
+
+		description := action.Name
+		if action.Description != "" {
+			description += " - " + strings.TrimSuffix(action.Description, ".")
+		}
+		if len(notes) > 0 {
+			description += " (" + strings.Join(notes, ", ") + ")"
+		}
+
+		descriptions = append(descriptions, description)
+	}
+
+	if len(descriptions) == 0 {
+		return actionDescription
+	}
+
+	return fmt.Sprintf("%s Custom actions: %s.", actionDescription, strings.Join(descriptions, "; "))
+}
+
+// addStatelessActions makes the state storage conditional so that it is not created or used when a stateless action is performed
+func (template *Template) addStatelessActions(actions []Action) {
+	var statelessActions []string
+	for _, action := range actions {
+		if action.Stateless {
+			statelessActions = append(statelessActions, "'"+strings.ReplaceAll(action.Name, "'", "''")+"'")
+		}
+	}
+
+	if len(statelessActions) == 0 {
+		return
+	}
+
+	template.Variables["cnab_stateful_action"] = fmt.Sprintf("[not(contains(createArray(%s), variables('cnab_action')))]", strings.Join(statelessActions, ", "))
+
+	for i := range template.Resources {
+		if strings.HasPrefix(template.Resources[i].Type, "Microsoft.Storage/") {
+			template.Resources[i].Condition = StatefulActionCondition
+		}
+	}
+
+	container, err := findContainer(template)
+	if err != nil {
+		return
+	}
+
+	stateEnvironmentVariables := map[string]bool{
+		common.GetEnvironmentVariableNames().CnabAzureStateStorageAccountName: true,
+		common.GetEnvironmentVariableNames().CnabAzureStateStorageAccountKey:  true,
+		common.GetEnvironmentVariableNames().CnabAzureStateFileshare:          true,
+		"AZURE_STORAGE_CONNECTION_STRING":                                     true,
+	}
+
+	for i := range container.Properties.EnvironmentVariables {
+		environmentVariable := &container.Properties.EnvironmentVariables[i]
+		if stateEnvironmentVariables[environmentVariable.Name] {
+			environmentVariable.Value = statefulValue(environmentVariable.Value)
+			environmentVariable.SecureValue = statefulValue(environmentVariable.SecureValue)
+		}
+	}
+
+	container.Properties.EnvironmentVariables = append(container.Properties.EnvironmentVariables, EnvironmentVariable{
+		Name:  common.GetEnvironmentVariableNames().CnabActionStateless,
+		Value: "[string(not(variables('cnab_stateful_action')))]",
+	})
+}
+
+func (template *Template) hasStatelessActions() bool {
+	_, ok := template.Variables["cnab_stateful_action"]
+	return ok
+}
+
+// statefulValue wraps an expression so that it is only evaluated for actions that are not stateless
+func statefulValue(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	expression := "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		expression = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	}
+
+	return fmt.Sprintf("[if(%s, %s, '')]", strings.Trim(StatefulActionCondition, "[]"), expression)
+}
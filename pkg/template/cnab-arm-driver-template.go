@@ -12,7 +12,12 @@ const (
 )
 
 // NewCnabArmDriverTemplate creates a new instance of Template for running a CNAB bundle using cnab-azure-driver
-func NewCnabArmDriverTemplate(bundleName string, bundleTag string, bundleActions []string, containerImageName string, containerImageVersion string, simplify bool) Template {
+func NewCnabArmDriverTemplate(bundleName string, bundleTag string, bundleActions []Action, containerImageName string, containerImageVersion string, simplify bool) Template {
+
+	actionNames := make([]string, 0, len(bundleActions))
+	for _, action := range bundleActions {
+		actionNames = append(actionNames, action.Name)
+	}
 
 	resources := []Resource{
 		{
@@ -142,10 +147,10 @@ func NewCnabArmDriverTemplate(bundleName string, bundleTag string, bundleActions
 	parameters := map[string]Parameter{
 		"cnab_action": {
 			Type:          "string",
-			DefaultValue:  bundleActions[0],
-			AllowedValues: bundleActions,
+			DefaultValue:  actionNames[0],
+			AllowedValues: actionNames,
 			Metadata: &Metadata{
-				Description: "The name of the action to be performed on the application instance.",
+				Description: getActionDescription(bundleActions),
 			},
 		},
 		"cnab_azure_client_id": {
@@ -278,7 +283,7 @@ func NewCnabArmDriverTemplate(bundleName string, bundleTag string, bundleActions
 	}
 
 	output := Outputs{
-		Output{
+		CNABPackageActionLogsCommandOutput: Output{
 			Type:  "string",
 			Value: "[concat('az container logs -g ',resourceGroup().name,' -n ',variables('containerGroupName'),'  --container-name ',variables('containerName'), ' --follow')]",
 		},
@@ -300,6 +305,8 @@ func NewCnabArmDriverTemplate(bundleName string, bundleTag string, bundleActions
 		template.addAdvancedVariables()
 	}
 
+	template.addStatelessActions(bundleActions)
+
 	return template
 }
 
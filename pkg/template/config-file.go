@@ -0,0 +1,74 @@
+package template
+
+import (
+	"fmt"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+)
+
+const (
+	// ConfigFileParameterName is the name of the template parameter for the contents of the driver config file
+	ConfigFileParameterName = "cnab_config_file"
+
+	configFileVolumeName = "cnab-config"
+	configFileMountPath  = "/cnab/config"
+	configFileName       = "config"
+)
+
+// Volume defines a volume of the container group in the generated template, secret volumes are set to base64 encoded files
+type Volume struct {
+	Name   string            `json:"name"`
+	Secret map[string]string `json:"secret,omitempty"`
+}
+
+// VolumeMount defines where a volume is mounted in the container in the generated template
+type VolumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+	ReadOnly  bool   `json:"readOnly,omitempty"`
+}
+
+// AddConfigFile adds a parameter for a YAML or JSON config file for the driver, the file is mounted from a secret volume and named by CNAB_CONFIG_FILE
+func (template *Template) AddConfigFile() error {
+	template.Parameters[ConfigFileParameterName] = Parameter{
+		Type:         "securestring",
+		DefaultValue: "{}",
+		Metadata: &Metadata{
+			Description: "The contents of a YAML or JSON config file for the driver that sets environment variables, parameters and credentials, values set by the template override the values in the file.",
+		},
+	}
+
+	containerGroup, err := findContainerGroup(template)
+	if err != nil {
+		return err
+	}
+
+	properties, ok := containerGroup.Properties.(ContainerGroupProperties)
+	if !ok {
+		return fmt.Errorf("Container group properties not found in the template")
+	}
+
+	properties.Volumes = append(properties.Volumes, Volume{
+		Name: configFileVolumeName,
+		Secret: map[string]string{
+			configFileName: fmt.Sprintf("[base64(parameters('%s'))]", ConfigFileParameterName),
+		},
+	})
+	containerGroup.Properties = properties
+
+	container, err := findContainer(template)
+	if err != nil {
+		return err
+	}
+
+	container.Properties.VolumeMounts = append(container.Properties.VolumeMounts, VolumeMount{
+		Name:      configFileVolumeName,
+		MountPath: configFileMountPath,
+		ReadOnly:  true,
+	})
+
+	return template.SetContainerEnvironmentVariable(EnvironmentVariable{
+		Name:  common.GetEnvironmentVariableNames().CnabConfigFile,
+		Value: configFileMountPath + "/" + configFileName,
+	})
+}
@@ -0,0 +1,87 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+)
+
+const (
+	// KeyVaultNameParameterName is the name of the template parameter for the Key Vault that secrets are read from
+	KeyVaultNameParameterName = "cnab_key_vault_name"
+
+	// KeyVaultIdentityParameterName is the name of the template parameter for the managed identity used to read secrets from the Key Vault
+	KeyVaultIdentityParameterName = "cnab_key_vault_identity"
+
+	// KeyVaultSecretNote is added to the description of parameters that are read from Key Vault
+	KeyVaultSecretNote = "name of the Key Vault secret containing the value"
+)
+
+// AddKeyVault adds the parameters for the Key Vault that credentials and sensitive parameters are read from, and assigns the managed identity used to read them to the container group
+func (template *Template) AddKeyVault() error {
+	template.Parameters[KeyVaultNameParameterName] = Parameter{
+		Type: "string",
+		Metadata: &Metadata{
+			Description: "The name of the Key Vault that credentials and sensitive parameters are read from.",
+		},
+	}
+
+	template.Parameters[KeyVaultIdentityParameterName] = Parameter{
+		Type: "string",
+		Metadata: &Metadata{
+			Description: "The resource id of the user assigned managed identity used to read secrets from the Key Vault, the identity must have permission to get secrets.",
+		},
+	}
+
+	identity := fmt.Sprintf("[parameters('%s')]", KeyVaultIdentityParameterName)
+
+	if err := template.addContainerGroupIdentity(identity); err != nil {
+		return err
+	}
+
+	environmentVariables := []EnvironmentVariable{
+		{
+			Name:  common.GetEnvironmentVariableNames().CnabKeyVaultName,
+			Value: fmt.Sprintf("[parameters('%s')]", KeyVaultNameParameterName),
+		},
+		{
+			Name:  common.GetEnvironmentVariableNames().CnabKeyVaultClientID,
+			Value: fmt.Sprintf("[reference(%s, '2018-11-30').clientId]", strings.Trim(identity, "[]")),
+		},
+	}
+
+	for _, environmentVariable := range environmentVariables {
+		if err := template.SetContainerEnvironmentVariable(environmentVariable); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewKeyVaultSecretParameter creates a template parameter for the name of the Key Vault secret containing the value of a credential or sensitive parameter, if required the secret name defaults to the name of the credential or parameter
+func NewKeyVaultSecretParameter(name string, description string, required bool) Parameter {
+	if description != "" {
+		description += " "
+	}
+	description += fmt.Sprintf("(%s)", KeyVaultSecretNote)
+
+	defaultValue := ""
+	if required {
+		defaultValue = KeyVaultSecretName(name)
+	}
+
+	return Parameter{
+		Type:         "string",
+		DefaultValue: defaultValue,
+		Metadata: &Metadata{
+			Description: description,
+		},
+	}
+}
+
+// KeyVaultSecretName converts a credential or parameter name to a Key Vault secret name, secret names can only contain alphanumeric characters and dashes
+func KeyVaultSecretName(name string) string {
+	return strings.ReplaceAll(common.ToSafeName(name), "_", "-")
+}
@@ -0,0 +1,83 @@
+package template
+
+import (
+	"fmt"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/logs"
+)
+
+const (
+	// LogSinkHTTP forwards the action output to an HTTP endpoint
+	LogSinkHTTP = "http"
+	// LogSinkLogAnalytics forwards the action output to a Log Analytics workspace
+	LogSinkLogAnalytics = "loganalytics"
+
+	// LogSinkURLParameterName is the name of the template parameter for the URL of the HTTP endpoint that the action output is forwarded to
+	LogSinkURLParameterName = "cnab_log_sink_url"
+
+	// LogAnalyticsWorkspaceParameterName is the name of the template parameter for the Log Analytics workspace that the action output is forwarded to
+	LogAnalyticsWorkspaceParameterName = "cnab_log_analytics_workspace"
+
+	logAnalyticsAPIVersion = "2020-08-01"
+)
+
+// ConfigureLogs sets the format of the action output and adds the parameters for the sink the output is forwarded to, the Log Analytics workspace key is read from the workspace so it is not a template parameter
+func (template *Template) ConfigureLogs(format string, sink string) error {
+	names := common.GetEnvironmentVariableNames()
+
+	if !logs.IsValidFormat(format) {
+		return fmt.Errorf("Unsupported log format %s, must be %s or %s", format, logs.FormatText, logs.FormatJSON)
+	}
+
+	var environmentVariables []EnvironmentVariable
+
+	if format == logs.FormatJSON {
+		environmentVariables = append(environmentVariables, EnvironmentVariable{
+			Name:  names.CnabLogFormat,
+			Value: format,
+		})
+	}
+
+	switch sink {
+	case "":
+	case LogSinkHTTP:
+		template.Parameters[LogSinkURLParameterName] = Parameter{
+			Type: "securestring",
+			Metadata: &Metadata{
+				Description: "The URL of the HTTP endpoint that the output of the action is posted to as batches of JSON log records.",
+			},
+		}
+		environmentVariables = append(environmentVariables, EnvironmentVariable{
+			Name:        names.CnabLogSinkURL,
+			SecureValue: fmt.Sprintf("[parameters('%s')]", LogSinkURLParameterName),
+		})
+	case LogSinkLogAnalytics:
+		template.Parameters[LogAnalyticsWorkspaceParameterName] = Parameter{
+			Type: "string",
+			Metadata: &Metadata{
+				Description: "The resource id of the Log Analytics workspace that the output of the action is sent to.",
+			},
+		}
+		workspace := fmt.Sprintf("parameters('%s')", LogAnalyticsWorkspaceParameterName)
+		environmentVariables = append(environmentVariables,
+			EnvironmentVariable{
+				Name:  names.CnabLogAnalyticsWorkspaceID,
+				Value: fmt.Sprintf("[reference(%s, '%s').customerId]", workspace, logAnalyticsAPIVersion),
+			},
+			EnvironmentVariable{
+				Name:        names.CnabLogAnalyticsKey,
+				SecureValue: fmt.Sprintf("[listKeys(%s, '%s').primarySharedKey]", workspace, logAnalyticsAPIVersion),
+			})
+	default:
+		return fmt.Errorf("Unsupported log sink %s, must be %s or %s", sink, LogSinkHTTP, LogSinkLogAnalytics)
+	}
+
+	for _, environmentVariable := range environmentVariables {
+		if err := template.SetContainerEnvironmentVariable(environmentVariable); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
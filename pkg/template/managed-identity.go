@@ -0,0 +1,129 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+)
+
+const (
+	// ManagedIdentityUser creates a user assigned managed identity that the driver uses to authenticate to Azure
+	ManagedIdentityUser = "user"
+
+	// RoleDefinitionIDParameterName is the name of the template parameter for the role assigned to the managed identity
+	RoleDefinitionIDParameterName = "cnab_azure_role_definition_id"
+
+	// contributorRoleDefinitionID is the id of the built-in Contributor role
+	contributorRoleDefinitionID = "b24988ac-6180-42a0-ab88-20f7382dd24c"
+)
+
+// RoleAssignmentProperties defines the properties of the role assignment for the managed identity in the generated template
+type RoleAssignmentProperties struct {
+	RoleDefinitionID string `json:"roleDefinitionId"`
+	PrincipalID      string `json:"principalId"`
+	PrincipalType    string `json:"principalType"`
+	Scope            string `json:"scope"`
+}
+
+// UseManagedIdentity replaces the service principal used by the driver to authenticate to Azure with a managed identity that is assigned a role scoped to the resource group
+// Only user assigned identities are supported, a system assigned identity only exists once the container group has started so the driver could run before its role is assigned
+func (template *Template) UseManagedIdentity(identityType string, simplify bool) error {
+	if identityType != ManagedIdentityUser {
+		return fmt.Errorf("Unsupported managed identity type %s, must be %s", identityType, ManagedIdentityUser)
+	}
+
+	delete(template.Parameters, "cnab_azure_client_id")
+	delete(template.Parameters, "cnab_azure_client_secret")
+	delete(template.Variables, "cnab_azure_client_id")
+	delete(template.Variables, "cnab_azure_client_secret")
+
+	container, err := findContainer(template)
+	if err != nil {
+		return err
+	}
+
+	environmentVariables := make([]EnvironmentVariable, 0, len(container.Properties.EnvironmentVariables))
+	for _, environmentVariable := range container.Properties.EnvironmentVariables {
+		switch environmentVariable.Name {
+		case common.GetEnvironmentVariableNames().CnabAzureClientID, common.GetEnvironmentVariableNames().CnabAzureClientSecret:
+		default:
+			environmentVariables = append(environmentVariables, environmentVariable)
+		}
+	}
+	container.Properties.EnvironmentVariables = environmentVariables
+
+	if simplify {
+		template.Variables[RoleDefinitionIDParameterName] = contributorRoleDefinitionID
+	} else {
+		template.Parameters[RoleDefinitionIDParameterName] = Parameter{
+			Type:         "string",
+			DefaultValue: contributorRoleDefinitionID,
+			Metadata: &Metadata{
+				Description: "The id of the role assigned to the managed identity used to authenticate to Azure, the role is scoped to the resource group, the default is Contributor.",
+			},
+		}
+		template.Variables[RoleDefinitionIDParameterName] = fmt.Sprintf("[parameters('%s')]", RoleDefinitionIDParameterName)
+	}
+
+	roleAssignment := Resource{
+		Type:       "Microsoft.Authorization/roleAssignments",
+		APIVersion: "2020-04-01-preview",
+		Properties: RoleAssignmentProperties{
+			RoleDefinitionID: fmt.Sprintf("[subscriptionResourceId('Microsoft.Authorization/roleDefinitions', variables('%s'))]", RoleDefinitionIDParameterName),
+			PrincipalType:    "ServicePrincipal",
+			Scope:            "[resourceGroup().id]",
+		},
+	}
+
+	if err := template.SetContainerEnvironmentVariable(EnvironmentVariable{
+		Name:  common.GetEnvironmentVariableNames().CnabAzureMsiType,
+		Value: identityType,
+	}); err != nil {
+		return err
+	}
+
+	// The identity only has access to the resource group, so the driver creates the invocation image container in it rather than in a new resource group
+	if err := template.SetContainerEnvironmentVariable(EnvironmentVariable{
+		Name:  common.GetEnvironmentVariableNames().CnabAzureResourceGroup,
+		Value: "[resourceGroup().name]",
+	}); err != nil {
+		return err
+	}
+
+	// The user assigned identity and its role assignment are created before the container group so the driver can authenticate as soon as it starts
+	template.Variables["cnab_azure_identity_name"] = "[concat('cnab-', uniqueString(resourceGroup().id))]"
+	identityID := "resourceId('Microsoft.ManagedIdentity/userAssignedIdentities', variables('cnab_azure_identity_name'))"
+
+	roleAssignment.Name = fmt.Sprintf("[guid(resourceGroup().id, variables('cnab_azure_identity_name'), variables('%s'))]", RoleDefinitionIDParameterName)
+	roleAssignment.DependsOn = []string{"[variables('cnab_azure_identity_name')]"}
+	properties := roleAssignment.Properties.(RoleAssignmentProperties)
+	properties.PrincipalID = fmt.Sprintf("[reference(%s, '2018-11-30').principalId]", identityID)
+	roleAssignment.Properties = properties
+
+	template.Resources = append(template.Resources,
+		Resource{
+			Type:       "Microsoft.ManagedIdentity/userAssignedIdentities",
+			Name:       "[variables('cnab_azure_identity_name')]",
+			APIVersion: "2018-11-30",
+			Location:   "[variables('aci_location')]",
+			Properties: map[string]interface{}{},
+		},
+		roleAssignment,
+	)
+
+	containerGroup, err := findContainerGroup(template)
+	if err != nil {
+		return err
+	}
+	containerGroup.DependsOn = append(containerGroup.DependsOn, fmt.Sprintf("[resourceId('Microsoft.Authorization/roleAssignments', %s)]", strings.Trim(roleAssignment.Name, "[]")))
+
+	if err := template.SetContainerEnvironmentVariable(EnvironmentVariable{
+		Name:  common.GetEnvironmentVariableNames().CnabAzureUserMsiResourceID,
+		Value: "[" + identityID + "]",
+	}); err != nil {
+		return err
+	}
+
+	return template.addContainerGroupIdentity("[" + identityID + "]")
+}
@@ -0,0 +1,156 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+)
+
+const (
+	//OutputsScriptName is the value of the deployment script Resource Name property that retrieves the bundle outputs in the generated template
+	OutputsScriptName = "[variables('cnab_outputs_script_name')]"
+
+	// OutputsIDParameterName is the name of the template parameter used to identify the outputs of a deployment
+	OutputsIDParameterName = "cnab_outputs_id"
+
+	outputsScript = `set -e
+for i in $(seq 1 360); do
+  if az storage blob download --account-name "$CNAB_AZURE_STATE_STORAGE_ACCOUNT_NAME" --account-key "$CNAB_AZURE_STATE_STORAGE_ACCOUNT_KEY" --container-name porter --name "$CNAB_OUTPUTS_BLOB" --file outputs.json --only-show-errors > /dev/null 2>&1; then
+    if [ "$(jq -r .status outputs.json)" != "succeeded" ]; then
+      echo "Bundle action failed: $(jq -r .error outputs.json)" >&2
+      exit 1
+    fi
+    jq '.outputs' outputs.json > "$AZ_SCRIPTS_OUTPUT_PATH"
+    exit 0
+  fi
+  sleep 10
+done
+echo "Timed out waiting for the bundle outputs" >&2
+exit 1
+`
+)
+
+// DeploymentScriptProperties defines the properties of the deployment script that retrieves the bundle outputs in the generated template
+type DeploymentScriptProperties struct {
+	AzCliVersion         string                `json:"azCliVersion"`
+	ScriptContent        string                `json:"scriptContent"`
+	EnvironmentVariables []EnvironmentVariable `json:"environmentVariables"`
+	Timeout              string                `json:"timeout"`
+	RetentionInterval    string                `json:"retentionInterval"`
+	CleanupPreference    string                `json:"cleanupPreference"`
+}
+
+// AddBundleOutput adds a template output for a bundle output, the value is retrieved by a deployment script once the bundle action has completed
+func (template *Template) AddBundleOutput(name string, armType string) error {
+	if err := template.addOutputsScript(); err != nil {
+		return err
+	}
+
+	outputs := fmt.Sprintf("reference(%s).outputs", strings.Trim(OutputsScriptName, "[]"))
+	value := fmt.Sprintf("%s['%s']", outputs, strings.ReplaceAll(name, "'", "''"))
+
+	var defaultValue string
+	switch armType {
+	case "string":
+		defaultValue = "''"
+	case "int":
+		value = fmt.Sprintf("int(%s)", value)
+		defaultValue = "0"
+	case "bool":
+		value = fmt.Sprintf("bool(%s)", value)
+		defaultValue = "false"
+	case "object":
+		value = fmt.Sprintf("json(%s)", value)
+		defaultValue = "json('{}')"
+	case "array":
+		value = fmt.Sprintf("json(%s)", value)
+		defaultValue = "json('[]')"
+	default:
+		return fmt.Errorf("Unable to convert output type '%s' to ARM template output type", armType)
+	}
+
+	// Outputs are only set for the actions that produce them, so a default is used if the output is missing
+	value = fmt.Sprintf("if(contains(%s, '%s'), %s, %s)", outputs, strings.ReplaceAll(name, "'", "''"), value, defaultValue)
+
+	// The deployment script is not deployed for stateless actions
+	if template.hasStatelessActions() {
+		value = fmt.Sprintf("if(%s, %s, %s)", strings.Trim(StatefulActionCondition, "[]"), value, defaultValue)
+	}
+
+	template.Outputs[name] = Output{
+		Type:  armType,
+		Value: "[" + value + "]",
+	}
+
+	return nil
+}
+
+// addOutputsScript adds the deployment script that waits for porter to upload the bundle outputs to the state storage account
+func (template *Template) addOutputsScript() error {
+	for _, resource := range template.Resources {
+		if resource.Name == OutputsScriptName {
+			return nil
+		}
+	}
+
+	outputsBlobEnvVar := EnvironmentVariable{
+		Name:  common.GetEnvironmentVariableNames().CnabOutputsBlob,
+		Value: "[variables('cnab_outputs_blob')]",
+	}
+
+	containerOutputsBlobEnvVar := outputsBlobEnvVar
+
+	var condition string
+	if template.hasStatelessActions() {
+		condition = StatefulActionCondition
+		containerOutputsBlobEnvVar.Value = statefulValue(outputsBlobEnvVar.Value)
+	}
+
+	if err := template.SetContainerEnvironmentVariable(containerOutputsBlobEnvVar); err != nil {
+		return err
+	}
+
+	template.Parameters[OutputsIDParameterName] = Parameter{
+		Type:         "string",
+		DefaultValue: "[newGuid()]",
+		Metadata: &Metadata{
+			Description: "Unique id used to store the bundle outputs for this deployment, the default value should not be changed",
+		},
+	}
+
+	template.Variables["cnab_outputs_blob"] = fmt.Sprintf("[concat('outputs/', variables('cnab_installation_name'), '/', parameters('%s'), '.json')]", OutputsIDParameterName)
+	template.Variables["cnab_outputs_script_name"] = "[concat(variables('containerGroupName'), '-outputs')]"
+
+	template.Resources = append(template.Resources, Resource{
+		Condition:  condition,
+		Type:       "Microsoft.Resources/deploymentScripts",
+		Name:       OutputsScriptName,
+		APIVersion: "2020-10-01",
+		Location:   "[variables('aci_location')]",
+		Kind:       "AzureCLI",
+		DependsOn: []string{
+			ContainerGroupName,
+		},
+		Properties: DeploymentScriptProperties{
+			AzCliVersion:  "2.15.0",
+			ScriptContent: outputsScript,
+			EnvironmentVariables: []EnvironmentVariable{
+				{
+					Name:  common.GetEnvironmentVariableNames().CnabAzureStateStorageAccountName,
+					Value: "[variables('cnab_azure_state_storage_account_name')]",
+				},
+				{
+					Name:        common.GetEnvironmentVariableNames().CnabAzureStateStorageAccountKey,
+					SecureValue: "[listKeys(resourceId('Microsoft.Storage/storageAccounts', variables('cnab_azure_state_storage_account_name')), '2019-04-01').keys[0].value]",
+				},
+				outputsBlobEnvVar,
+			},
+			Timeout:           "PT1H",
+			RetentionInterval: "PT1H",
+			CleanupPreference: "OnSuccess",
+		},
+	})
+
+	return nil
+}
@@ -6,6 +6,9 @@ const (
 	//ContainerGroupName is the value of the ContainerGroup Resource Name property in the generated template
 	ContainerGroupName = "[variables('containerGroupName')]"
 
+	//CNABPackageActionLogsCommandOutput is the name of the output containing the command to view the logs of the container that runs porter
+	CNABPackageActionLogsCommandOutput = "CNAB Package Action Logs Command"
+
 	//ContainerName is the value of the Container Resource Name property for the container that runs porter in the generated template
 	ContainerName = "[variables('containerName')]"
 )
@@ -86,6 +89,7 @@ type ContainerProperties struct {
 	Image                string                `json:"image"`
 	Resources            Resources             `json:"resources"`
 	EnvironmentVariables []EnvironmentVariable `json:"environmentVariables"`
+	VolumeMounts         []VolumeMount         `json:"volumeMounts,omitempty"`
 }
 
 // Container defines the container in the generated template
@@ -99,6 +103,7 @@ type ContainerGroupProperties struct {
 	Containers    []Container `json:"containers"`
 	OsType        string      `json:"osType"`
 	RestartPolicy string      `json:"restartPolicy"`
+	Volumes       []Volume    `json:"volumes,omitempty"`
 }
 
 // Resource defines a resource in the generated template
@@ -107,13 +112,20 @@ type Resource struct {
 	Type       string      `json:"type"`
 	Name       string      `json:"name"`
 	APIVersion string      `json:"apiVersion"`
-	Location   string      `json:"location"`
+	Location   string      `json:"location,omitempty"`
 	Sku        *Sku        `json:"sku,omitempty"`
 	Kind       string      `json:"kind,omitempty"`
+	Identity   *Identity   `json:"identity,omitempty"`
 	DependsOn  []string    `json:"dependsOn,omitempty"`
 	Properties interface{} `json:"properties"`
 }
 
+// Identity defines the managed identity of a resource in the generated template
+type Identity struct {
+	Type                   string                 `json:"type"`
+	UserAssignedIdentities map[string]interface{} `json:"userAssignedIdentities,omitempty"`
+}
+
 // Output defines an output in the generated template
 type Output struct {
 	Type  string `json:"type"`
@@ -121,9 +133,7 @@ type Output struct {
 }
 
 // Outputs defines the outputs in the genreted template
-type Outputs struct {
-	CNABPackageActionLogsCommand Output `json:"CNAB Package Action Logs Command"`
-}
+type Outputs map[string]Output
 
 // setContainerImage sets the image for the container instance
 func (template *Template) setContainerImage(imageName string, version string) error {
@@ -149,6 +159,37 @@ func (template *Template) SetContainerEnvironmentVariable(environmentVariable En
 	return nil
 }
 
+// addContainerGroupIdentity assigns a user assigned identity to the container group
+func (template *Template) addContainerGroupIdentity(userAssignedIdentity string) error {
+	containerGroup, err := findContainerGroup(template)
+	if err != nil {
+		return err
+	}
+
+	if containerGroup.Identity == nil {
+		containerGroup.Identity = &Identity{Type: "UserAssigned"}
+	}
+	identity := containerGroup.Identity
+
+	if identity.UserAssignedIdentities == nil {
+		identity.UserAssignedIdentities = map[string]interface{}{}
+	}
+	identity.UserAssignedIdentities[userAssignedIdentity] = struct{}{}
+
+	return nil
+}
+
+func findContainerGroup(template *Template) (*Resource, error) {
+	for i := range template.Resources {
+		resource := &template.Resources[i]
+		if resource.Name == ContainerGroupName {
+			return resource, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Container group not found in the template")
+}
+
 func findContainer(template *Template) (*Container, error) {
 	for i := range template.Resources {
 		resource := &template.Resources[i]
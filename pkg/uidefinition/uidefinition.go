@@ -0,0 +1,380 @@
+package uidefinition
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/cnabio/cnab-go/bundle"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/common"
+	"github.com/endjin/CNAB.ARM-Converter/pkg/template"
+)
+
+const (
+	// BundleParametersStepName is the name of the step containing the controls for the bundle parameters
+	BundleParametersStepName = "parameters"
+
+	// BundleCredentialsStepName is the name of the step containing the controls for the bundle credentials
+	BundleCredentialsStepName = "credentials"
+)
+
+// CreateUIDefinition defines the createUiDefinition.json used by the Azure portal to deploy the generated template
+type CreateUIDefinition struct {
+	Schema     string     `json:"$schema"`
+	Handler    string     `json:"handler"`
+	Version    string     `json:"version"`
+	Parameters Parameters `json:"parameters"`
+}
+
+// Parameters defines the basics, steps and outputs of the UI definition
+type Parameters struct {
+	Basics  []Element         `json:"basics"`
+	Steps   []Step            `json:"steps"`
+	Outputs map[string]string `json:"outputs"`
+}
+
+// Step defines a blade in the portal containing a set of controls
+type Step struct {
+	Name       string    `json:"name"`
+	Label      string    `json:"label"`
+	SubLabel   *SubLabel `json:"subLabel,omitempty"`
+	BladeTitle string    `json:"bladeTitle"`
+	Elements   []Element `json:"elements"`
+}
+
+// SubLabel defines the text displayed under the step label
+type SubLabel struct {
+	PreValidation  string `json:"preValidation"`
+	PostValidation string `json:"postValidation"`
+}
+
+// Element defines a control in the UI definition
+type Element struct {
+	Name         string       `json:"name"`
+	Type         string       `json:"type"`
+	Label        interface{}  `json:"label"`
+	DefaultValue interface{}  `json:"defaultValue,omitempty"`
+	ToolTip      string       `json:"toolTip,omitempty"`
+	MultiLine    bool         `json:"multiLine,omitempty"`
+	Constraints  *Constraints `json:"constraints,omitempty"`
+	Options      *Options     `json:"options,omitempty"`
+	Visible      bool         `json:"visible"`
+}
+
+// PasswordLabel defines the labels for a password box
+type PasswordLabel struct {
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirmPassword"`
+}
+
+// Constraints defines the validation for a control
+type Constraints struct {
+	Required          bool           `json:"required"`
+	Regex             string         `json:"regex,omitempty"`
+	ValidationMessage string         `json:"validationMessage,omitempty"`
+	AllowedValues     []AllowedValue `json:"allowedValues,omitempty"`
+	Validations       []Validation   `json:"validations,omitempty"`
+}
+
+// AllowedValue defines an entry in a drop down or options group
+type AllowedValue struct {
+	Label string      `json:"label"`
+	Value interface{} `json:"value"`
+}
+
+// Validation defines an expression that must evaluate to true for the value of a control to be valid
+type Validation struct {
+	IsValid string `json:"isValid"`
+	Message string `json:"message"`
+}
+
+// Options defines additional options for a control
+type Options struct {
+	HideConfirmation bool   `json:"hideConfirmation,omitempty"`
+	UploadMode       string `json:"uploadMode,omitempty"`
+	OpenMode         string `json:"openMode,omitempty"`
+}
+
+// NewCreateUIDefinition creates a UI definition for the template generated for the bundle, bundle parameters and credentials are placed on their own steps
+// nameMap maps template parameter names to the names of the bundle parameters and credentials
+func NewCreateUIDefinition(b *bundle.Bundle, generatedTemplate template.Template, nameMap common.NameMap) CreateUIDefinition {
+	uiDefinition := CreateUIDefinition{
+		Schema:  "https://schema.management.azure.com/schemas/0.1.2-preview/CreateUIDefinition.MultiVm.json#",
+		Handler: "Microsoft.Azure.CreateUIDef",
+		Version: "0.1.2-preview",
+		Parameters: Parameters{
+			Basics:  []Element{},
+			Steps:   []Step{},
+			Outputs: map[string]string{},
+		},
+	}
+
+	parametersStep := Step{
+		Name:       BundleParametersStepName,
+		Label:      "Parameters",
+		BladeTitle: fmt.Sprintf("%s parameters", b.Name),
+		SubLabel: &SubLabel{
+			PreValidation:  "Configure the bundle parameters",
+			PostValidation: "Done",
+		},
+		Elements: []Element{},
+	}
+
+	credentialsStep := Step{
+		Name:       BundleCredentialsStepName,
+		Label:      "Credentials",
+		BladeTitle: fmt.Sprintf("%s credentials", b.Name),
+		SubLabel: &SubLabel{
+			PreValidation:  "Provide the bundle credentials",
+			PostValidation: "Done",
+		},
+		Elements: []Element{},
+	}
+
+	// Sort parameters, because Go randomizes order when iterating a map
+	var parameterNames []string
+	for parameterName := range generatedTemplate.Parameters {
+		parameterNames = append(parameterNames, parameterName)
+	}
+	sort.Strings(parameterNames)
+
+	for _, parameterName := range parameterNames {
+		parameter := generatedTemplate.Parameters[parameterName]
+
+		// Parameters defaulted using template expressions are left to the template to evaluate
+		if isExpression(parameter.DefaultValue) {
+			continue
+		}
+
+		if credential, ok := b.Credentials[nameMap.CredentialName(parameterName)]; ok {
+			element := newCredentialElement(parameterName, parameter, credential)
+			credentialsStep.Elements = append(credentialsStep.Elements, element)
+			uiDefinition.Parameters.Outputs[parameterName] = fmt.Sprintf("[steps('%s').%s]", BundleCredentialsStepName, parameterName)
+			continue
+		}
+
+		if _, ok := b.Parameters[nameMap.ParameterName(parameterName)]; ok {
+			value := fmt.Sprintf("steps('%s').%s", BundleParametersStepName, parameterName)
+			element, output := newParameterElement(parameterName, parameter, value)
+			parametersStep.Elements = append(parametersStep.Elements, element)
+			uiDefinition.Parameters.Outputs[parameterName] = fmt.Sprintf(output, value)
+		} else {
+			value := fmt.Sprintf("basics('%s')", parameterName)
+			element, output := newParameterElement(parameterName, parameter, value)
+			uiDefinition.Parameters.Basics = append(uiDefinition.Parameters.Basics, element)
+			uiDefinition.Parameters.Outputs[parameterName] = fmt.Sprintf(output, value)
+		}
+	}
+
+	if len(parametersStep.Elements) > 0 {
+		uiDefinition.Parameters.Steps = append(uiDefinition.Parameters.Steps, parametersStep)
+	}
+
+	if len(credentialsStep.Elements) > 0 {
+		uiDefinition.Parameters.Steps = append(uiDefinition.Parameters.Steps, credentialsStep)
+	}
+
+	return uiDefinition
+}
+
+// newParameterElement creates the control for a template parameter, returning the element and a format string for the output expression that converts the control value to the parameter type
+func newParameterElement(name string, parameter template.Parameter, value string) (Element, string) {
+	element := Element{
+		Name:        name,
+		Label:       toLabel(name),
+		ToolTip:     description(parameter),
+		Constraints: &Constraints{Required: parameter.DefaultValue == nil},
+		Visible:     true,
+	}
+
+	output := "[%s]"
+
+	if allowedValues := toSlice(parameter.AllowedValues); len(allowedValues) > 0 {
+		element.Type = "Microsoft.Common.DropDown"
+		for _, value := range allowedValues {
+			element.Constraints.AllowedValues = append(element.Constraints.AllowedValues, AllowedValue{
+				Label: fmt.Sprintf("%v", value),
+				Value: value,
+			})
+		}
+		if parameter.DefaultValue != nil {
+			element.DefaultValue = fmt.Sprintf("%v", parameter.DefaultValue)
+		}
+		return element, output
+	}
+
+	switch parameter.Type {
+	case "securestring":
+		element.Type = "Microsoft.Common.PasswordBox"
+		element.Label = PasswordLabel{Password: toLabel(name), ConfirmPassword: "Confirm " + strings.ToLower(toLabel(name))}
+		element.Options = &Options{HideConfirmation: true}
+		setLengthConstraints(&element, parameter)
+	case "bool":
+		element.Type = "Microsoft.Common.OptionsGroup"
+		element.Constraints.AllowedValues = []AllowedValue{{Label: "true", Value: true}, {Label: "false", Value: false}}
+		if parameter.DefaultValue != nil {
+			element.DefaultValue = fmt.Sprintf("%v", parameter.DefaultValue)
+		}
+	case "int":
+		element.Type = "Microsoft.Common.TextBox"
+		element.DefaultValue = toDefaultText(parameter.DefaultValue)
+		element.Constraints.Regex = "^-?[0-9]+$"
+		element.Constraints.ValidationMessage = "The value must be a whole number"
+		setRangeConstraints(&element, parameter, fmt.Sprintf("int(%s)", value))
+		output = "[int(%s)]"
+	case "object", "secureobject", "array":
+		element.Type = "Microsoft.Common.TextBox"
+		element.MultiLine = true
+		element.DefaultValue = toDefaultText(parameter.DefaultValue)
+		element.ToolTip = strings.TrimSpace(element.ToolTip + fmt.Sprintf(" (Enter the %s as JSON)", strings.TrimPrefix(parameter.Type, "secure")))
+		output = "[parse(%s)]"
+	default:
+		element.Type = "Microsoft.Common.TextBox"
+		element.DefaultValue = toDefaultText(parameter.DefaultValue)
+		setLengthConstraints(&element, parameter)
+	}
+
+	return element, output
+}
+
+// newCredentialElement creates the control for a bundle credential, file credentials are uploaded and passed to the template base64 encoded
+func newCredentialElement(name string, parameter template.Parameter, credential bundle.Credential) Element {
+	// Credentials read from Key Vault are set using the name of the secret
+	if parameter.Type == "string" {
+		element, _ := newParameterElement(name, parameter, "")
+		return element
+	}
+
+	if credential.Path != "" {
+		return Element{
+			Name:        name,
+			Type:        "Microsoft.Common.FileUpload",
+			Label:       toLabel(name),
+			ToolTip:     credential.Description,
+			Constraints: &Constraints{Required: credential.Required},
+			Options: &Options{
+				UploadMode: "file",
+				OpenMode:   "binary",
+			},
+			Visible: true,
+		}
+	}
+
+	return Element{
+		Name:        name,
+		Type:        "Microsoft.Common.PasswordBox",
+		Label:       PasswordLabel{Password: toLabel(name), ConfirmPassword: "Confirm " + strings.ToLower(toLabel(name))},
+		ToolTip:     description(parameter),
+		Constraints: &Constraints{Required: credential.Required},
+		Options:     &Options{HideConfirmation: true},
+		Visible:     true,
+	}
+}
+
+func setLengthConstraints(element *Element, parameter template.Parameter) {
+	if parameter.MinLength == nil && parameter.MaxLength == nil {
+		return
+	}
+
+	min := 0
+	if parameter.MinLength != nil {
+		min = *parameter.MinLength
+	}
+
+	max := ""
+	if parameter.MaxLength != nil {
+		max = fmt.Sprintf("%d", *parameter.MaxLength)
+	}
+
+	element.Constraints.Regex = fmt.Sprintf("^[\\s\\S]{%d,%s}$", min, max)
+
+	switch {
+	case parameter.MinLength != nil && parameter.MaxLength != nil:
+		element.Constraints.ValidationMessage = fmt.Sprintf("The value must be between %d and %d characters long", min, *parameter.MaxLength)
+	case parameter.MinLength != nil:
+		element.Constraints.ValidationMessage = fmt.Sprintf("The value must be at least %d characters long", min)
+	default:
+		element.Constraints.ValidationMessage = fmt.Sprintf("The value must be at most %d characters long", *parameter.MaxLength)
+	}
+}
+
+func setRangeConstraints(element *Element, parameter template.Parameter, value string) {
+	if parameter.MinValue != nil {
+		element.Constraints.Validations = append(element.Constraints.Validations, Validation{
+			IsValid: fmt.Sprintf("[greaterOrEquals(%s, %d)]", value, *parameter.MinValue),
+			Message: fmt.Sprintf("The value must be at least %d", *parameter.MinValue),
+		})
+	}
+
+	if parameter.MaxValue != nil {
+		element.Constraints.Validations = append(element.Constraints.Validations, Validation{
+			IsValid: fmt.Sprintf("[lessOrEquals(%s, %d)]", value, *parameter.MaxValue),
+			Message: fmt.Sprintf("The value must be at most %d", *parameter.MaxValue),
+		})
+	}
+}
+
+func description(parameter template.Parameter) string {
+	if parameter.Metadata == nil {
+		return ""
+	}
+
+	return parameter.Metadata.Description
+}
+
+// isExpression checks if a default value is an ARM template expression, values starting with [[ are escaped literals
+func isExpression(value interface{}) bool {
+	s, ok := value.(string)
+	return ok && strings.HasPrefix(s, "[") && !strings.HasPrefix(s, "[[")
+}
+
+func toDefaultText(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	if s, ok := value.(string); ok {
+		if s == "" {
+			return nil
+		}
+		// Remove the escaping added for ARM, the UI definition does not treat [ as the start of an expression in default values
+		return strings.TrimPrefix(s, "[")
+	}
+
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func toSlice(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case []string:
+		var values []interface{}
+		for _, s := range v {
+			values = append(values, s)
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// toLabel converts a parameter name such as place_of_birth into a label such as Place of birth
+func toLabel(name string) string {
+	label := strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || r == '.' {
+			return ' '
+		}
+		return r
+	}, name)
+
+	runes := []rune(label)
+	if len(runes) > 0 {
+		runes[0] = unicode.ToUpper(runes[0])
+	}
+
+	return string(runes)
+}